@@ -0,0 +1,15 @@
+package main
+
+import "go-prod-app/internal/repository"
+
+// userCacheConfig reads the user cache settings. The cache is enabled
+// by setting USER_CACHE_SIZE.
+func userCacheConfig() (repository.UserCacheConfig, bool) {
+	cfg := repository.DefaultUserCacheConfig()
+
+	cfg.Size = envInt("USER_CACHE_SIZE", 0)
+	cfg.TTL = envDuration("USER_CACHE_TTL", cfg.TTL)
+	cfg.StaleTTL = envDuration("USER_CACHE_STALE_TTL", cfg.StaleTTL)
+
+	return cfg, cfg.Size > 0
+}
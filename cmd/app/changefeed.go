@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+
+	"go-prod-app/internal/repository"
+)
+
+// newChangeFeed returns the users_changed feed on the primary, or nil
+// unless CHANGE_FEED=true.
+func newChangeFeed(log *slog.Logger) *repository.ChangeFeed {
+	if os.Getenv("CHANGE_FEED") != "true" {
+		return nil
+	}
+
+	cfg := repository.DefaultChangeFeedConfig()
+	cfg.MaxReconnect = envDuration("CHANGE_FEED_MAX_RECONNECT", cfg.MaxReconnect)
+
+	return repository.NewChangeFeed(os.Getenv("DB_DSN"), cfg, log)
+}
+
+// invalidateOnChange drops users changed by any process from cache
+// until ctx is cancelled.
+func invalidateOnChange(
+	ctx context.Context,
+	feed *repository.ChangeFeed,
+	cache *repository.CachedUserRepository,
+) {
+	changes, unsubscribe := feed.Subscribe()
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case change := <-changes:
+			if change.Op == repository.ChangeResync {
+				cache.Purge()
+				continue
+			}
+			cache.Invalidate(change.TenantID, change.ID, change.Version)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"go-prod-app/internal/fieldcrypt"
+	"go-prod-app/internal/reencrypt"
+	"go-prod-app/internal/repository"
+)
+
+// emailKeyRing builds the email key ring from EMAIL_KEYS
+// ("id:base64,..."), EMAIL_ACTIVE_KEY (default: the first key) and
+// EMAIL_INDEX_KEY. PostgreSQL storage does not start without them.
+func emailKeyRing(log *slog.Logger) *fieldcrypt.KeyRing {
+	keys, err := fieldcrypt.ParseKeys(os.Getenv("EMAIL_KEYS"))
+	if err != nil {
+		log.Error("invalid or missing EMAIL_KEYS", "error", err)
+		os.Exit(1)
+	}
+
+	indexKey, err := base64.StdEncoding.DecodeString(os.Getenv("EMAIL_INDEX_KEY"))
+	if err != nil {
+		log.Error("invalid EMAIL_INDEX_KEY", "error", err)
+		os.Exit(1)
+	}
+
+	ring, err := fieldcrypt.NewKeyRing(keys, envString("EMAIL_ACTIVE_KEY", keys[0].ID), indexKey)
+	if err != nil {
+		log.Error("invalid email encryption keys", "error", err)
+		os.Exit(1)
+	}
+
+	return ring
+}
+
+// reencryptConfig reads the re-encryption job settings from
+// EMAIL_REENCRYPT_* variables.
+func reencryptConfig() reencrypt.Config {
+	cfg := reencrypt.DefaultConfig()
+	cfg.BatchSize = envInt("EMAIL_REENCRYPT_BATCH_SIZE", cfg.BatchSize)
+	cfg.Interval = envDuration("EMAIL_REENCRYPT_INTERVAL", cfg.Interval)
+	return cfg
+}
+
+// checkEmailsEncrypted refuses to start while emails stored before
+// encryption remain in plaintext: they have no blind index, so they
+// can be neither found nor read. With DB_AUTO_MIGRATE=true they are
+// encrypted first.
+func checkEmailsEncrypted(log *slog.Logger, users repository.EmailReencrypter) {
+	ctx := repository.WithAllTenants(context.Background())
+
+	if os.Getenv("DB_AUTO_MIGRATE") == "true" {
+		if err := encryptPlaintextEmails(ctx, log, users); err != nil {
+			log.Error("failed to encrypt plaintext emails", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	stale, err := users.CountStaleEmails(ctx)
+	if err != nil {
+		log.Error("failed to count plaintext emails", "error", err)
+		os.Exit(1)
+	}
+	if stale.Plaintext > 0 {
+		log.Error("database holds plaintext emails, run `migrate up` or `reencrypt`", "plaintext", stale.Plaintext)
+		os.Exit(1)
+	}
+}
+
+// encryptPlaintextEmails completes migration 0009: it encrypts and
+// indexes the emails stored before it, if any remain.
+func encryptPlaintextEmails(
+	ctx context.Context,
+	log *slog.Logger,
+	users repository.EmailReencrypter,
+) error {
+
+	ctx = repository.WithAllTenants(ctx)
+
+	stale, err := users.CountStaleEmails(ctx)
+	if err != nil || stale.Plaintext == 0 {
+		return err
+	}
+
+	log.Info("encrypting plaintext emails", "plaintext", stale.Plaintext)
+
+	_, err = reencrypt.New(users, reencryptConfig(), log).RunOnce(ctx)
+	return err
+}
+
+// runReencrypt implements `app reencrypt [--batch-size=500]` and returns
+// the exit code.
+func runReencrypt(log *slog.Logger, args []string) int {
+	cfg := reencryptConfig()
+
+	fs := flag.NewFlagSet("reencrypt", flag.ContinueOnError)
+	fs.IntVar(&cfg.BatchSize, "batch-size", cfg.BatchSize, "rows re-encrypted per transaction")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if cfg.BatchSize <= 0 {
+		log.Error("--batch-size must be positive")
+		return 2
+	}
+
+	db := openPostgres(log)
+	defer db.Close()
+
+	checkSchema(log, db)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	repo := repository.NewPostgresUserRepository(db, emailKeyRing(log))
+
+	if _, err := reencrypt.New(repo, cfg, log).RunOnce(ctx); err != nil {
+		log.Error("re-encryption failed", "error", err)
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+//
+// =========================
+// ENV Helpers
+// =========================
+// Unset or empty variables fall back to the default; a value that
+// does not parse stops the process instead of being ignored
+//
+
+func envString(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+func envInt(key string, def int) int {
+	return envParse(key, def, strconv.Atoi)
+}
+
+func envDuration(key string, def time.Duration) time.Duration {
+	return envParse(key, def, time.ParseDuration)
+}
+
+func envBool(key string, def bool) bool {
+	return envParse(key, def, strconv.ParseBool)
+}
+
+func envParse[T any](key string, def T, parse func(string) (T, error)) T {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+
+	parsed, err := parse(v)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid %s=%q: %v\n", key, v, err)
+		os.Exit(2)
+	}
+	return parsed
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"go-prod-app/internal/importer"
+	"go-prod-app/internal/repository"
+	"go-prod-app/internal/service"
+)
+
+// runImport implements `app import [--format=csv] [--tenant=acme]
+// [--dry-run] [--on-error=abort] [--report=report.csv] users.csv` and
+// returns the exit code: 1 also when an abort left the users unwritten.
+func runImport(log *slog.Logger, args []string) int {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	formatName := fs.String("format", "", "csv, ndjson or json (default: from the file extension)")
+	tenant := fs.String("tenant", repository.DefaultTenant, "tenant to import into")
+	dryRun := fs.Bool("dry-run", false, "only report what would be imported")
+	onError := fs.String("on-error", "skip", "skip invalid and duplicate rows, or abort the import")
+	reportPath := fs.String("report", "-", "file for the per-row report (CSV), - for stdout")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if fs.NArg() != 1 {
+		log.Error("expected one file to import")
+		return 2
+	}
+	path := fs.Arg(0)
+
+	var (
+		format importer.Format
+		err    error
+	)
+	if *formatName != "" {
+		format, err = importer.ParseFormat(*formatName)
+	} else {
+		format, err = importer.FormatFromPath(path)
+	}
+	if err != nil {
+		log.Error(err.Error())
+		return 2
+	}
+
+	opts := service.ImportOptions{DryRun: *dryRun}
+	switch *onError {
+	case "skip":
+	case "abort":
+		opts.AbortOnError = true
+	default:
+		log.Error("--on-error must be skip or abort")
+		return 2
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		log.Error("failed to open input", "error", err)
+		return 1
+	}
+	defer f.Close()
+
+	var records []importer.Record
+	err = importer.Read(f, format, func(rec importer.Record) error {
+		records = append(records, rec)
+		return nil
+	})
+	if err != nil {
+		log.Error("failed to read input", "error", err)
+		return 1
+	}
+
+	db := openPostgres(log)
+	defer db.Close()
+
+	checkSchema(log, db)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	ctx = repository.WithTenant(ctx, *tenant)
+
+	repo := repository.NewPostgresUserRepository(db, emailKeyRing(log))
+	checkEmailsEncrypted(log, repo)
+
+	users := service.NewUserService(repo, repo,
+		service.WithTxManager(repository.NewPostgresTxManager(db)),
+		service.WithOutbox(repository.NewPostgresOutboxRepository(db)),
+		service.WithImporter(repo),
+	)
+
+	report, err := users.ImportUsers(ctx, records, opts)
+	if err != nil {
+		log.Error("import failed", "error", err)
+		return 1
+	}
+
+	if err := writeImportReport(*reportPath, report); err != nil {
+		log.Error("failed to write report", "error", err)
+		return 1
+	}
+
+	log.Info("import finished",
+		"rows", len(report.Rows),
+		"created", report.Created,
+		"duplicate", report.Duplicate,
+		"invalid", report.Invalid,
+		"applied", report.Applied,
+	)
+
+	if !report.Applied && !opts.DryRun {
+		log.Error("import aborted, nothing was written")
+		return 1
+	}
+
+	return 0
+}
+
+// writeImportReport writes one CSV line per input row to path ("-" is
+// stdout).
+func writeImportReport(path string, report *service.ImportReport) error {
+	out := os.Stdout
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	w := csv.NewWriter(out)
+	if err := w.Write([]string{"row", "status", "id", "email", "reason"}); err != nil {
+		return err
+	}
+
+	for _, row := range report.Rows {
+		id := ""
+		if row.User != nil {
+			id = string(row.User.ID())
+		}
+
+		if err := w.Write([]string{
+			strconv.Itoa(row.Row),
+			string(row.Status),
+			id,
+			row.Email,
+			row.Reason,
+		}); err != nil {
+			return err
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	if out != os.Stdout {
+		return out.Close()
+	}
+	return nil
+}
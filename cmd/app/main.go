@@ -3,18 +3,26 @@ package main
 import (
 	"context"
 	"database/sql"
+	"flag"
 	"log/slog"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 
+	"go-prod-app/database"
 	apphttp "go-prod-app/internal/http"
 	"go-prod-app/internal/logger"
 	"go-prod-app/internal/metrics"
+	"go-prod-app/internal/migrate"
+	"go-prod-app/internal/outbox"
+	"go-prod-app/internal/purge"
+	"go-prod-app/internal/reencrypt"
 	"go-prod-app/internal/repository"
 	"go-prod-app/internal/service"
 )
@@ -31,50 +39,230 @@ func main() {
 	// =========================
 	_ = godotenv.Load()
 
-	dsn := os.Getenv("DB_DSN")
-	if dsn == "" {
-		log.Error("missing DB_DSN")
-		os.Exit(1)
-	}
-
 	// =========================
-	// Connect DB
+	// Subcommands
 	// =========================
-	db, err := sql.Open("postgres", dsn)
-	if err != nil {
-		log.Error("failed to open db", "error", err)
-		os.Exit(1)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			os.Exit(runMigrate(log, os.Args[2:]))
+		case "purge":
+			os.Exit(runPurge(log, os.Args[2:]))
+		case "reencrypt":
+			os.Exit(runReencrypt(log, os.Args[2:]))
+		case "export":
+			os.Exit(runExport(log, os.Args[2:]))
+		case "import":
+			os.Exit(runImport(log, os.Args[2:]))
+		}
 	}
 
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(10)
-	db.SetConnMaxLifetime(5 * time.Minute)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	storage := flag.String("storage", "", "user storage backend: postgres, sqlite or memory (default: from the DB_DSN scheme)")
+	flag.Parse()
 
-	if err := db.PingContext(ctx); err != nil {
-		log.Error("failed to ping db", "error", err)
-		os.Exit(1)
+	if *storage == "" {
+		*storage = storageFromDSN(os.Getenv("DB_DSN"))
 	}
 
-	log.Info("database connected")
-
 	// =========================
 	// Init Metrics
 	// =========================
 	metrics.Init()
 
+	var (
+		userRepo interface {
+			repository.UserRepository
+			repository.HealthChecker
+		}
+		txManager    repository.TxManager
+		outboxRepo   repository.OutboxRepository
+		userHistory  repository.UserHistoryRepository
+		userPurger   repository.UserPurger
+		userSearcher repository.UserSearcher
+		userCounter  repository.UserCountEstimator
+		userExporter repository.UserExporter
+		userImporter repository.UserImporter
+		reencrypter  repository.EmailReencrypter
+		db           *sql.DB
+		replicas     *repository.ReplicaSet
+		changeFeed   *repository.ChangeFeed
+	)
+
+	closeReplicas := func() {}
+
+	switch *storage {
+	case "postgres":
+		db = openPostgres(log)
+		checkSchema(log, db)
+		metrics.RegisterDBStats(db, "primary")
+
+		var err error
+		replicas, closeReplicas, err = openReplicas(log, db)
+		if err != nil {
+			log.Error("failed to open read replicas", "error", err)
+			os.Exit(1)
+		}
+
+		var repoOpts []repository.PostgresUserOption
+		if replicas != nil {
+			repoOpts = append(repoOpts, repository.WithReplicas(replicas))
+		}
+
+		postgresRepo := repository.NewPostgresUserRepository(db, emailKeyRing(log), repoOpts...)
+		checkEmailsEncrypted(log, postgresRepo)
+
+		userRepo = postgresRepo
+		userHistory = postgresRepo
+		userPurger = postgresRepo
+		userSearcher = postgresRepo
+		userCounter = postgresRepo
+		userExporter = postgresRepo
+		userImporter = postgresRepo
+		reencrypter = postgresRepo
+		txManager = repository.NewPostgresTxManager(db)
+		outboxRepo = repository.NewPostgresOutboxRepository(db)
+		changeFeed = newChangeFeed(log)
+
+	case "sqlite":
+		db = openSQLite(log)
+		metrics.RegisterDBStats(db, "primary")
+		sqliteRepo := repository.NewSQLiteUserRepository(db)
+		userRepo = sqliteRepo
+		txManager = repository.NewSQLTxManager(db)
+
+	case "memory":
+		log.Warn("using in-memory storage, data will be lost on shutdown")
+		memoryRepo := repository.NewMemoryUserRepository()
+		memoryOutbox := repository.NewMemoryOutboxRepository()
+		userRepo = memoryRepo
+		userHistory = memoryRepo
+		userPurger = memoryRepo
+		userSearcher = memoryRepo
+		userExporter = memoryRepo
+		userImporter = memoryRepo
+		outboxRepo = memoryOutbox
+		txManager = repository.NewMemoryTxManager(memoryRepo, memoryOutbox)
+
+	default:
+		log.Error("unknown storage backend", "storage", *storage)
+		os.Exit(1)
+	}
+
 	// =========================
 	// Wire Dependencies
 	// =========================
-	userRepo := repository.NewPostgresUserRepository(db)
-	userService := service.NewUserService(userRepo, userRepo)
+	// Innermost, so each database attempt is timed on its own.
+	var users repository.UserRepository = repository.NewInstrumentedUserRepository(userRepo)
+
+	if *storage == "postgres" {
+		policy := retryPolicy()
+		users = repository.NewRetryingUserRepository(users, policy)
+		userHistory = repository.NewRetryingUserHistory(userHistory, policy)
+		userSearcher = repository.NewRetryingUserSearcher(userSearcher, policy)
+		userCounter = repository.NewRetryingUserCountEstimator(userCounter, policy)
+	}
+
+	var userCache *repository.CachedUserRepository
+	if cacheCfg, ok := userCacheConfig(); ok {
+		log.Info("user cache enabled", "size", cacheCfg.Size, "ttl", cacheCfg.TTL.String())
+		userCache = repository.NewCachedUserRepository(users, cacheCfg)
+		users = userCache
+	}
+
+	serviceOpts := []service.Option{
+		service.WithTxManager(txManager),
+		service.WithOutbox(outboxRepo),
+		service.WithHistory(userHistory),
+		service.WithSearcher(userSearcher),
+		service.WithCountEstimator(userCounter),
+		service.WithExporter(userExporter),
+		service.WithImporter(userImporter),
+		service.WithExactCountTimeout(envDuration("COUNT_EXACT_TIMEOUT", time.Second)),
+	}
+
+	// SQLite has a single connection, which any query in flight fills,
+	// so only the Postgres pools are watched.
+	var poolMonitors []*repository.PoolMonitor
+	if *storage == "postgres" {
+		pools := []*sql.DB{db}
+		if replicas != nil {
+			for _, r := range replicas.Replicas() {
+				pools = append(pools, r.DB)
+			}
+		}
+
+		for _, pool := range pools {
+			m := repository.NewPoolMonitor(pool, poolMonitorConfig())
+			poolMonitors = append(poolMonitors, m)
+			serviceOpts = append(serviceOpts, service.WithPoolHealth(m))
+		}
+	}
+
+	userService := service.NewUserService(users, userRepo, serviceOpts...)
+
+	// =========================
+	// Background Workers
+	// =========================
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+
+	sink, closeSink, err := newOutboxSink(log)
+	if err != nil {
+		log.Error("failed to create outbox sink", "error", err)
+		os.Exit(1)
+	}
+
+	if sink != nil {
+		if outboxRepo == nil {
+			log.Error("outbox relay is not supported by storage backend", "storage", *storage)
+			os.Exit(1)
+		}
+		relay := outbox.NewRelay(outboxRepo, sink, outboxRelayConfig(), log)
+		workers.Go(func() { relay.Run(workerCtx) })
+	}
+
+	if replicas != nil {
+		workers.Go(func() { replicas.Run(workerCtx) })
+	}
+
+	for _, m := range poolMonitors {
+		workers.Go(func() { m.Run(workerCtx) })
+	}
+
+	if changeFeed != nil {
+		workers.Go(func() { changeFeed.Run(workerCtx) })
+
+		if userCache != nil {
+			workers.Go(func() { invalidateOnChange(workerCtx, changeFeed, userCache) })
+		}
+	}
+
+	// Moves emails to the active key after a rotation
+	if cfg := reencryptConfig(); reencrypter != nil && cfg.Interval > 0 {
+		job := reencrypt.New(reencrypter, cfg, log)
+		workers.Go(func() { job.Run(workerCtx) })
+	}
+
+	// Retention purge is opt-in: PURGE_RETENTION enables it
+	if os.Getenv("PURGE_RETENTION") != "" {
+		if userPurger == nil {
+			log.Error("retention purge is not supported by storage backend", "storage", *storage)
+			os.Exit(1)
+		}
+		cfg := purgeConfig()
+		if err := cfg.Validate(); err != nil {
+			log.Error("invalid PURGE_* settings", "error", err)
+			os.Exit(1)
+		}
+		purger := purge.New(txManager, userPurger, outboxRepo, cfg, log)
+		workers.Go(func() { purger.Run(workerCtx) })
+	}
 
 	// =========================
 	// Start HTTP Server
 	// =========================
-	server := apphttp.StartServer(userService, log)
+	tenants := apphttp.TenantFromHeader("X-Tenant-ID", envBool("TENANT_REQUIRED", false))
+	server := apphttp.StartServer(userService, tenants, log)
 
 	// =========================
 	// Graceful Shutdown
@@ -90,13 +278,122 @@ func main() {
 		log.Error("server shutdown failed", "error", err)
 	}
 
-	if err := db.Close(); err != nil {
-		log.Error("error closing db", "error", err)
+	stopWorkers()
+	workers.Wait()
+	closeSink()
+	closeReplicas()
+
+	if db != nil {
+		if err := db.Close(); err != nil {
+			log.Error("error closing db", "error", err)
+		}
 	}
 
 	log.Info("shutdown complete")
 }
 
+// storageFromDSN picks the backend for DB_DSN: sqlite for sqlite: and
+// file: DSNs, postgres otherwise.
+func storageFromDSN(dsn string) string {
+	if strings.HasPrefix(dsn, "sqlite:") || strings.HasPrefix(dsn, "file:") {
+		return "sqlite"
+	}
+	return "postgres"
+}
+
+func openPostgres(log *slog.Logger) *sql.DB {
+	dsn := os.Getenv("DB_DSN")
+	if dsn == "" {
+		log.Error("missing DB_DSN")
+		os.Exit(1)
+	}
+
+	// =========================
+	// Connect DB
+	// =========================
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		log.Error("failed to open db", "error", err)
+		os.Exit(1)
+	}
+
+	configurePool(db)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := db.PingContext(ctx); err != nil {
+		log.Error("failed to ping db", "error", err)
+		os.Exit(1)
+	}
+
+	log.Info("database connected")
+
+	return db
+}
+
+// configurePool applies the DB_* pool settings. Replicas use the same
+// settings as the primary.
+func configurePool(db *sql.DB) {
+	db.SetMaxOpenConns(envInt("DB_MAX_OPEN_CONNS", 25))
+	db.SetMaxIdleConns(envInt("DB_MAX_IDLE_CONNS", 10))
+	db.SetConnMaxLifetime(envDuration("DB_CONN_MAX_LIFETIME", 5*time.Minute))
+	db.SetConnMaxIdleTime(envDuration("DB_CONN_MAX_IDLE_TIME", 0))
+}
+
+// poolMonitorConfig reads when a saturated pool turns /ready degraded.
+func poolMonitorConfig() repository.PoolMonitorConfig {
+	cfg := repository.DefaultPoolMonitorConfig()
+	cfg.Window = envDuration("DB_POOL_SATURATION_WINDOW", cfg.Window)
+	return cfg
+}
+
+// retryPolicy reads how transient database errors on reads are retried.
+func retryPolicy() repository.RetryPolicy {
+	policy := repository.DefaultRetryPolicy()
+	policy.MaxAttempts = envInt("DB_RETRY_MAX_ATTEMPTS", policy.MaxAttempts)
+	policy.BaseBackoff = envDuration("DB_RETRY_BASE_BACKOFF", policy.BaseBackoff)
+	policy.MaxBackoff = envDuration("DB_RETRY_MAX_BACKOFF", policy.MaxBackoff)
+	return policy
+}
+
+// checkSchema refuses to start against a database whose schema version
+// differs from what PostgresUserRepository expects, or as a role that
+// row-level security does not apply to. With DB_AUTO_MIGRATE=true
+// pending migrations are applied first.
+func checkSchema(log *slog.Logger, db *sql.DB) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if os.Getenv("DB_AUTO_MIGRATE") == "true" {
+		migrator, err := migrate.New(db, database.Migrations())
+		if err != nil {
+			log.Error("failed to load migrations", "error", err)
+			os.Exit(1)
+		}
+
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			log.Error("failed to migrate database", "error", err)
+			os.Exit(1)
+		}
+
+		for _, m := range applied {
+			log.Info("migration applied", "version", m.Version, "name", m.Name)
+		}
+	}
+
+	if err := migrate.CheckVersion(ctx, db, repository.PostgresSchemaVersion); err != nil {
+		log.Error("database schema is not compatible, run `migrate up`", "error", err)
+		os.Exit(1)
+	}
+
+	if err := repository.CheckRowSecurity(ctx, db); err != nil {
+		log.Error("refusing to run without tenant isolation", "error", err)
+		os.Exit(1)
+	}
+}
+
 func waitForShutdown(log *slog.Logger) {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go-prod-app/internal/outbox"
+)
+
+// newOutboxSink builds the sink selected by OUTBOX_SINK.
+// It returns a nil sink when OUTBOX_SINK is unset: events are still
+// written to the outbox but no relay runs in this process.
+func newOutboxSink(log *slog.Logger) (outbox.Sink, func(), error) {
+	noop := func() {}
+
+	switch kind := envString("OUTBOX_SINK", ""); kind {
+	case "":
+		return nil, noop, nil
+
+	case "stdout":
+		return outbox.NewStdoutSink(), noop, nil
+
+	case "file":
+		path := envString("OUTBOX_FILE_PATH", "outbox.ndjson")
+
+		sink, err := outbox.NewFileSink(path)
+		if err != nil {
+			return nil, noop, err
+		}
+
+		return sink, func() {
+			if err := sink.Close(); err != nil {
+				log.Error("error closing outbox file", "error", err)
+			}
+		}, nil
+
+	case "http":
+		url := envString("OUTBOX_HTTP_URL", "")
+		if url == "" {
+			return nil, noop, fmt.Errorf("OUTBOX_HTTP_URL is required for the http sink")
+		}
+
+		return outbox.NewHTTPSink(url, envDuration("OUTBOX_HTTP_TIMEOUT", 5*time.Second)), noop, nil
+
+	default:
+		return nil, noop, fmt.Errorf("unknown OUTBOX_SINK %q", kind)
+	}
+}
+
+func outboxRelayConfig() outbox.RelayConfig {
+	cfg := outbox.DefaultRelayConfig()
+
+	cfg.BatchSize = envInt("OUTBOX_BATCH_SIZE", cfg.BatchSize)
+	cfg.Lease = envDuration("OUTBOX_LEASE", cfg.Lease)
+	cfg.PollInterval = envDuration("OUTBOX_POLL_INTERVAL", cfg.PollInterval)
+	cfg.MaxAttempts = envInt("OUTBOX_MAX_ATTEMPTS", cfg.MaxAttempts)
+	cfg.BaseBackoff = envDuration("OUTBOX_BASE_BACKOFF", cfg.BaseBackoff)
+	cfg.MaxBackoff = envDuration("OUTBOX_MAX_BACKOFF", cfg.MaxBackoff)
+
+	return cfg
+}
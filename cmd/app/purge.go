@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"os/signal"
+	"syscall"
+
+	"go-prod-app/internal/purge"
+	"go-prod-app/internal/repository"
+)
+
+// runPurge implements `app purge --older-than=720h [--dry-run]`
+// and returns the exit code.
+func runPurge(log *slog.Logger, args []string) int {
+	cfg := purgeConfig()
+
+	fs := flag.NewFlagSet("purge", flag.ContinueOnError)
+	fs.DurationVar(&cfg.Retention, "older-than", cfg.Retention, "purge users soft-deleted longer than this")
+	fs.IntVar(&cfg.BatchSize, "batch-size", cfg.BatchSize, "users removed per transaction")
+	fs.BoolVar(&cfg.DryRun, "dry-run", false, "only report how many users would be purged")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if cfg.Retention <= 0 || cfg.BatchSize <= 0 {
+		log.Error("--older-than and --batch-size must be positive")
+		return 2
+	}
+
+	db := openPostgres(log)
+	defer db.Close()
+
+	checkSchema(log, db)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	repo := repository.NewPostgresUserRepository(db, emailKeyRing(log))
+
+	purger := purge.New(
+		repository.NewPostgresTxManager(db),
+		repo,
+		repository.NewPostgresOutboxRepository(db),
+		cfg,
+		log,
+	)
+
+	if _, err := purger.RunOnce(ctx); err != nil {
+		log.Error("purge failed", "error", err)
+		return 1
+	}
+
+	return 0
+}
+
+// purgeConfig reads the retention policy from PURGE_* variables.
+func purgeConfig() purge.Config {
+	cfg := purge.DefaultConfig()
+
+	cfg.Retention = envDuration("PURGE_RETENTION", cfg.Retention)
+	cfg.BatchSize = envInt("PURGE_BATCH_SIZE", cfg.BatchSize)
+	cfg.BatchPause = envDuration("PURGE_BATCH_PAUSE", cfg.BatchPause)
+	cfg.Interval = envDuration("PURGE_INTERVAL", cfg.Interval)
+	cfg.DryRun = envBool("PURGE_DRY_RUN", false)
+
+	return cfg
+}
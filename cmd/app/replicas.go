@@ -0,0 +1,64 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"go-prod-app/internal/metrics"
+	"go-prod-app/internal/repository"
+)
+
+// openReplicas opens the read replicas listed in DB_REPLICA_DSNS
+// (comma-separated). It returns a nil set when none are configured.
+// Replicas are not pinged here: the set keeps them out of rotation
+// until their first health check passes.
+func openReplicas(log *slog.Logger, primary *sql.DB) (*repository.ReplicaSet, func(), error) {
+	noop := func() {}
+
+	var dsns []string
+	for _, dsn := range strings.Split(envString("DB_REPLICA_DSNS", ""), ",") {
+		if dsn = strings.TrimSpace(dsn); dsn != "" {
+			dsns = append(dsns, dsn)
+		}
+	}
+	if len(dsns) == 0 {
+		return nil, noop, nil
+	}
+
+	var replicas []repository.Replica
+
+	closeAll := func() {
+		for _, r := range replicas {
+			if err := r.DB.Close(); err != nil {
+				log.Error("error closing replica", "replica", r.Name, "error", err)
+			}
+		}
+	}
+
+	for i, dsn := range dsns {
+		db, err := sql.Open("postgres", dsn)
+		if err != nil {
+			closeAll()
+			return nil, noop, fmt.Errorf("replica %d: %w", i+1, err)
+		}
+		configurePool(db)
+
+		name := fmt.Sprintf("replica-%d", i+1)
+		metrics.RegisterDBStats(db, name)
+
+		replicas = append(replicas, repository.Replica{
+			Name: name,
+			DB:   db,
+		})
+	}
+
+	cfg := repository.DefaultReplicaConfig()
+	cfg.MaxLag = envDuration("DB_REPLICA_MAX_LAG", cfg.MaxLag)
+	cfg.CheckInterval = envDuration("DB_REPLICA_CHECK_INTERVAL", cfg.CheckInterval)
+
+	log.Info("read replicas configured", "count", len(replicas))
+
+	return repository.NewReplicaSet(primary, replicas, cfg, log), closeAll, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"go-prod-app/database"
+)
+
+// sqliteDriver is the database/sql driver name registered by
+// modernc.org/sqlite (see sqlite_driver.go).
+const sqliteDriver = "sqlite"
+
+// openSQLite opens the SQLite database in DB_DSN and applies its schema.
+//
+//	DB_DSN=sqlite://./data/users.db
+//	DB_DSN=file:users.db
+func openSQLite(log *slog.Logger) *sql.DB {
+	dsn := os.Getenv("DB_DSN")
+
+	path := strings.TrimPrefix(dsn, "sqlite://")
+	path = strings.TrimPrefix(path, "sqlite:")
+	if path == "" {
+		log.Error("missing SQLite path in DB_DSN")
+		os.Exit(1)
+	}
+
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	path += sep + "_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+
+	db, err := sql.Open(sqliteDriver, path)
+	if err != nil {
+		log.Error("failed to open sqlite db", "error", err)
+		os.Exit(1)
+	}
+
+	// One connection: SQLite has a single writer, and transactions
+	// upgrading to write locks would otherwise fail with SQLITE_BUSY.
+	db.SetMaxOpenConns(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := db.ExecContext(ctx, database.SQLiteSchema()); err != nil {
+		log.Error("failed to apply sqlite schema", "error", err)
+		os.Exit(1)
+	}
+
+	log.Info("database connected", "storage", "sqlite")
+
+	return db
+}
@@ -0,0 +1,4 @@
+package main
+
+// Pure-Go SQLite driver: keeps CGO_ENABLED=0 builds working.
+import _ "modernc.org/sqlite"
@@ -0,0 +1,31 @@
+// Package database holds the SQL schema, embedded into the binary.
+package database
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migrations returns the numbered schema migrations:
+//
+//	NNNN_name.up.sql
+//	NNNN_name.down.sql
+func Migrations() fs.FS {
+	sub, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+//go:embed sqlite/schema.sql
+var sqliteSchema string
+
+// SQLiteSchema returns the idempotent schema for the SQLite backend.
+// SQLite databases are not versioned: the schema is applied on startup.
+func SQLiteSchema() string {
+	return sqliteSchema
+}
@@ -0,0 +1,18 @@
+#!/bin/sh
+# Creates the role the app connects as. It owns the database, so it can
+# run migrations, but it is not a superuser and lacks BYPASSRLS:
+# row-level security applies to it. The app refuses to start otherwise.
+#
+# Runs once, from docker-entrypoint-initdb.d, on an empty data volume.
+set -e
+
+psql -v ON_ERROR_STOP=1 \
+	--username "$POSTGRES_USER" \
+	--dbname "$POSTGRES_DB" \
+	-v app_user="$APP_DB_USER" \
+	-v app_password="$APP_DB_PASSWORD" \
+	-v db="$POSTGRES_DB" <<'EOSQL'
+CREATE ROLE :"app_user" LOGIN NOSUPERUSER NOBYPASSRLS PASSWORD :'app_password';
+ALTER DATABASE :"db" OWNER TO :"app_user";
+ALTER SCHEMA public OWNER TO :"app_user";
+EOSQL
@@ -0,0 +1,17 @@
+CREATE TABLE outbox (
+    id BIGSERIAL PRIMARY KEY,
+    event_id UUID NOT NULL UNIQUE,
+    aggregate_id UUID NOT NULL,
+    event_type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_error TEXT,
+    published_at TIMESTAMPTZ,
+    dead_lettered_at TIMESTAMPTZ
+);
+
+-- Only undelivered rows are ever scanned by the relay.
+CREATE INDEX idx_outbox_pending ON outbox(next_attempt_at, id)
+    WHERE published_at IS NULL AND dead_lettered_at IS NULL;
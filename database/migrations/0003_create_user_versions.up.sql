@@ -0,0 +1,26 @@
+-- One row per persisted version of a user: the full state after the
+-- change plus who made it and which fields it touched.
+CREATE TABLE user_versions (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    version INT NOT NULL,
+    name TEXT NOT NULL,
+    email TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    deleted_at TIMESTAMPTZ,
+    changed_by TEXT,
+    changed_fields TEXT[] NOT NULL DEFAULT '{}',
+    changed_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (user_id, version)
+);
+
+-- Existing users start their history at their current version.
+INSERT INTO user_versions (
+    user_id, version, name, email,
+    created_at, updated_at, deleted_at,
+    changed_by, changed_fields, changed_at
+)
+SELECT id, version, name, email,
+       created_at, updated_at, deleted_at,
+       NULL, '{}', updated_at
+FROM users;
@@ -0,0 +1,4 @@
+-- Fails if an email has been reused since the upgrade.
+DROP INDEX IF EXISTS users_active_email_key;
+
+ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
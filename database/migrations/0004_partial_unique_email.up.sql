@@ -0,0 +1,7 @@
+-- Email must be unique among active users only, so a soft-deleted
+-- user no longer blocks a new signup with the same address.
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+
+CREATE UNIQUE INDEX users_active_email_key
+    ON users (lower(email))
+    WHERE deleted_at IS NULL;
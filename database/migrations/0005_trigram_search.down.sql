@@ -0,0 +1,3 @@
+-- The extension is left installed: other schemas may use it.
+DROP INDEX IF EXISTS idx_users_email_trgm;
+DROP INDEX IF EXISTS idx_users_name_trgm;
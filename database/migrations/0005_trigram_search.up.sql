@@ -0,0 +1,5 @@
+-- Fuzzy search on name and email (UserFilter.Query, /users/suggest).
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX idx_users_name_trgm ON users USING gin (name gin_trgm_ops);
+CREATE INDEX idx_users_email_trgm ON users USING gin (email gin_trgm_ops);
@@ -0,0 +1,6 @@
+CREATE INDEX idx_users_created_at ON users(created_at);
+
+DROP INDEX IF EXISTS idx_users_email_id;
+DROP INDEX IF EXISTS idx_users_name_id;
+DROP INDEX IF EXISTS idx_users_updated_at_id;
+DROP INDEX IF EXISTS idx_users_created_at_id;
@@ -0,0 +1,9 @@
+-- Keyset pagination for each List sort: (key, id) serves both
+-- directions and the id tiebreaker.
+CREATE INDEX idx_users_created_at_id ON users(created_at, id);
+CREATE INDEX idx_users_updated_at_id ON users(updated_at, id);
+CREATE INDEX idx_users_name_id ON users(name, id);
+CREATE INDEX idx_users_email_id ON users(email, id);
+
+-- Covered by idx_users_created_at_id.
+DROP INDEX IF EXISTS idx_users_created_at;
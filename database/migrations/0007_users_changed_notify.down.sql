@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS users_changed_notify ON users;
+DROP FUNCTION IF EXISTS notify_users_changed();
@@ -0,0 +1,25 @@
+-- NOTIFY users_changed with {"id", "version", "op"} for every committed
+-- change to users, so other processes can follow them (ChangeFeed).
+CREATE FUNCTION notify_users_changed() RETURNS trigger AS $$
+DECLARE
+    row users%ROWTYPE;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        row := OLD;
+    ELSE
+        row := NEW;
+    END IF;
+
+    PERFORM pg_notify('users_changed', json_build_object(
+        'id', row.id,
+        'version', row.version,
+        'op', lower(TG_OP)
+    )::text);
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER users_changed_notify
+    AFTER INSERT OR UPDATE OR DELETE ON users
+    FOR EACH ROW EXECUTE FUNCTION notify_users_changed();
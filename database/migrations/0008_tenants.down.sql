@@ -0,0 +1,46 @@
+CREATE OR REPLACE FUNCTION notify_users_changed() RETURNS trigger AS $$
+DECLARE
+    row users%ROWTYPE;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        row := OLD;
+    ELSE
+        row := NEW;
+    END IF;
+
+    PERFORM pg_notify('users_changed', json_build_object(
+        'id', row.id,
+        'version', row.version,
+        'op', lower(TG_OP)
+    )::text);
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP POLICY IF EXISTS user_versions_tenant_isolation ON user_versions;
+ALTER TABLE user_versions NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE user_versions DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS users_tenant_isolation ON users;
+ALTER TABLE users NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE users DISABLE ROW LEVEL SECURITY;
+
+DROP INDEX IF EXISTS idx_users_tenant_id;
+DROP INDEX IF EXISTS idx_users_tenant_email_id;
+DROP INDEX IF EXISTS idx_users_tenant_name_id;
+DROP INDEX IF EXISTS idx_users_tenant_updated_at_id;
+DROP INDEX IF EXISTS idx_users_tenant_created_at_id;
+CREATE INDEX idx_users_created_at_id ON users(created_at, id);
+CREATE INDEX idx_users_updated_at_id ON users(updated_at, id);
+CREATE INDEX idx_users_name_id ON users(name, id);
+CREATE INDEX idx_users_email_id ON users(email, id);
+
+-- Fails if an email is used by active users of several tenants.
+DROP INDEX IF EXISTS users_active_email_key;
+CREATE UNIQUE INDEX users_active_email_key
+    ON users (lower(email))
+    WHERE deleted_at IS NULL;
+
+ALTER TABLE user_versions DROP COLUMN tenant_id;
+ALTER TABLE users DROP COLUMN tenant_id;
@@ -0,0 +1,71 @@
+-- Tenants share the users tables. Existing rows belong to the
+-- "default" tenant, which is also what single-tenant deployments use.
+ALTER TABLE users ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE users ALTER COLUMN tenant_id DROP DEFAULT;
+
+ALTER TABLE user_versions ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE user_versions ALTER COLUMN tenant_id DROP DEFAULT;
+
+UPDATE user_versions v
+SET tenant_id = u.tenant_id
+FROM users u
+WHERE u.id = v.user_id;
+
+-- Email is unique among the active users of a tenant.
+DROP INDEX IF EXISTS users_active_email_key;
+CREATE UNIQUE INDEX users_active_email_key
+    ON users (tenant_id, lower(email))
+    WHERE deleted_at IS NULL;
+
+-- Keyset pagination within a tenant.
+DROP INDEX IF EXISTS idx_users_created_at_id;
+DROP INDEX IF EXISTS idx_users_updated_at_id;
+DROP INDEX IF EXISTS idx_users_name_id;
+DROP INDEX IF EXISTS idx_users_email_id;
+CREATE INDEX idx_users_tenant_created_at_id ON users(tenant_id, created_at, id);
+CREATE INDEX idx_users_tenant_updated_at_id ON users(tenant_id, updated_at, id);
+CREATE INDEX idx_users_tenant_name_id ON users(tenant_id, name, id);
+CREATE INDEX idx_users_tenant_email_id ON users(tenant_id, email, id);
+CREATE INDEX idx_users_tenant_id ON users(tenant_id, id);
+
+-- Row-level security: a session only sees and writes the rows of the
+-- tenant in app.tenant_id. Maintenance jobs (purge) set app.all_tenants.
+-- FORCE applies the policies to the table owner as well; without a
+-- tenant setting nothing is visible.
+ALTER TABLE users ENABLE ROW LEVEL SECURITY;
+ALTER TABLE users FORCE ROW LEVEL SECURITY;
+CREATE POLICY users_tenant_isolation ON users
+    USING (tenant_id = current_setting('app.tenant_id', true)
+           OR current_setting('app.all_tenants', true) = 'on')
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true)
+                OR current_setting('app.all_tenants', true) = 'on');
+
+ALTER TABLE user_versions ENABLE ROW LEVEL SECURITY;
+ALTER TABLE user_versions FORCE ROW LEVEL SECURITY;
+CREATE POLICY user_versions_tenant_isolation ON user_versions
+    USING (tenant_id = current_setting('app.tenant_id', true)
+           OR current_setting('app.all_tenants', true) = 'on')
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true)
+                OR current_setting('app.all_tenants', true) = 'on');
+
+-- Change notifications carry the tenant.
+CREATE OR REPLACE FUNCTION notify_users_changed() RETURNS trigger AS $$
+DECLARE
+    row users%ROWTYPE;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        row := OLD;
+    ELSE
+        row := NEW;
+    END IF;
+
+    PERFORM pg_notify('users_changed', json_build_object(
+        'tenant_id', row.tenant_id,
+        'id', row.id,
+        'version', row.version,
+        'op', lower(TG_OP)
+    )::text);
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,23 @@
+-- Encrypted emails cannot be decrypted in SQL: this fails while any
+-- row has no plaintext email.
+DROP INDEX IF EXISTS idx_user_versions_email_key_id;
+DROP INDEX IF EXISTS idx_users_email_key_id;
+
+CREATE INDEX idx_users_tenant_email_id ON users(tenant_id, email, id);
+CREATE INDEX idx_users_email_trgm ON users USING gin (email gin_trgm_ops);
+
+DROP INDEX IF EXISTS users_active_email_key;
+CREATE UNIQUE INDEX users_active_email_key
+    ON users (tenant_id, lower(email))
+    WHERE deleted_at IS NULL;
+
+ALTER TABLE user_versions DROP CONSTRAINT IF EXISTS user_versions_email_present;
+ALTER TABLE user_versions ALTER COLUMN email SET NOT NULL;
+ALTER TABLE user_versions DROP COLUMN email_key_id;
+ALTER TABLE user_versions DROP COLUMN email_ciphertext;
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_present;
+ALTER TABLE users ALTER COLUMN email SET NOT NULL;
+ALTER TABLE users DROP COLUMN email_key_id;
+ALTER TABLE users DROP COLUMN email_hash;
+ALTER TABLE users DROP COLUMN email_ciphertext;
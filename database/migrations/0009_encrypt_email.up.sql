@@ -0,0 +1,35 @@
+-- Emails are envelope-encrypted by the application (internal/fieldcrypt).
+-- email_hash is the HMAC blind index used for lookups and uniqueness;
+-- email_key_id names the key that encrypted the row, so rotation can
+-- find what still needs re-encrypting.
+--
+-- Existing rows keep their plaintext email until the application
+-- encrypts them and clears it: `app migrate up` and startup with
+-- DB_AUTO_MIGRATE=true do so right after migrating, `app reencrypt`
+-- at any time. Until then the server refuses to start.
+ALTER TABLE users ADD COLUMN email_ciphertext BYTEA;
+ALTER TABLE users ADD COLUMN email_hash BYTEA;
+ALTER TABLE users ADD COLUMN email_key_id TEXT;
+ALTER TABLE users ALTER COLUMN email DROP NOT NULL;
+ALTER TABLE users ADD CONSTRAINT users_email_present
+    CHECK (email IS NOT NULL OR (email_ciphertext IS NOT NULL AND email_hash IS NOT NULL));
+
+ALTER TABLE user_versions ADD COLUMN email_ciphertext BYTEA;
+ALTER TABLE user_versions ADD COLUMN email_key_id TEXT;
+ALTER TABLE user_versions ALTER COLUMN email DROP NOT NULL;
+ALTER TABLE user_versions ADD CONSTRAINT user_versions_email_present
+    CHECK (email IS NOT NULL OR email_ciphertext IS NOT NULL);
+
+-- Email is unique among the active users of a tenant, by blind index.
+DROP INDEX IF EXISTS users_active_email_key;
+CREATE UNIQUE INDEX users_active_email_key
+    ON users (tenant_id, email_hash)
+    WHERE deleted_at IS NULL;
+
+-- Ciphertext can be neither searched nor sorted.
+DROP INDEX IF EXISTS idx_users_email_trgm;
+DROP INDEX IF EXISTS idx_users_tenant_email_id;
+
+-- Re-encryption looks up rows by key.
+CREATE INDEX idx_users_email_key_id ON users(email_key_id);
+CREATE INDEX idx_user_versions_email_key_id ON user_versions(email_key_id);
@@ -0,0 +1 @@
+-- The removed emails are not restored: the plaintext is gone.
@@ -0,0 +1,5 @@
+-- User events no longer carry the email, which users keeps encrypted.
+-- Remove the plaintext from the events already written.
+UPDATE outbox
+SET payload = payload - 'email'
+WHERE payload ? 'email';
@@ -0,0 +1,3 @@
+-- The relay leases the rows it claims instead of holding their locks
+-- while it publishes; a lease left by a crashed relay simply runs out.
+ALTER TABLE outbox ADD COLUMN locked_until TIMESTAMPTZ;
@@ -0,0 +1,3 @@
+-- The purge removes personal data from the events of the users it
+-- deletes, published or not.
+CREATE INDEX idx_outbox_aggregate_id ON outbox(aggregate_id);
@@ -0,0 +1,21 @@
+-- SQLite schema for SQLiteUserRepository, applied on startup.
+-- Timestamps are fixed-width RFC 3339 UTC text so they sort as strings.
+CREATE TABLE IF NOT EXISTS users (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    email TEXT NOT NULL,
+    version INTEGER NOT NULL DEFAULT 1,
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL,
+    deleted_at TEXT
+);
+
+-- Emails are unique among active users only.
+CREATE UNIQUE INDEX IF NOT EXISTS users_active_email_key
+    ON users(lower(email)) WHERE deleted_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users(deleted_at);
+CREATE INDEX IF NOT EXISTS idx_users_created_at_id ON users(created_at, id);
+CREATE INDEX IF NOT EXISTS idx_users_updated_at_id ON users(updated_at, id);
+CREATE INDEX IF NOT EXISTS idx_users_name_id ON users(name, id);
+CREATE INDEX IF NOT EXISTS idx_users_email_id ON users(email, id);
@@ -59,7 +59,7 @@ var emailRegex = regexp.MustCompile(
 // NewUser is used when creating new entity (business flow)
 func NewUser(name, email string, now time.Time) (*User, error) {
 	name = strings.TrimSpace(name)
-	email = normalizeEmail(email)
+	email = NormalizeEmail(email)
 
 	if err := validateName(name); err != nil {
 		return nil, err
@@ -115,6 +115,12 @@ func (u *User) Delete(now time.Time) error {
 	return nil
 }
 
+// Restore undoes a soft delete.
+//
+// Email uniqueness only applies to active users, so the email may have
+// been taken by someone else since the delete. The entity cannot know
+// that; persisting the restored user then fails with the repository's
+// ErrDuplicateEmail and the user stays deleted.
 func (u *User) Restore(now time.Time) error {
 	if u.deletedAt == nil {
 		return ErrUserNotDeleted
@@ -130,7 +136,7 @@ func (u *User) ChangeEmail(newEmail string, now time.Time) error {
 		return ErrUserAlreadyDeleted
 	}
 
-	newEmail = normalizeEmail(newEmail)
+	newEmail = NormalizeEmail(newEmail)
 
 	if !emailRegex.MatchString(newEmail) {
 		return ErrInvalidEmail
@@ -218,6 +224,7 @@ func validateName(name string) error {
 	return nil
 }
 
-func normalizeEmail(email string) string {
+// NormalizeEmail is the form emails are stored and compared in.
+func NormalizeEmail(email string) string {
 	return strings.ToLower(strings.TrimSpace(email))
 }
@@ -0,0 +1,152 @@
+// Package export writes users as CSV or NDJSON, one row at a time, for
+// GET /users/export and `app export`.
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"go-prod-app/internal/domain"
+)
+
+var ErrInvalidFormat = errors.New("invalid format, expected csv or ndjson")
+
+type Format string
+
+const (
+	CSV    Format = "csv"
+	NDJSON Format = "ndjson"
+)
+
+// ParseFormat parses "csv" or "ndjson"; "" is CSV.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case "":
+		return CSV, nil
+	case CSV, NDJSON:
+		return f, nil
+	default:
+		return "", ErrInvalidFormat
+	}
+}
+
+func (f Format) ContentType() string {
+	if f == NDJSON {
+		return "application/x-ndjson"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// columns is the CSV header row.
+var columns = []string{"id", "name", "email", "version", "created_at", "updated_at", "deleted_at"}
+
+// Writer encodes users to an io.Writer. Output is buffered until Flush.
+type Writer interface {
+	// WriteHeader writes the CSV header row; NDJSON has none. Skip it
+	// when appending to an earlier export.
+	WriteHeader() error
+	Write(u *domain.User) error
+	Flush() error
+}
+
+func NewWriter(w io.Writer, f Format) Writer {
+	if f == NDJSON {
+		buf := bufio.NewWriter(w)
+		return &ndjsonWriter{buf: buf, enc: json.NewEncoder(buf)}
+	}
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+//
+// =========================
+// CSV
+// =========================
+//
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvWriter) WriteHeader() error {
+	return c.w.Write(columns)
+}
+
+func (c *csvWriter) Write(u *domain.User) error {
+	deletedAt := ""
+	if u.DeletedAt() != nil {
+		deletedAt = formatTime(*u.DeletedAt())
+	}
+
+	return c.w.Write([]string{
+		string(u.ID()),
+		u.Name(),
+		u.Email(),
+		strconv.Itoa(u.Version()),
+		formatTime(u.CreatedAt()),
+		formatTime(u.UpdatedAt()),
+		deletedAt,
+	})
+}
+
+func (c *csvWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+//
+// =========================
+// NDJSON
+// =========================
+//
+
+// record is one NDJSON line; the fields match the API's user response.
+type record struct {
+	ID        string  `json:"id"`
+	Name      string  `json:"name"`
+	Email     string  `json:"email"`
+	Version   int     `json:"version"`
+	CreatedAt string  `json:"created_at"`
+	UpdatedAt string  `json:"updated_at"`
+	DeletedAt *string `json:"deleted_at,omitempty"`
+}
+
+type ndjsonWriter struct {
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+func (n *ndjsonWriter) WriteHeader() error {
+	return nil
+}
+
+func (n *ndjsonWriter) Write(u *domain.User) error {
+	var deletedAt *string
+	if u.DeletedAt() != nil {
+		s := formatTime(*u.DeletedAt())
+		deletedAt = &s
+	}
+
+	// Encode ends every value with a newline
+	return n.enc.Encode(record{
+		ID:        string(u.ID()),
+		Name:      u.Name(),
+		Email:     u.Email(),
+		Version:   u.Version(),
+		CreatedAt: formatTime(u.CreatedAt()),
+		UpdatedAt: formatTime(u.UpdatedAt()),
+		DeletedAt: deletedAt,
+	})
+}
+
+func (n *ndjsonWriter) Flush() error {
+	return n.buf.Flush()
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
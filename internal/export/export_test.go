@@ -0,0 +1,89 @@
+package export_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go-prod-app/internal/domain"
+	"go-prod-app/internal/export"
+)
+
+var (
+	created = time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	updated = time.Date(2024, 3, 2, 10, 0, 0, 0, time.FixedZone("CET", 3600))
+	deleted = time.Date(2024, 3, 3, 12, 0, 0, 0, time.UTC)
+)
+
+func users() []*domain.User {
+	return []*domain.User{
+		domain.RehydrateUser("0190b1a2-0000-7000-8000-000000000001", "Alice", "alice@example.com", 1, created, created, nil),
+		domain.RehydrateUser("0190b1a2-0000-7000-8000-000000000002", `Smith, "Bob"`, "bob@example.com", 3, created, updated, &deleted),
+		domain.RehydrateUser("0190b1a2-0000-7000-8000-000000000003", "Carol\nJones", "carol@example.com", 2, created, updated, nil),
+	}
+}
+
+func write(t *testing.T, f export.Format, header bool) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := export.NewWriter(&buf, f)
+
+	if header {
+		if err := w.WriteHeader(); err != nil {
+			t.Fatalf("WriteHeader: %v", err)
+		}
+	}
+	for _, u := range users() {
+		if err := w.Write(u); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	return buf.String()
+}
+
+func TestCSV(t *testing.T) {
+	want := "id,name,email,version,created_at,updated_at,deleted_at\n" +
+		"0190b1a2-0000-7000-8000-000000000001,Alice,alice@example.com,1,2024-03-01T09:30:00Z,2024-03-01T09:30:00Z,\n" +
+		"0190b1a2-0000-7000-8000-000000000002,\"Smith, \"\"Bob\"\"\",bob@example.com,3,2024-03-01T09:30:00Z,2024-03-02T09:00:00Z,2024-03-03T12:00:00Z\n" +
+		"0190b1a2-0000-7000-8000-000000000003,\"Carol\nJones\",carol@example.com,2,2024-03-01T09:30:00Z,2024-03-02T09:00:00Z,\n"
+
+	if got := write(t, export.CSV, true); got != want {
+		t.Errorf("CSV:\n%s\nwant:\n%s", got, want)
+	}
+
+	// a resumed export has no header row
+	if got := write(t, export.CSV, false); !strings.HasPrefix(got, "0190b1a2-") {
+		t.Errorf("CSV without header starts with %q", got[:20])
+	}
+}
+
+func TestNDJSON(t *testing.T) {
+	want := `{"id":"0190b1a2-0000-7000-8000-000000000001","name":"Alice","email":"alice@example.com","version":1,"created_at":"2024-03-01T09:30:00Z","updated_at":"2024-03-01T09:30:00Z"}` + "\n" +
+		`{"id":"0190b1a2-0000-7000-8000-000000000002","name":"Smith, \"Bob\"","email":"bob@example.com","version":3,"created_at":"2024-03-01T09:30:00Z","updated_at":"2024-03-02T09:00:00Z","deleted_at":"2024-03-03T12:00:00Z"}` + "\n" +
+		`{"id":"0190b1a2-0000-7000-8000-000000000003","name":"Carol\nJones","email":"carol@example.com","version":2,"created_at":"2024-03-01T09:30:00Z","updated_at":"2024-03-02T09:00:00Z"}` + "\n"
+
+	// NDJSON has no header, asked for or not
+	for _, header := range []bool{true, false} {
+		if got := write(t, export.NDJSON, header); got != want {
+			t.Errorf("NDJSON (header %v):\n%s\nwant:\n%s", header, got, want)
+		}
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for in, want := range map[string]export.Format{"": export.CSV, "csv": export.CSV, "ndjson": export.NDJSON} {
+		if f, err := export.ParseFormat(in); err != nil || f != want {
+			t.Errorf("ParseFormat(%q) = %q, %v, want %q", in, f, err, want)
+		}
+	}
+	if _, err := export.ParseFormat("json"); !errors.Is(err, export.ErrInvalidFormat) {
+		t.Errorf("ParseFormat(json): err = %v, want ErrInvalidFormat", err)
+	}
+}
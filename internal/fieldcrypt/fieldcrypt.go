@@ -0,0 +1,261 @@
+// Package fieldcrypt encrypts individual column values.
+//
+// Values are envelope-encrypted: each one gets a fresh data key, the
+// value is sealed with it (AES-256-GCM) and the data key is sealed with
+// a key-encryption key from the KeyRing. The envelope records the ID of
+// that key, so the ring can hold old keys for reading while new values
+// use the active one; rotating means re-encrypting values under the new
+// active key and then retiring the old one.
+//
+// Encrypted values cannot be compared in SQL, so equality lookups go
+// through a blind index: an HMAC of the value under a separate key.
+package fieldcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrUnknownKey      = errors.New("unknown encryption key")
+	ErrInvalidEnvelope = errors.New("invalid envelope")
+	ErrDecrypt         = errors.New("decryption failed")
+)
+
+const (
+	envelopeVersion = 1
+	// KeySize is the size of key-encryption keys and data keys (AES-256).
+	KeySize = 32
+	// MinIndexKeySize is the smallest accepted blind index key.
+	MinIndexKeySize = 32
+	maxKeyIDLen     = 64
+)
+
+// Key is a key-encryption key and the ID envelopes refer to it by.
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+// KeyRing encrypts with its active key and decrypts with any of its keys.
+type KeyRing struct {
+	active string
+	keys   map[string]cipher.AEAD
+	index  []byte
+}
+
+// NewKeyRing builds a ring from keys. active must be one of them; the
+// index key computes blind indexes and cannot be rotated without
+// recomputing every index.
+func NewKeyRing(keys []Key, active string, indexKey []byte) (*KeyRing, error) {
+	if len(indexKey) < MinIndexKeySize {
+		return nil, fmt.Errorf("index key must be at least %d bytes", MinIndexKeySize)
+	}
+
+	ring := &KeyRing{
+		active: active,
+		keys:   make(map[string]cipher.AEAD, len(keys)),
+		index:  append([]byte(nil), indexKey...),
+	}
+
+	for _, k := range keys {
+		if err := validKeyID(k.ID); err != nil {
+			return nil, err
+		}
+		if _, dup := ring.keys[k.ID]; dup {
+			return nil, fmt.Errorf("duplicate key id %q", k.ID)
+		}
+		if len(k.Secret) != KeySize {
+			return nil, fmt.Errorf("key %q must be %d bytes", k.ID, KeySize)
+		}
+
+		aead, err := newAEAD(k.Secret)
+		if err != nil {
+			return nil, err
+		}
+		ring.keys[k.ID] = aead
+	}
+
+	if _, ok := ring.keys[active]; !ok {
+		return nil, fmt.Errorf("%w: active key %q", ErrUnknownKey, active)
+	}
+
+	return ring, nil
+}
+
+// ParseKeys parses "id:base64,id:base64,...", the format of key lists
+// in configuration.
+func ParseKeys(s string) ([]Key, error) {
+	var keys []Key
+
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("key %q: want id:base64", entry)
+		}
+
+		secret, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+
+		keys = append(keys, Key{ID: id, Secret: secret})
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no keys")
+	}
+
+	return keys, nil
+}
+
+// ActiveKeyID is the key new envelopes are sealed with.
+func (r *KeyRing) ActiveKeyID() string {
+	return r.active
+}
+
+// Encrypt seals plaintext under a fresh data key wrapped by the active
+// key. aad is authenticated but not stored: Decrypt needs the same aad,
+// which binds the envelope to where it is stored.
+//
+// Layout: version | len(key id) | key id | wrapped data key | sealed value.
+// Both sealed parts are nonce || AES-GCM ciphertext.
+func (r *KeyRing) Encrypt(plaintext, aad []byte) ([]byte, error) {
+	dataKey := make([]byte, KeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+
+	data, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	header := append([]byte{envelopeVersion, byte(len(r.active))}, r.active...)
+
+	// The wrapped data key authenticates the header, so the key ID
+	// cannot be swapped. seal's dst must not overlap its aad.
+	out := seal(r.keys[r.active], append([]byte(nil), header...), dataKey, header)
+	return seal(data, out, plaintext, aad), nil
+}
+
+// Decrypt opens an envelope made by Encrypt with the same aad.
+func (r *KeyRing) Decrypt(envelope, aad []byte) ([]byte, error) {
+	keyID, rest, err := parseHeader(envelope)
+	if err != nil {
+		return nil, err
+	}
+
+	kek, ok := r.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, keyID)
+	}
+
+	header := envelope[:len(envelope)-len(rest)]
+
+	wrappedLen := kek.NonceSize() + KeySize + kek.Overhead()
+	if len(rest) < wrappedLen {
+		return nil, ErrInvalidEnvelope
+	}
+
+	dataKey, err := open(kek, rest[:wrappedLen], header)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return open(data, rest[wrappedLen:], aad)
+}
+
+// KeyID returns the ID of the key that sealed envelope.
+func KeyID(envelope []byte) (string, error) {
+	keyID, _, err := parseHeader(envelope)
+	return keyID, err
+}
+
+// BlindIndex is the HMAC-SHA256 of value under the index key. Equal
+// values give equal indexes, so callers normalize value first.
+func (r *KeyRing) BlindIndex(value string) []byte {
+	mac := hmac.New(sha256.New, r.index)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+//
+// =========================
+// Helpers
+// =========================
+//
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal appends nonce || ciphertext to dst.
+func seal(aead cipher.AEAD, dst, plaintext, aad []byte) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		// crypto/rand does not fail on supported platforms
+		panic(err)
+	}
+	dst = append(dst, nonce...)
+	return aead.Seal(dst, nonce, plaintext, aad)
+}
+
+func open(aead cipher.AEAD, sealed, aad []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrInvalidEnvelope
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+
+	plaintext, err := aead.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+// parseHeader splits envelope into its key ID and the sealed parts.
+func parseHeader(envelope []byte) (string, []byte, error) {
+	if len(envelope) < 2 || envelope[0] != envelopeVersion {
+		return "", nil, ErrInvalidEnvelope
+	}
+
+	n := int(envelope[1])
+	if len(envelope) < 2+n {
+		return "", nil, ErrInvalidEnvelope
+	}
+
+	return string(envelope[2 : 2+n]), envelope[2+n:], nil
+}
+
+func validKeyID(id string) error {
+	if id == "" || len(id) > maxKeyIDLen {
+		return fmt.Errorf("key id %q must be 1-%d characters", id, maxKeyIDLen)
+	}
+	if strings.ContainsAny(id, ":, \t") {
+		return fmt.Errorf("key id %q must not contain ':', ',' or spaces", id)
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package fieldcrypt_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"go-prod-app/internal/fieldcrypt"
+)
+
+var (
+	k1       = fieldcrypt.Key{ID: "k1", Secret: bytes.Repeat([]byte{1}, fieldcrypt.KeySize)}
+	k2       = fieldcrypt.Key{ID: "k2", Secret: bytes.Repeat([]byte{2}, fieldcrypt.KeySize)}
+	indexKey = bytes.Repeat([]byte{9}, fieldcrypt.MinIndexKeySize)
+)
+
+func newRing(t *testing.T, active string, keys ...fieldcrypt.Key) *fieldcrypt.KeyRing {
+	t.Helper()
+
+	ring, err := fieldcrypt.NewKeyRing(keys, active, indexKey)
+	if err != nil {
+		t.Fatalf("NewKeyRing: %v", err)
+	}
+	return ring
+}
+
+func TestRoundTrip(t *testing.T) {
+	ring := newRing(t, "k1", k1)
+
+	envelope, err := ring.Encrypt([]byte("alice@example.com"), []byte("user-1"))
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	if bytes.Contains(envelope, []byte("alice@example.com")) {
+		t.Fatal("envelope contains the plaintext")
+	}
+
+	got, err := ring.Decrypt(envelope, []byte("user-1"))
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if string(got) != "alice@example.com" {
+		t.Errorf("Decrypt = %q, want alice@example.com", got)
+	}
+
+	keyID, err := fieldcrypt.KeyID(envelope)
+	if err != nil || keyID != "k1" {
+		t.Errorf("KeyID = %q, %v, want k1", keyID, err)
+	}
+
+	// fresh data key and nonces every time
+	again, err := ring.Encrypt([]byte("alice@example.com"), []byte("user-1"))
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	if bytes.Equal(envelope, again) {
+		t.Error("two envelopes of the same value are equal")
+	}
+}
+
+func TestDecryptTampered(t *testing.T) {
+	ring := newRing(t, "k1", k1)
+
+	envelope, err := ring.Encrypt([]byte("alice@example.com"), []byte("user-1"))
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	for _, i := range []int{4, len(envelope) / 2, len(envelope) - 1} {
+		tampered := append([]byte(nil), envelope...)
+		tampered[i] ^= 0x01
+
+		if _, err := ring.Decrypt(tampered, []byte("user-1")); !errors.Is(err, fieldcrypt.ErrDecrypt) {
+			t.Errorf("byte %d flipped: err = %v, want ErrDecrypt", i, err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		envelope []byte
+	}{
+		{"empty", nil},
+		{"wrong version", append([]byte{99}, envelope[1:]...)},
+		{"truncated header", envelope[:3]},
+		{"truncated body", envelope[:len(envelope)-20]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ring.Decrypt(tt.envelope, []byte("user-1"))
+			if !errors.Is(err, fieldcrypt.ErrInvalidEnvelope) && !errors.Is(err, fieldcrypt.ErrDecrypt) {
+				t.Errorf("err = %v, want ErrInvalidEnvelope or ErrDecrypt", err)
+			}
+		})
+	}
+}
+
+func TestDecryptWrongAAD(t *testing.T) {
+	ring := newRing(t, "k1", k1)
+
+	envelope, err := ring.Encrypt([]byte("alice@example.com"), []byte("user-1"))
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	// an envelope copied to another user's row does not open
+	if _, err := ring.Decrypt(envelope, []byte("user-2")); !errors.Is(err, fieldcrypt.ErrDecrypt) {
+		t.Errorf("err = %v, want ErrDecrypt", err)
+	}
+}
+
+func TestDecryptUnknownKey(t *testing.T) {
+	envelope, err := newRing(t, "k1", k1).Encrypt([]byte("alice@example.com"), []byte("user-1"))
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	if _, err := newRing(t, "k2", k2).Decrypt(envelope, []byte("user-1")); !errors.Is(err, fieldcrypt.ErrUnknownKey) {
+		t.Errorf("err = %v, want ErrUnknownKey", err)
+	}
+
+	// a key ID swapped into the header is caught by the wrapped data key
+	swapped := append([]byte(nil), envelope...)
+	copy(swapped[2:4], "k2")
+	if _, err := newRing(t, "k1", k1, k2).Decrypt(swapped, []byte("user-1")); !errors.Is(err, fieldcrypt.ErrDecrypt) {
+		t.Errorf("swapped key ID: err = %v, want ErrDecrypt", err)
+	}
+}
+
+func TestRotation(t *testing.T) {
+	old := newRing(t, "k1", k1)
+
+	envelope, err := old.Encrypt([]byte("alice@example.com"), []byte("user-1"))
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	// k2 becomes active; k1 stays for reading until everything moved
+	rotated := newRing(t, "k2", k1, k2)
+
+	plaintext, err := rotated.Decrypt(envelope, []byte("user-1"))
+	if err != nil {
+		t.Fatalf("Decrypt with old key: %v", err)
+	}
+
+	reencrypted, err := rotated.Encrypt(plaintext, []byte("user-1"))
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	if keyID, _ := fieldcrypt.KeyID(reencrypted); keyID != "k2" {
+		t.Errorf("KeyID = %q, want k2", keyID)
+	}
+
+	// k1 retired
+	retired := newRing(t, "k2", k2)
+
+	got, err := retired.Decrypt(reencrypted, []byte("user-1"))
+	if err != nil {
+		t.Fatalf("Decrypt after retiring k1: %v", err)
+	}
+	if string(got) != "alice@example.com" {
+		t.Errorf("Decrypt = %q, want alice@example.com", got)
+	}
+	if _, err := retired.Decrypt(envelope, []byte("user-1")); !errors.Is(err, fieldcrypt.ErrUnknownKey) {
+		t.Errorf("old envelope after retiring k1: err = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestBlindIndex(t *testing.T) {
+	a := newRing(t, "k1", k1)
+	b := newRing(t, "k2", k1, k2)
+
+	// stable across calls and key rotation: it depends on the index key only
+	first := a.BlindIndex("alice@example.com")
+	if !bytes.Equal(first, a.BlindIndex("alice@example.com")) {
+		t.Error("BlindIndex differs between calls")
+	}
+	if !bytes.Equal(first, b.BlindIndex("alice@example.com")) {
+		t.Error("BlindIndex differs after rotating the encryption key")
+	}
+
+	if bytes.Equal(first, a.BlindIndex("bob@example.com")) {
+		t.Error("different values have the same BlindIndex")
+	}
+
+	other, err := fieldcrypt.NewKeyRing([]fieldcrypt.Key{k1}, "k1", bytes.Repeat([]byte{8}, fieldcrypt.MinIndexKeySize))
+	if err != nil {
+		t.Fatalf("NewKeyRing: %v", err)
+	}
+	if bytes.Equal(first, other.BlindIndex("alice@example.com")) {
+		t.Error("BlindIndex does not depend on the index key")
+	}
+}
+
+func TestNewKeyRingRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		keys   []fieldcrypt.Key
+		active string
+		index  []byte
+	}{
+		{"short index key", []fieldcrypt.Key{k1}, "k1", []byte("short")},
+		{"unknown active key", []fieldcrypt.Key{k1}, "k2", indexKey},
+		{"duplicate key id", []fieldcrypt.Key{k1, k1}, "k1", indexKey},
+		{"short key", []fieldcrypt.Key{{ID: "k1", Secret: []byte("short")}}, "k1", indexKey},
+		{"empty key id", []fieldcrypt.Key{{ID: "", Secret: k1.Secret}}, "", indexKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := fieldcrypt.NewKeyRing(tt.keys, tt.active, tt.index); err == nil {
+				t.Error("NewKeyRing succeeded")
+			}
+		})
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	keys, err := fieldcrypt.ParseKeys("k1:AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=, k2:AgICAgICAgICAgICAgICAgICAgICAgICAgICAgICAgI=")
+	if err != nil {
+		t.Fatalf("ParseKeys: %v", err)
+	}
+	if len(keys) != 2 || keys[0].ID != "k1" || !bytes.Equal(keys[1].Secret, k2.Secret) {
+		t.Errorf("ParseKeys = %+v", keys)
+	}
+
+	for _, s := range []string{"", "k1", "k1:not base64"} {
+		if _, err := fieldcrypt.ParseKeys(s); err == nil {
+			t.Errorf("ParseKeys(%q) succeeded", s)
+		}
+	}
+}
@@ -10,6 +10,17 @@ type UpdateUserRequest struct {
 	Email string `json:"email"`
 }
 
+// UpsertUserRequest is the body of PUT /users/by-email/{email}; the
+// email comes from the path.
+type UpsertUserRequest struct {
+	Name string `json:"name"`
+}
+
+// RestoreUserRequest is optional; Version enables the optimistic check.
+type RestoreUserRequest struct {
+	Version int `json:"version"`
+}
+
 type UserResponse struct {
 	ID        string  `json:"id"`
 	Name      string  `json:"name"`
@@ -19,3 +30,58 @@ type UserResponse struct {
 	UpdatedAt string  `json:"updated_at"`
 	DeletedAt *string `json:"deleted_at,omitempty"`
 }
+
+// UpsertUserResponse is the stored user plus what the upsert did:
+// "created", "updated" or "unchanged".
+type UpsertUserResponse struct {
+	UserResponse
+	Outcome string `json:"outcome"`
+}
+
+type FieldChangeResponse struct {
+	Field string  `json:"field"`
+	From  *string `json:"from"`
+	To    *string `json:"to"`
+}
+
+type UserVersionResponse struct {
+	Version   int                   `json:"version"`
+	Name      string                `json:"name"`
+	Email     string                `json:"email"`
+	DeletedAt *string               `json:"deleted_at,omitempty"`
+	ChangedBy string                `json:"changed_by,omitempty"`
+	ChangedAt string                `json:"changed_at"`
+	Changes   []FieldChangeResponse `json:"changes"`
+}
+
+type UserSuggestionResponse struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+type UserCountResponse struct {
+	Count int64 `json:"count"`
+	// Exact is false when count is an estimate from table statistics.
+	Exact bool `json:"exact"`
+}
+
+// ImportRowResponse is the outcome of one input row: "created",
+// "duplicate" or "invalid", with the reason for the last two.
+type ImportRowResponse struct {
+	Row    int    `json:"row"`
+	Status string `json:"status"`
+	ID     string `json:"id,omitempty"`
+	Email  string `json:"email,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type ImportReportResponse struct {
+	DryRun bool `json:"dry_run"`
+	// Applied is false after a dry run or an abort: nothing was written.
+	Applied   bool                `json:"applied"`
+	Created   int                 `json:"created"`
+	Duplicate int                 `json:"duplicate"`
+	Invalid   int                 `json:"invalid"`
+	Rows      []ImportRowResponse `json:"rows"`
+}
@@ -1,13 +1,20 @@
 package http
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"go-prod-app/internal/domain"
+	"go-prod-app/internal/export"
+	"go-prod-app/internal/importer"
 	"go-prod-app/internal/repository"
 	"go-prod-app/internal/service"
 
@@ -56,17 +63,39 @@ func (h *Handler) users(w http.ResponseWriter, r *http.Request) {
 			cursor = &decoded
 		}
 
-		// email filter (*string)
-		var emailPtr *string
-		if e := q.Get("email"); e != "" {
-			emailPtr = &e
+		// page: first | last shortcut instead of a cursor
+		switch q.Get("page") {
+		case "":
+		case "first", "last":
+			if cursor != nil {
+				writeError(w, http.StatusBadRequest, "page and cursor are mutually exclusive")
+				return
+			}
+			cursor = repository.FirstPage()
+			if q.Get("page") == "last" {
+				cursor = repository.LastPage()
+			}
+		default:
+			writeError(w, http.StatusBadRequest, "invalid page, expected first or last")
+			return
 		}
 
-		filter := repository.UserFilter{
-			Email: emailPtr,
+		filter, msg := parseUserFilter(q)
+		if msg != "" {
+			writeError(w, http.StatusBadRequest, msg)
+			return
 		}
 
-		users, nextCursor, err := h.userService.ListUsers(
+		// sort: field or -field (descending)
+		sort, err := repository.ParseUserSort(q.Get("sort"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest,
+				"invalid sort, expected [-]id, created_at, updated_at, name or relevance")
+			return
+		}
+		filter.Sort = sort
+
+		page, err := h.userService.ListUsers(
 			r.Context(),
 			filter,
 			cursor,
@@ -78,18 +107,21 @@ func (h *Handler) users(w http.ResponseWriter, r *http.Request) {
 		}
 
 		var resp []UserResponse
-		for _, u := range users {
+		for _, u := range page.Users {
 			resp = append(resp, toUserResponse(u))
 		}
 
 		response := map[string]any{
-			"data": resp,
+			"data":     resp,
+			"has_more": page.HasMore,
 		}
 
-		// encode next cursor back to base64 JSON
-		if nextCursor != nil {
-			b, _ := json.Marshal(nextCursor)
-			response["next_cursor"] = base64.StdEncoding.EncodeToString(b)
+		// encode cursors back to base64 JSON
+		if page.Next != nil {
+			response["next_cursor"] = encodeCursor(page.Next)
+		}
+		if page.Prev != nil {
+			response["prev_cursor"] = encodeCursor(page.Prev)
 		}
 
 		writeJSON(w, http.StatusOK, response)
@@ -115,9 +147,301 @@ func (h *Handler) users(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (h *Handler) userByID(w http.ResponseWriter, r *http.Request) {
+// parseUserFilter reads the filter parameters shared by listing and
+// counting. It returns a message for a bad request.
+func parseUserFilter(q url.Values) (repository.UserFilter, string) {
+	var filter repository.UserFilter
+
+	// email filter (*string)
+	if e := q.Get("email"); e != "" {
+		filter.Email = &e
+	}
+
+	// fuzzy search on name / email
+	if s := strings.TrimSpace(q.Get("q")); s != "" {
+		filter.Query = &s
+	}
+
+	// deleted: exclude (default) | include | only
+	switch q.Get("deleted") {
+	case "", "exclude":
+	case "include":
+		filter.IncludeDeleted = true
+	case "only":
+		filter.OnlyDeleted = true
+	default:
+		return filter, "invalid deleted, expected exclude, include or only"
+	}
+
+	return filter, ""
+}
+
+func (h *Handler) countUsers(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	q := r.URL.Query()
+
+	filter, msg := parseUserFilter(q)
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	// mode: auto (default) | exact | estimated
+	mode, err := service.ParseCountMode(q.Get("mode"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid mode, expected auto, exact or estimated")
+		return
+	}
+
+	count, err := h.userService.CountUsers(r.Context(), filter, mode)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, UserCountResponse{
+		Count: count.Count,
+		Exact: count.Exact,
+	})
+}
+
+func (h *Handler) suggestUsers(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	q := r.URL.Query()
+
+	limit := 5
+	if l := q.Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 {
+			limit = parsed
+		}
+	}
+
+	users, err := h.userService.SuggestUsers(r.Context(), q.Get("q"), limit)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	resp := []UserSuggestionResponse{}
+	for _, u := range users {
+		resp = append(resp, UserSuggestionResponse{
+			ID:    string(u.ID()),
+			Name:  u.Name(),
+			Email: u.Email(),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"data": resp,
+	})
+}
+
+// exportFlushEvery is how many users an export writes between flushes
+// to the client.
+const exportFlushEvery = 500
+
+// exportIdleTimeout is how long an export waits for the client to take
+// a flushed chunk before giving up on it.
+const exportIdleTimeout = time.Minute
+
+// exportUsers streams every user matching the filter as CSV or NDJSON
+// in ID order. after=<id> resumes after the last user received; the CSV
+// header is only sent without it. It runs without a time budget: the
+// export ends when the users do, or the client leaves or stops reading
+// for exportIdleTimeout.
+func (h *Handler) exportUsers(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	q := r.URL.Query()
+
+	format, err := export.ParseFormat(q.Get("format"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	after := q.Get("after")
+	if after != "" {
+		if _, err := uuid.Parse(after); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid after, expected a user id")
+			return
+		}
+	}
+
+	filter, msg := parseUserFilter(q)
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	// The server's WriteTimeout would cut a long export off; the
+	// deadline moves forward with every chunk instead
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Now().Add(exportIdleTimeout))
+
+	out := export.NewWriter(w, format)
+	written := 0
+
+	// The status is sent with the first user, so errors before it
+	// still get a proper response
+	start := func() error {
+		w.Header().Set("Content-Type", format.ContentType())
+		w.Header().Set("Content-Disposition", `attachment; filename="users.`+string(format)+`"`)
+		w.WriteHeader(http.StatusOK)
+		if after == "" {
+			return out.WriteHeader()
+		}
+		return nil
+	}
+
+	flush := func() error {
+		_ = rc.SetWriteDeadline(time.Now().Add(exportIdleTimeout))
+		if err := out.Flush(); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	err = h.userService.ExportUsers(r.Context(), filter, domain.UserID(after), func(u *domain.User) error {
+		if written == 0 {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		if err := out.Write(u); err != nil {
+			return err
+		}
+		written++
+		if written%exportFlushEvery == 0 {
+			return flush()
+		}
+		return nil
+	})
+
+	if err != nil {
+		if written == 0 {
+			handleServiceError(w, err)
+			return
+		}
+		// Too late for an error status: break the response off so the
+		// client cannot mistake it for a complete export
+		panic(http.ErrAbortHandler)
+	}
+
+	if written == 0 {
+		if err := start(); err != nil {
+			panic(http.ErrAbortHandler)
+		}
+	}
+	if err := flush(); err != nil {
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// importMaxBytes bounds the body of an import.
+const importMaxBytes = 64 << 20
+
+// importUsers creates users in bulk from a CSV, NDJSON or
+// identity-provider JSON body, picked by format or the Content-Type,
+// and answers with a report on every row. dry_run=true only reports;
+// on_error=abort writes nothing unless every row can be created (422
+// otherwise), on_error=skip (default) leaves the failing rows out.
+func (h *Handler) importUsers(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	q := r.URL.Query()
+
+	var (
+		format importer.Format
+		err    error
+	)
+	if f := q.Get("format"); f != "" {
+		format, err = importer.ParseFormat(f)
+	} else {
+		format, err = importer.FormatFromContentType(r.Header.Get("Content-Type"))
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var opts service.ImportOptions
+
+	if d := q.Get("dry_run"); d != "" {
+		opts.DryRun, err = strconv.ParseBool(d)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid dry_run, expected true or false")
+			return
+		}
+	}
+
+	switch q.Get("on_error") {
+	case "", "skip":
+	case "abort":
+		opts.AbortOnError = true
+	default:
+		writeError(w, http.StatusBadRequest, "invalid on_error, expected skip or abort")
+		return
+	}
+
+	// The server's read and write timeouts are too short for a large
+	// upload; the route's budget bounds it instead
+	if deadline, ok := r.Context().Deadline(); ok {
+		rc := http.NewResponseController(w)
+		_ = rc.SetReadDeadline(deadline)
+		_ = rc.SetWriteDeadline(deadline)
+	}
 
-	id := r.URL.Path[len("/users/"):]
+	var records []importer.Record
+
+	body := http.MaxBytesReader(w, r.Body, importMaxBytes)
+	err = importer.Read(body, format, func(rec importer.Record) error {
+		records = append(records, rec)
+		return nil
+	})
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, "import exceeds 64 MiB, use `app import`")
+			return
+		}
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	report, err := h.userService.ImportUsers(r.Context(), records, opts)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	status := http.StatusOK
+	if !report.Applied && !opts.DryRun {
+		status = http.StatusUnprocessableEntity
+	}
+
+	writeJSON(w, status, toImportReportResponse(report, opts.DryRun))
+}
+
+func (h *Handler) userByID(w http.ResponseWriter, r *http.Request, id string) {
 
 	if _, err := uuid.Parse(id); err != nil {
 		writeError(w, http.StatusBadRequest, "invalid id format")
@@ -128,6 +452,24 @@ func (h *Handler) userByID(w http.ResponseWriter, r *http.Request) {
 
 	case http.MethodGet:
 
+		// as_of → point-in-time read from history
+		if a := r.URL.Query().Get("as_of"); a != "" {
+			asOf, err := time.Parse(time.RFC3339, a)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "invalid as_of, expected RFC3339")
+				return
+			}
+
+			user, err := h.userService.GetUserAsOf(r.Context(), domain.UserID(id), asOf)
+			if err != nil {
+				handleServiceError(w, err)
+				return
+			}
+
+			writeJSON(w, http.StatusOK, toUserResponse(user))
+			return
+		}
+
 		user, err := h.userService.GetUser(r.Context(), domain.UserID(id))
 		if err != nil {
 			handleServiceError(w, err)
@@ -174,6 +516,121 @@ func (h *Handler) userByID(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// upsertUserByEmail creates the user with email or renames the active
+// one; repeating the same request is a no-op.
+func (h *Handler) upsertUserByEmail(w http.ResponseWriter, r *http.Request, email string) {
+
+	if r.Method != http.MethodPut {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req UpsertUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	user, outcome, err := h.userService.UpsertUserByEmail(r.Context(), email, req.Name)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	status := http.StatusOK
+	if outcome == repository.UpsertCreated {
+		status = http.StatusCreated
+	}
+
+	writeJSON(w, status, UpsertUserResponse{
+		UserResponse: toUserResponse(user),
+		Outcome:      string(outcome),
+	})
+}
+
+func (h *Handler) restoreUser(w http.ResponseWriter, r *http.Request, id string) {
+
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	if _, err := uuid.Parse(id); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid id format")
+		return
+	}
+
+	// body is optional
+	var req RestoreUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	user, err := h.userService.RestoreUser(r.Context(), domain.UserID(id), req.Version)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toUserResponse(user))
+}
+
+func (h *Handler) userHistory(w http.ResponseWriter, r *http.Request, id string) {
+
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	if _, err := uuid.Parse(id); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid id format")
+		return
+	}
+
+	q := r.URL.Query()
+
+	// limit
+	limit := 20
+	if l := q.Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 {
+			limit = parsed
+		}
+	}
+
+	// before (version keyset, from next_before)
+	before := 0
+	if b := q.Get("before"); b != "" {
+		parsed, err := strconv.Atoi(b)
+		if err != nil || parsed <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid before")
+			return
+		}
+		before = parsed
+	}
+
+	page, err := h.userService.GetUserHistory(r.Context(), domain.UserID(id), before, limit)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	resp := []UserVersionResponse{}
+	for _, e := range page.Entries {
+		resp = append(resp, toUserVersionResponse(e))
+	}
+
+	response := map[string]any{
+		"data": resp,
+	}
+
+	if page.NextBefore > 0 {
+		response["next_before"] = page.NextBefore
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
 func (h *Handler) health(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{
 		"status": "ok",
@@ -185,6 +642,17 @@ func (h *Handler) ready(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusServiceUnavailable, "not ready")
 		return
 	}
+
+	// Still serving, so stay in rotation: pulling a slow instance
+	// would push its load onto the others.
+	if h.userService.Degraded() {
+		writeJSON(w, http.StatusOK, map[string]string{
+			"status": "degraded",
+			"reason": "database connection pool saturated",
+		})
+		return
+	}
+
 	writeJSON(w, http.StatusOK, map[string]string{
 		"status": "ready",
 	})
@@ -196,8 +664,14 @@ func handleServiceError(w http.ResponseWriter, err error) {
 	case errors.Is(err, service.ErrInvalidInput):
 		writeError(w, http.StatusBadRequest, err.Error())
 
+	case errors.Is(err, service.ErrInvalidCursor):
+		writeError(w, http.StatusBadRequest, err.Error())
+
+	case errors.Is(err, service.ErrInvalidSort):
+		writeError(w, http.StatusBadRequest, err.Error())
+
 	case errors.Is(err, service.ErrDuplicateEmail):
-		writeError(w, http.StatusConflict, err.Error())
+		writeError(w, http.StatusConflict, "email is already used by an active user")
 
 	case errors.Is(err, service.ErrUserNotFound):
 		writeError(w, http.StatusNotFound, err.Error())
@@ -205,6 +679,24 @@ func handleServiceError(w http.ResponseWriter, err error) {
 	case errors.Is(err, service.ErrConflict):
 		writeError(w, http.StatusConflict, err.Error())
 
+	case errors.Is(err, service.ErrNotDeleted):
+		writeError(w, http.StatusConflict, err.Error())
+
+	case errors.Is(err, service.ErrEmailTaken):
+		writeError(w, http.StatusConflict, err.Error())
+
+	case errors.Is(err, service.ErrNotSupported),
+		errors.Is(err, service.ErrTenantNotSupported):
+		writeError(w, http.StatusNotImplemented, err.Error())
+
+	case errors.Is(err, service.ErrTimeout),
+		errors.Is(err, context.DeadlineExceeded):
+		writeError(w, http.StatusGatewayTimeout, "request exceeded its time budget")
+
+	case errors.Is(err, service.ErrUnavailable):
+		w.Header().Set("Retry-After", "1")
+		writeError(w, http.StatusServiceUnavailable, "database temporarily unavailable")
+
 	default:
 		writeError(w, http.StatusInternalServerError, "internal server error")
 	}
@@ -221,3 +713,9 @@ func writeJSON(w http.ResponseWriter, status int, v any) {
 	w.WriteHeader(status)
 	_ = json.NewEncoder(w).Encode(v)
 }
+
+// encodeCursor renders a cursor as opaque base64 JSON.
+func encodeCursor(c *repository.Cursor) string {
+	b, _ := json.Marshal(c)
+	return base64.StdEncoding.EncodeToString(b)
+}
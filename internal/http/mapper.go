@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"go-prod-app/internal/domain"
+	"go-prod-app/internal/service"
 )
 
 func toUserResponse(u *domain.User) UserResponse {
@@ -23,3 +24,57 @@ func toUserResponse(u *domain.User) UserResponse {
 		DeletedAt: deletedAt,
 	}
 }
+
+func toUserVersionResponse(e service.UserHistoryEntry) UserVersionResponse {
+	u := e.Version.User
+
+	var deletedAt *string
+	if u.DeletedAt() != nil {
+		s := u.DeletedAt().Format(time.RFC3339)
+		deletedAt = &s
+	}
+
+	changes := make([]FieldChangeResponse, 0, len(e.Changes))
+	for _, c := range e.Changes {
+		changes = append(changes, FieldChangeResponse{
+			Field: c.Field,
+			From:  c.From,
+			To:    c.To,
+		})
+	}
+
+	return UserVersionResponse{
+		Version:   u.Version(),
+		Name:      u.Name(),
+		Email:     u.Email(),
+		DeletedAt: deletedAt,
+		ChangedBy: e.Version.ChangedBy,
+		ChangedAt: e.Version.ChangedAt.Format(time.RFC3339),
+		Changes:   changes,
+	}
+}
+
+func toImportReportResponse(report *service.ImportReport, dryRun bool) ImportReportResponse {
+	rows := make([]ImportRowResponse, 0, len(report.Rows))
+	for _, row := range report.Rows {
+		resp := ImportRowResponse{
+			Row:    row.Row,
+			Status: string(row.Status),
+			Email:  row.Email,
+			Reason: row.Reason,
+		}
+		if row.User != nil {
+			resp.ID = string(row.User.ID())
+		}
+		rows = append(rows, resp)
+	}
+
+	return ImportReportResponse{
+		DryRun:    dryRun,
+		Applied:   report.Applied,
+		Created:   report.Created,
+		Duplicate: report.Duplicate,
+		Invalid:   report.Invalid,
+		Rows:      rows,
+	}
+}
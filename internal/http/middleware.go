@@ -2,11 +2,15 @@ package http
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"regexp"
+	"slices"
 	"time"
 
 	"go-prod-app/internal/metrics"
+	"go-prod-app/internal/repository"
 
 	"github.com/google/uuid"
 )
@@ -33,9 +37,152 @@ func RequestIDMiddleware(logger *slog.Logger) func(http.Handler) http.Handler {
 	}
 }
 
-func TimeoutMiddleware(timeout time.Duration) func(http.Handler) http.Handler {
+// ActorMiddleware records the X-Actor header as the actor of any change
+// made by the request. It is stored with each user version.
+func ActorMiddleware() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
-		return http.TimeoutHandler(next, timeout, `{"error":"request timeout"}`)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if actor := r.Header.Get("X-Actor"); actor != "" {
+				r = r.WithContext(repository.WithActor(r.Context(), actor))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// TenantResolver returns the tenant a request acts for, "" for the
+// default tenant, or an error for a request that must be rejected.
+type TenantResolver func(r *http.Request) (string, error)
+
+var tenantIDRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// TenantFromHeader resolves the tenant from header. When required, a
+// request without it is rejected instead of using the default tenant.
+func TenantFromHeader(header string, required bool) TenantResolver {
+	return func(r *http.Request) (string, error) {
+		tenant := r.Header.Get(header)
+		if tenant == "" {
+			if required {
+				return "", fmt.Errorf("missing %s header", header)
+			}
+			return "", nil
+		}
+		if !tenantIDRegex.MatchString(tenant) {
+			return "", fmt.Errorf("invalid %s header", header)
+		}
+		return tenant, nil
+	}
+}
+
+// TenantMiddleware scopes everything the request does to the tenant
+// from resolve (see repository.WithTenant).
+func TenantMiddleware(resolve TenantResolver) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tenant, err := resolve(r)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			if tenant != "" {
+				r = r.WithContext(repository.WithTenant(r.Context(), tenant))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// consistencyTokenHeader carries read-your-writes between requests:
+// responses to writes set it, and a request sending it back reads data
+// at least that recent.
+const consistencyTokenHeader = "X-Consistency-Token"
+
+// ConsistencyMiddleware carries read-your-writes hints to the
+// repository: the X-Consistency-Token of an earlier write keeps the
+// request's reads off replicas that have not replayed it, and
+// "X-Consistency: strong" sends every read of the request to the
+// primary. Responses to writes get a new token.
+func ConsistencyMiddleware(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := repository.WithWriteTracking(r.Context())
+			if token := r.Header.Get(consistencyTokenHeader); token != "" {
+				var err error
+				ctx, err = repository.WithReadAfter(ctx, token)
+				if err != nil {
+					writeError(w, http.StatusBadRequest, err.Error())
+					return
+				}
+			}
+			if r.Header.Get("X-Consistency") == "strong" {
+				ctx = repository.WithPrimaryReads(ctx)
+			}
+			next.ServeHTTP(&consistencyWriter{ResponseWriter: w, ctx: ctx, logger: logger}, r.WithContext(ctx))
+		})
+	}
+}
+
+// consistencyWriter sets the token of the request's writes when the
+// response header is sent, which handlers only do after committing.
+type consistencyWriter struct {
+	http.ResponseWriter
+	ctx         context.Context
+	logger      *slog.Logger
+	wroteHeader bool
+}
+
+func (w *consistencyWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+
+		token, err := repository.ConsistencyToken(w.ctx)
+		if err != nil {
+			w.logger.Warn("failed to get consistency token", "error", err)
+		}
+		if token != "" {
+			w.Header().Set(consistencyTokenHeader, token)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *consistencyWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *consistencyWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Budget bounds the time next may take. The deadline travels with the
+// request context through the service into the repository, where it
+// also becomes the statement timeout of the route's queries.
+func Budget(d time.Duration, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// TimeoutMiddleware cuts requests off after timeout. The exempt paths
+// bypass it: exports stream, which http.TimeoutHandler would buffer,
+// and imports have a longer budget of their own.
+func TimeoutMiddleware(timeout time.Duration, exempt ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		limited := http.TimeoutHandler(next, timeout, `{"error":"request timeout"}`)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if slices.Contains(exempt, r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			limited.ServeHTTP(w, r)
+		})
 	}
 }
 
@@ -45,6 +192,10 @@ func RecoveryMiddleware(logger *slog.Logger) func(http.Handler) http.Handler {
 
 			defer func() {
 				if rec := recover(); rec != nil {
+					// deliberate abort of a response already under way
+					if rec == http.ErrAbortHandler {
+						panic(rec)
+					}
 					logger.Error("panic recovered", "error", rec)
 					writeError(w, http.StatusInternalServerError, "internal server error")
 				}
@@ -2,31 +2,78 @@ package http
 
 import (
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-func RegisterRoutes(mux *http.ServeMux, h *Handler) {
+// Time budgets per route, within the 10s TimeoutMiddleware (imports are
+// exempt from it). A route that runs out answers 504.
+const (
+	userBudget    = 5 * time.Second
+	suggestBudget = time.Second
+	countBudget   = 3 * time.Second
+	importBudget  = 2 * time.Minute
+)
+
+// exportPath streams and has no time limit at all; importPath is only
+// bounded by its budget.
+const (
+	exportPath = "/users/export"
+	importPath = "/users/import"
+)
+
+// RegisterRoutes mounts the API on mux. User routes act for the tenant
+// from tenants; health and metrics are tenant-less.
+func RegisterRoutes(mux *http.ServeMux, h *Handler, tenants TenantResolver) {
+
+	scoped := TenantMiddleware(tenants)
 
 	// ===== USER ROUTES =====
 
 	// Exact match: /users
-	mux.HandleFunc("/users", func(w http.ResponseWriter, r *http.Request) {
+	mux.Handle("/users", scoped(Budget(userBudget, func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/users" {
 			http.NotFound(w, r)
 			return
 		}
 		h.users(w, r)
-	})
+	})))
+
+	// Exact matches: /users/suggest, /users/count, /users/export,
+	// /users/import (longer pattern wins over /users/)
+	mux.Handle("/users/suggest", scoped(Budget(suggestBudget, h.suggestUsers)))
+	mux.Handle("/users/count", scoped(Budget(countBudget, h.countUsers)))
+	mux.Handle(exportPath, scoped(http.HandlerFunc(h.exportUsers)))
+	mux.Handle(importPath, scoped(Budget(importBudget, h.importUsers)))
 
-	// Prefix match: /users/{id}
-	mux.HandleFunc("/users/", func(w http.ResponseWriter, r *http.Request) {
+	// Prefix match: /users/{id}, /users/{id}/{sub} and /users/by-email/{email}
+	mux.Handle("/users/", scoped(Budget(userBudget, func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path == "/users/" {
 			http.NotFound(w, r)
 			return
 		}
-		h.userByID(w, r)
-	})
+
+		id, sub, hasSub := strings.Cut(r.URL.Path[len("/users/"):], "/")
+		if id == "by-email" && hasSub {
+			h.upsertUserByEmail(w, r, sub)
+			return
+		}
+		if !hasSub {
+			h.userByID(w, r, id)
+			return
+		}
+
+		switch sub {
+		case "history":
+			h.userHistory(w, r, id)
+		case "restore":
+			h.restoreUser(w, r, id)
+		default:
+			http.NotFound(w, r)
+		}
+	})))
 
 	// ===== HEALTH =====
 	mux.HandleFunc("/health", h.health)
@@ -10,19 +10,22 @@ import (
 
 func StartServer(
 	userService *service.UserService,
+	tenants TenantResolver,
 	logger *slog.Logger,
 ) *http.Server {
 
 	mux := http.NewServeMux()
 
 	handler := NewHandler(userService)
-	RegisterRoutes(mux, handler)
+	RegisterRoutes(mux, handler, tenants)
 
 	var h http.Handler = mux
+	h = ActorMiddleware()(h)
+	h = ConsistencyMiddleware(logger)(h)
 	h = MetricsMiddleware()(h)
 	h = RecoveryMiddleware(logger)(h)
 	h = RequestIDMiddleware(logger)(h)
-	h = TimeoutMiddleware(10 * time.Second)(h)
+	h = TimeoutMiddleware(10*time.Second, exportPath, importPath)(h)
 
 	server := &http.Server{
 		Addr:         ":8080",
@@ -0,0 +1,389 @@
+// Package importer reads the users of a bulk import from CSV, NDJSON or
+// the JSON exports of common identity providers, one row at a time, for
+// POST /users/import and `app import`.
+package importer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	ErrInvalidFormat = errors.New("invalid format, expected csv, ndjson or json")
+	ErrMissingColumn = errors.New("csv header needs an email column and a name or first/last name columns")
+)
+
+type Format string
+
+const (
+	CSV    Format = "csv"
+	NDJSON Format = "ndjson"
+	// JSON is a whole-document identity-provider export (see idpUser).
+	JSON Format = "json"
+)
+
+// ParseFormat parses "csv", "ndjson" or "json".
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case CSV, NDJSON, JSON:
+		return f, nil
+	default:
+		return "", ErrInvalidFormat
+	}
+}
+
+// FormatFromContentType maps a request's Content-Type to its format.
+func FormatFromContentType(contentType string) (Format, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	switch mediaType {
+	case "text/csv":
+		return CSV, nil
+	case "application/x-ndjson", "application/jsonl":
+		return NDJSON, nil
+	case "application/json":
+		return JSON, nil
+	default:
+		return "", ErrInvalidFormat
+	}
+}
+
+// FormatFromPath maps a file extension to its format.
+func FormatFromPath(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return CSV, nil
+	case ".ndjson", ".jsonl":
+		return NDJSON, nil
+	case ".json":
+		return JSON, nil
+	default:
+		return "", ErrInvalidFormat
+	}
+}
+
+// Record is one user of the input.
+type Record struct {
+	// Row is the 1-based position of the user in the input, not
+	// counting the CSV header.
+	Row   int
+	Name  string
+	Email string
+	// Err is set when the row could not be read at all.
+	Err error
+}
+
+// Read calls fn for every row of r, in order. A row that cannot be read
+// is passed on with Err set; input that cannot be read past (a missing
+// CSV column, broken JSON) fails the whole read. It stops at the first
+// error from fn and returns it.
+func Read(r io.Reader, f Format, fn func(Record) error) error {
+	switch f {
+	case CSV:
+		return readCSV(r, fn)
+	case NDJSON:
+		return readNDJSON(r, fn)
+	case JSON:
+		return readJSON(r, fn)
+	default:
+		return ErrInvalidFormat
+	}
+}
+
+//
+// =========================
+// CSV
+// =========================
+// Columns are found by header, so exports of this API and of most
+// identity providers import as they are
+//
+
+// csvColumns maps normalized header names (lowercase, no separators) to
+// the field they hold.
+var csvColumns = map[string]string{
+	"name":         "name",
+	"displayname":  "name",
+	"fullname":     "name",
+	"firstname":    "first",
+	"givenname":    "first",
+	"lastname":     "last",
+	"familyname":   "last",
+	"surname":      "last",
+	"email":        "email",
+	"mail":         "email",
+	"emailaddress": "email",
+	"primaryemail": "email",
+}
+
+func readCSV(r io.Reader, fn func(Record) error) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return ErrMissingColumn
+		}
+		return err
+	}
+
+	columns := map[string]int{}
+	for i, h := range header {
+		h = strings.TrimPrefix(h, "\ufeff") // spreadsheet byte order mark
+		h = strings.NewReplacer("_", "", "-", "", " ", "").Replace(strings.ToLower(h))
+		if field, ok := csvColumns[h]; ok {
+			if _, seen := columns[field]; !seen {
+				columns[field] = i
+			}
+		}
+	}
+
+	_, hasName := columns["name"]
+	_, hasFirst := columns["first"]
+	if _, ok := columns["email"]; !ok || (!hasName && !hasFirst) {
+		return ErrMissingColumn
+	}
+
+	cell := func(fields []string, field string) string {
+		i, ok := columns[field]
+		if !ok || i >= len(fields) {
+			return ""
+		}
+		return fields[i]
+	}
+
+	for row := 1; ; row++ {
+		fields, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		rec := Record{Row: row}
+
+		var parseErr *csv.ParseError
+		switch {
+		case errors.As(err, &parseErr):
+			rec.Err = parseErr.Err
+		case err != nil:
+			return err
+		default:
+			rec.Name = cell(fields, "name")
+			if rec.Name == "" {
+				rec.Name = joinName(cell(fields, "first"), cell(fields, "last"))
+			}
+			rec.Email = cell(fields, "email")
+		}
+
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+}
+
+//
+// =========================
+// NDJSON
+// =========================
+// One user object per line, shaped as in an identity-provider export
+//
+
+// maxLine bounds an NDJSON line.
+const maxLine = 1 << 20
+
+func readNDJSON(r io.Reader, fn func(Record) error) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), maxLine)
+
+	row := 0
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+
+		row++
+		if err := fn(decodeUser(row, []byte(line))); err != nil {
+			return err
+		}
+	}
+
+	return sc.Err()
+}
+
+//
+// =========================
+// Identity-Provider JSON
+// =========================
+// An array of users, or an object holding one under "users" (Google
+// Workspace), "value" (Microsoft Graph) or "Resources" (SCIM)
+//
+
+var userArrayKeys = map[string]bool{
+	"users":     true,
+	"value":     true,
+	"Resources": true,
+}
+
+func readJSON(r io.Reader, fn func(Record) error) error {
+	dec := json.NewDecoder(r)
+
+	tok, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("read json: %w", err)
+	}
+
+	if tok == json.Delim('{') {
+		if err := seekUserArray(dec); err != nil {
+			return err
+		}
+	} else if tok != json.Delim('[') {
+		return errors.New("read json: expected an array of users or an object holding one")
+	}
+
+	for row := 1; dec.More(); row++ {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return fmt.Errorf("read json: user %d: %w", row, err)
+		}
+
+		if err := fn(decodeUser(row, raw)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// seekUserArray advances dec, inside an object, to the start of its
+// array of users.
+func seekUserArray(dec *json.Decoder) error {
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("read json: %w", err)
+		}
+
+		if key, _ := tok.(string); userArrayKeys[key] {
+			tok, err := dec.Token()
+			if err != nil {
+				return fmt.Errorf("read json: %w", err)
+			}
+			if tok != json.Delim('[') {
+				return fmt.Errorf("read json: %q is not an array", key)
+			}
+			return nil
+		}
+
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return fmt.Errorf("read json: %w", err)
+		}
+	}
+
+	return errors.New(`read json: no "users", "value" or "Resources" array`)
+}
+
+// idpUser covers the user objects of this API, Okta (profile),
+// Microsoft Graph (displayName, mail), Google Workspace (primaryEmail,
+// name.fullName), Auth0 (name, given_name) and SCIM (name.formatted,
+// emails, userName).
+type idpUser struct {
+	// a string, or an object (Google, SCIM)
+	Name        json.RawMessage `json:"name"`
+	DisplayName string          `json:"displayName"`
+	GivenName   string          `json:"given_name"`
+	FamilyName  string          `json:"family_name"`
+	Given       string          `json:"givenName"`
+	Surname     string          `json:"surname"`
+
+	Email        string `json:"email"`
+	Mail         string `json:"mail"`
+	PrimaryEmail string `json:"primaryEmail"`
+	UserName     string `json:"userName"`
+	Emails       []struct {
+		Value   string `json:"value"`
+		Primary bool   `json:"primary"`
+	} `json:"emails"`
+
+	Profile struct {
+		DisplayName string `json:"displayName"`
+		FirstName   string `json:"firstName"`
+		LastName    string `json:"lastName"`
+		Email       string `json:"email"`
+	} `json:"profile"`
+}
+
+type idpName struct {
+	Formatted  string `json:"formatted"`
+	FullName   string `json:"fullName"`
+	GivenName  string `json:"givenName"`
+	FamilyName string `json:"familyName"`
+}
+
+func decodeUser(row int, raw []byte) Record {
+	var u idpUser
+	if err := json.Unmarshal(raw, &u); err != nil {
+		return Record{Row: row, Err: fmt.Errorf("invalid json: %w", err)}
+	}
+
+	var (
+		plain string
+		name  idpName
+	)
+	if len(u.Name) > 0 && json.Unmarshal(u.Name, &plain) != nil {
+		if err := json.Unmarshal(u.Name, &name); err != nil {
+			return Record{Row: row, Err: errors.New("name is neither a string nor an object")}
+		}
+	}
+
+	primary := ""
+	for _, e := range u.Emails {
+		if primary == "" || e.Primary {
+			primary = e.Value
+		}
+	}
+
+	return Record{
+		Row: row,
+		Name: firstOf(
+			plain,
+			u.DisplayName,
+			name.Formatted,
+			name.FullName,
+			u.Profile.DisplayName,
+			joinName(name.GivenName, name.FamilyName),
+			joinName(u.GivenName, u.FamilyName),
+			joinName(u.Given, u.Surname),
+			joinName(u.Profile.FirstName, u.Profile.LastName),
+		),
+		Email: firstOf(
+			u.Email,
+			u.Mail,
+			u.PrimaryEmail,
+			u.Profile.Email,
+			primary,
+			u.UserName,
+		),
+	}
+}
+
+func firstOf(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func joinName(first, last string) string {
+	return strings.TrimSpace(strings.TrimSpace(first) + " " + strings.TrimSpace(last))
+}
@@ -0,0 +1,269 @@
+package importer_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"go-prod-app/internal/importer"
+)
+
+// read collects every record of input.
+func read(t *testing.T, format importer.Format, input string) ([]importer.Record, error) {
+	t.Helper()
+
+	var records []importer.Record
+	err := importer.Read(strings.NewReader(input), format, func(rec importer.Record) error {
+		records = append(records, rec)
+		return nil
+	})
+	return records, err
+}
+
+type want struct {
+	name, email string
+	invalid     bool
+}
+
+func assertRecords(t *testing.T, got []importer.Record, wants []want) {
+	t.Helper()
+
+	if len(got) != len(wants) {
+		t.Fatalf("got %d records %+v, want %d", len(got), got, len(wants))
+	}
+
+	for i, w := range wants {
+		rec := got[i]
+		if rec.Row != i+1 {
+			t.Errorf("record %d: Row = %d, want %d", i, rec.Row, i+1)
+		}
+		if w.invalid {
+			if rec.Err == nil {
+				t.Errorf("row %d: Err = nil, want an error", rec.Row)
+			}
+			continue
+		}
+		if rec.Err != nil {
+			t.Errorf("row %d: Err = %v", rec.Row, rec.Err)
+		}
+		if rec.Name != w.name || rec.Email != w.email {
+			t.Errorf("row %d = %q <%s>, want %q <%s>", rec.Row, rec.Name, rec.Email, w.name, w.email)
+		}
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []want
+	}{
+		{
+			name:  "this API's export",
+			input: "id,name,email,version\n1,Alice,alice@example.com,1\n",
+			want:  []want{{name: "Alice", email: "alice@example.com"}},
+		},
+		{
+			name:  "header aliases",
+			input: "Display Name,E-Mail Address\nAlice,alice@example.com\n",
+			want:  []want{{name: "Alice", email: "alice@example.com"}},
+		},
+		{
+			name:  "byte order mark",
+			input: "\ufeffemail,full_name\nalice@example.com,Alice\n",
+			want:  []want{{name: "Alice", email: "alice@example.com"}},
+		},
+		{
+			name:  "first and last name joined",
+			input: "given_name,Surname,mail\n Alice , Smith ,alice@example.com\nBob,,bob@example.com\n",
+			want: []want{
+				{name: "Alice Smith", email: "alice@example.com"},
+				{name: "Bob", email: "bob@example.com"},
+			},
+		},
+		{
+			name:  "name wins over first and last",
+			input: "name,first_name,last_name,email\nAl,Alice,Smith,alice@example.com\n",
+			want:  []want{{name: "Al", email: "alice@example.com"}},
+		},
+		{
+			name:  "first matching column wins",
+			input: "email,mail,name\nalice@example.com,other@example.com,Alice\n",
+			want:  []want{{name: "Alice", email: "alice@example.com"}},
+		},
+		{
+			name:  "short row",
+			input: "name,email\nAlice\n",
+			want:  []want{{name: "Alice", email: ""}},
+		},
+		{
+			name:  "malformed row",
+			input: "name,email\n\"Alice,alice@example.com\nBob,bob@example.com\n",
+			want:  []want{{invalid: true}},
+		},
+		{
+			name:  "bare quote mid-file",
+			input: "name,email\nA\"lice,alice@example.com\nBob,bob@example.com\n",
+			want: []want{
+				{invalid: true},
+				{name: "Bob", email: "bob@example.com"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := read(t, importer.CSV, tt.input)
+			if err != nil {
+				t.Fatalf("Read: %v", err)
+			}
+			assertRecords(t, got, tt.want)
+		})
+	}
+}
+
+func TestReadCSVMissingColumn(t *testing.T) {
+	for _, input := range []string{
+		"",
+		"name\nAlice\n",
+		"email\nalice@example.com\n",
+		"last_name,email\nSmith,alice@example.com\n",
+	} {
+		if _, err := read(t, importer.CSV, input); !errors.Is(err, importer.ErrMissingColumn) {
+			t.Errorf("Read(%q): err = %v, want ErrMissingColumn", input, err)
+		}
+	}
+}
+
+func TestReadNDJSON(t *testing.T) {
+	input := strings.Join([]string{
+		`{"name":"Alice","email":"alice@example.com"}`,
+		``,
+		`{"profile":{"firstName":"Bob","lastName":"Jones","email":"bob@example.com"}}`,
+		`{"name": 42}`,
+		`not json`,
+		`{"displayName":"Carol","mail":"carol@example.com"}`,
+	}, "\n")
+
+	got, err := read(t, importer.NDJSON, input)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+
+	assertRecords(t, got, []want{
+		{name: "Alice", email: "alice@example.com"},
+		{name: "Bob Jones", email: "bob@example.com"},
+		{invalid: true},
+		{invalid: true},
+		{name: "Carol", email: "carol@example.com"},
+	})
+}
+
+func TestReadJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []want
+	}{
+		{
+			name:  "array",
+			input: `[{"name":"Alice","email":"alice@example.com"},{"given_name":"Bob","family_name":"Jones","email":"bob@example.com"}]`,
+			want: []want{
+				{name: "Alice", email: "alice@example.com"},
+				{name: "Bob Jones", email: "bob@example.com"},
+			},
+		},
+		{
+			name: "Microsoft Graph",
+			input: `{"@odata.context":"https://graph.microsoft.com/v1.0/$metadata#users",
+				"value":[{"displayName":"Alice","givenName":"Alice","surname":"Smith","mail":"alice@example.com"},
+				         {"givenName":"Bob","surname":"Jones","mail":"bob@example.com"}]}`,
+			want: []want{
+				{name: "Alice", email: "alice@example.com"},
+				{name: "Bob Jones", email: "bob@example.com"},
+			},
+		},
+		{
+			name: "Google Workspace",
+			input: `{"kind":"admin#directory#users","users":[
+				{"primaryEmail":"alice@example.com","name":{"givenName":"Alice","familyName":"Smith","fullName":"Alice Smith"}},
+				{"primaryEmail":"bob@example.com","name":{"givenName":"Bob","familyName":"Jones"}}]}`,
+			want: []want{
+				{name: "Alice Smith", email: "alice@example.com"},
+				{name: "Bob Jones", email: "bob@example.com"},
+			},
+		},
+		{
+			name: "SCIM emails[primary]",
+			input: `{"schemas":["urn:ietf:params:scim:api:messages:2.0:ListResponse"],"totalResults":3,"Resources":[
+				{"userName":"alice","name":{"formatted":"Alice Smith"},
+				 "emails":[{"value":"alice@home.example","primary":false},{"value":"alice@example.com","primary":true}]},
+				{"userName":"bob@example.com","name":{"givenName":"Bob","familyName":"Jones"}},
+				{"userName":"carol","name":{"formatted":"Carol"},"emails":[{"value":"carol@example.com"}]}]}`,
+			want: []want{
+				{name: "Alice Smith", email: "alice@example.com"},
+				{name: "Bob Jones", email: "bob@example.com"},
+				{name: "Carol", email: "carol@example.com"},
+			},
+		},
+		{
+			name:  "malformed user",
+			input: `[{"name":["Alice"],"email":"alice@example.com"},{"name":"Bob","email":"bob@example.com"}]`,
+			want: []want{
+				{invalid: true},
+				{name: "Bob", email: "bob@example.com"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := read(t, importer.JSON, tt.input)
+			if err != nil {
+				t.Fatalf("Read: %v", err)
+			}
+			assertRecords(t, got, tt.want)
+		})
+	}
+}
+
+func TestReadJSONUnreadable(t *testing.T) {
+	for _, input := range []string{
+		``,
+		`"users"`,
+		`{"total":1}`,
+		`{"users":{"name":"Alice"}}`,
+		`[{"name":"Alice"`,
+	} {
+		if _, err := read(t, importer.JSON, input); err == nil {
+			t.Errorf("Read(%q) succeeded", input)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		contentType, path string
+		want              importer.Format
+	}{
+		{"text/csv; charset=utf-8", "users.CSV", importer.CSV},
+		{"application/x-ndjson", "users.jsonl", importer.NDJSON},
+		{"application/json", "export.json", importer.JSON},
+	}
+
+	for _, tt := range tests {
+		if f, err := importer.FormatFromContentType(tt.contentType); err != nil || f != tt.want {
+			t.Errorf("FormatFromContentType(%q) = %q, %v, want %q", tt.contentType, f, err, tt.want)
+		}
+		if f, err := importer.FormatFromPath(tt.path); err != nil || f != tt.want {
+			t.Errorf("FormatFromPath(%q) = %q, %v, want %q", tt.path, f, err, tt.want)
+		}
+	}
+
+	if _, err := importer.FormatFromPath("users.xlsx"); !errors.Is(err, importer.ErrInvalidFormat) {
+		t.Errorf("FormatFromPath(users.xlsx): err = %v, want ErrInvalidFormat", err)
+	}
+	if _, err := importer.ParseFormat("xml"); !errors.Is(err, importer.ErrInvalidFormat) {
+		t.Errorf("ParseFormat(xml): err = %v, want ErrInvalidFormat", err)
+	}
+}
@@ -1,6 +1,11 @@
 package metrics
 
-import "github.com/prometheus/client_golang/prometheus"
+import (
+	"database/sql"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
 
 var HTTPRequests = prometheus.NewCounterVec(
 	prometheus.CounterOpts{
@@ -10,6 +15,263 @@ var HTTPRequests = prometheus.NewCounterVec(
 	[]string{"method", "path"},
 )
 
+//
+// =========================
+// Repository
+// =========================
+//
+
+var RepositoryDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "repository_duration_seconds",
+		Help:    "Latency of user repository calls by method",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	},
+	[]string{"method"},
+)
+
+var RepositoryErrors = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "repository_errors_total",
+		Help: "Total number of failed user repository calls by method and error",
+	},
+	[]string{"method", "error"},
+)
+
+var DBRetries = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "db_retries_total",
+		Help: "Total number of retried database operations by transient error class",
+	},
+	[]string{"class"},
+)
+
+//
+// =========================
+// Outbox Relay
+// =========================
+//
+
+var OutboxPublished = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "outbox_published_total",
+		Help: "Total number of outbox events delivered to the sink",
+	},
+	[]string{"event_type"},
+)
+
+var OutboxPublishFailures = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "outbox_publish_failures_total",
+		Help: "Total number of failed outbox delivery attempts",
+	},
+	[]string{"event_type"},
+)
+
+var OutboxDeadLettered = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "outbox_dead_lettered_total",
+		Help: "Total number of outbox events given up on after max attempts",
+	},
+	[]string{"event_type"},
+)
+
+var OutboxPending = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "outbox_pending",
+		Help: "Number of outbox events waiting for delivery",
+	},
+)
+
+var OutboxLag = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "outbox_lag_seconds",
+		Help: "Age of the oldest undelivered outbox event",
+	},
+)
+
+//
+// =========================
+// Retention Purge
+// =========================
+//
+
+var UsersPurged = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "users_purged_total",
+		Help: "Total number of soft-deleted users permanently removed",
+	},
+)
+
+var UsersPurgeable = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "users_purgeable",
+		Help: "Soft-deleted users past retention at the last purge run",
+	},
+)
+
+var PurgeRuns = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "user_purge_runs_total",
+		Help: "Total number of retention purge runs",
+	},
+	[]string{"result"},
+)
+
+//
+// =========================
+// Read Replicas
+// =========================
+//
+
+var DBReads = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "db_reads_total",
+		Help: "Total number of repository reads by the pool that served them",
+	},
+	[]string{"target"},
+)
+
+var ReplicaLag = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "db_replica_lag_seconds",
+		Help: "Replication lag of each read replica at the last health check",
+	},
+	[]string{"replica"},
+)
+
+var ReplicaHealthy = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "db_replica_healthy",
+		Help: "Whether each read replica is in rotation (1) or not (0)",
+	},
+	[]string{"replica"},
+)
+
+//
+// =========================
+// User Cache
+// =========================
+//
+
+var UserCacheHits = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "user_cache_hits_total",
+		Help: "Total number of user lookups served from the cache",
+	},
+	[]string{"lookup"},
+)
+
+var UserCacheMisses = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "user_cache_misses_total",
+		Help: "Total number of user lookups that went to the database",
+	},
+	[]string{"lookup"},
+)
+
+var UserCacheEvictions = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "user_cache_evictions_total",
+		Help: "Total number of users evicted from the cache to make room",
+	},
+)
+
+var UserCacheStale = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "user_cache_stale_total",
+		Help: "Total number of expired users served because the database failed",
+	},
+)
+
+//
+// =========================
+// Change Feed
+// =========================
+//
+
+var ChangeFeedEvents = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "change_feed_events_total",
+		Help: "Total number of user changes received from the change feed",
+	},
+	[]string{"op"},
+)
+
+var ChangeFeedDropped = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "change_feed_dropped_total",
+		Help: "Total number of changes dropped for subscribers that fell behind",
+	},
+)
+
+var ChangeFeedReconnects = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "change_feed_reconnects_total",
+		Help: "Total number of change feed reconnects to the database",
+	},
+)
+
+//
+// =========================
+// Email Encryption
+// =========================
+//
+
+var EmailsReencrypted = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "emails_reencrypted_total",
+		Help: "Total number of stored emails re-encrypted under the active key",
+	},
+)
+
+var EmailsStale = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "emails_stale",
+		Help: "Stored emails not under the active key at the last re-encryption run",
+	},
+)
+
+var ReencryptRuns = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "email_reencrypt_runs_total",
+		Help: "Total number of email re-encryption runs",
+	},
+	[]string{"result"},
+)
+
 func Init() {
-	prometheus.MustRegister(HTTPRequests)
+	prometheus.MustRegister(
+		HTTPRequests,
+		RepositoryDuration,
+		RepositoryErrors,
+		DBRetries,
+		OutboxPublished,
+		OutboxPublishFailures,
+		OutboxDeadLettered,
+		OutboxPending,
+		OutboxLag,
+		UsersPurged,
+		UsersPurgeable,
+		PurgeRuns,
+		DBReads,
+		ReplicaLag,
+		ReplicaHealthy,
+		UserCacheHits,
+		UserCacheMisses,
+		UserCacheEvictions,
+		UserCacheStale,
+		ChangeFeedEvents,
+		ChangeFeedDropped,
+		ChangeFeedReconnects,
+		EmailsReencrypted,
+		EmailsStale,
+		ReencryptRuns,
+	)
+}
+
+// RegisterDBStats exports db.Stats() as go_sql_* metrics labelled
+// db_name=name: open, in-use and idle connections, waits and closes.
+func RegisterDBStats(db *sql.DB, name string) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, name))
 }
@@ -0,0 +1,441 @@
+// Package migrate applies versioned SQL migrations to PostgreSQL.
+//
+// Migrations are read from an fs.FS (normally the files embedded by the
+// database package), applied in version order, and recorded in the
+// schema_migrations table. Every run holds a Postgres advisory lock so
+// concurrent replicas never migrate at the same time.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrNoMigrations   = errors.New("no migrations found")
+	ErrUnknownVersion = errors.New("unknown migration version")
+	ErrSchemaMismatch = errors.New("schema version mismatch")
+)
+
+// lockID is the pg_advisory_lock key shared by every replica.
+// Arbitrary, but must never change.
+const lockID int64 = 7_324_118_901
+
+var fileRegex = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+//
+// =========
+// Migration
+// =========
+//
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status describes one migration and whether it has been applied.
+type Status struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// Load reads NNNN_name.up.sql / NNNN_name.down.sql pairs from fsys.
+// Every version must have both files.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+
+		m := fileRegex.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", e.Name())
+		}
+
+		version, err := strconv.Atoi(m[1])
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in %q", e.Name())
+		}
+
+		body, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		}
+		if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q",
+				version, mig.Name, m[2])
+		}
+
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	if len(byVersion) == 0 {
+		return nil, ErrNoMigrations
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d (%s) needs both up and down files",
+				m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+//
+// =========
+// Migrator
+// =========
+//
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+func New(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Latest returns the highest version known to this build.
+func (m *Migrator) Latest() int {
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Up applies every pending migration.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	return m.To(ctx, m.Latest())
+}
+
+// Down rolls back the most recently applied migration.
+func (m *Migrator) Down(ctx context.Context) ([]Migration, error) {
+	var changed []Migration
+
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		current, err := currentVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if current == 0 {
+			return nil
+		}
+
+		changed, err = m.migrate(ctx, conn, current, m.previous(current))
+		return err
+	})
+
+	return changed, err
+}
+
+// To migrates up or down until the schema is at target.
+// Target 0 rolls back everything.
+func (m *Migrator) To(ctx context.Context, target int) ([]Migration, error) {
+	if target != 0 && m.find(target) == nil {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownVersion, target)
+	}
+
+	var changed []Migration
+
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		current, err := currentVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		changed, err = m.migrate(ctx, conn, current, target)
+		return err
+	})
+
+	return changed, err
+}
+
+// Status lists every known migration with its applied time, if any.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := ensureTable(ctx, conn); err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.QueryContext(ctx,
+		`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var (
+			version   int
+			appliedAt time.Time
+		)
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		s := Status{Version: mig.Version, Name: mig.Name}
+		if at, ok := applied[mig.Version]; ok {
+			s.AppliedAt = &at
+		}
+		statuses = append(statuses, s)
+	}
+
+	return statuses, nil
+}
+
+//
+// =========
+// Version Check
+// =========
+//
+
+// Version returns the highest applied migration, or 0 for an empty database.
+func Version(ctx context.Context, db *sql.DB) (int, error) {
+	var version int
+
+	err := db.QueryRowContext(ctx, `
+		SELECT COALESCE(MAX(version), 0)
+		FROM schema_migrations
+	`).Scan(&version)
+	if err != nil {
+		if isUndefinedTable(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// CheckVersion returns ErrSchemaMismatch unless the database is exactly at want.
+func CheckVersion(ctx context.Context, db *sql.DB, want int) error {
+	got, err := Version(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	if got != want {
+		return fmt.Errorf("%w: database at %d, expected %d", ErrSchemaMismatch, got, want)
+	}
+
+	return nil
+}
+
+//
+// =========
+// Helpers
+// =========
+//
+
+// migrate walks from current to target one migration at a time.
+// Each step runs in its own transaction together with its
+// schema_migrations bookkeeping, so a failed step leaves no trace.
+func (m *Migrator) migrate(
+	ctx context.Context,
+	conn *sql.Conn,
+	current int,
+	target int,
+) ([]Migration, error) {
+
+	var changed []Migration
+
+	for current != target {
+		if err := ctx.Err(); err != nil {
+			return changed, err
+		}
+
+		var (
+			mig  *Migration
+			stmt string
+			book string
+			args []interface{}
+			next int
+		)
+
+		if current < target {
+			mig = m.next(current)
+			if mig == nil {
+				return changed, fmt.Errorf("%w: no migration after %d", ErrUnknownVersion, current)
+			}
+			stmt = mig.Up
+			book = `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`
+			args = []interface{}{mig.Version, mig.Name}
+			next = mig.Version
+		} else {
+			mig = m.find(current)
+			if mig == nil {
+				return changed, fmt.Errorf("%w: %d is applied but not known to this build",
+					ErrUnknownVersion, current)
+			}
+			stmt = mig.Down
+			book = `DELETE FROM schema_migrations WHERE version = $1`
+			args = []interface{}{mig.Version}
+			next = m.previous(current)
+		}
+
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return changed, err
+		}
+
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			_ = tx.Rollback()
+			return changed, fmt.Errorf("migration %d (%s): %w", mig.Version, mig.Name, err)
+		}
+
+		if _, err := tx.ExecContext(ctx, book, args...); err != nil {
+			_ = tx.Rollback()
+			return changed, err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return changed, err
+		}
+
+		changed = append(changed, *mig)
+		current = next
+	}
+
+	return changed, nil
+}
+
+// withLock runs fn on a single connection holding the migration advisory lock.
+// Session-level advisory locks belong to a connection, hence *sql.Conn.
+func (m *Migrator) withLock(
+	ctx context.Context,
+	fn func(conn *sql.Conn) error,
+) error {
+
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockID); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+
+	defer func() {
+		// Use a fresh context: ctx may already be cancelled.
+		unlockCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, _ = conn.ExecContext(unlockCtx, `SELECT pg_advisory_unlock($1)`, lockID)
+	}()
+
+	if err := ensureTable(ctx, conn); err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+func (m *Migrator) find(version int) *Migration {
+	for i := range m.migrations {
+		if m.migrations[i].Version == version {
+			return &m.migrations[i]
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) next(version int) *Migration {
+	for i := range m.migrations {
+		if m.migrations[i].Version > version {
+			return &m.migrations[i]
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) previous(version int) int {
+	prev := 0
+	for _, mig := range m.migrations {
+		if mig.Version >= version {
+			break
+		}
+		prev = mig.Version
+	}
+	return prev
+}
+
+func ensureTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)
+	`)
+	return err
+}
+
+func currentVersion(ctx context.Context, conn *sql.Conn) (int, error) {
+	var version int
+	err := conn.QueryRowContext(ctx,
+		`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`,
+	).Scan(&version)
+	return version, err
+}
+
+func isUndefinedTable(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "42P01"
+	}
+	return false
+}
@@ -0,0 +1,208 @@
+// Package outbox delivers events written to the transactional outbox.
+//
+// The service layer appends events in the same transaction as the user
+// change; the Relay here leases them and hands them to a Sink with
+// at-least-once delivery, retrying with exponential backoff and
+// dead-lettering events that keep failing.
+package outbox
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"go-prod-app/internal/metrics"
+	"go-prod-app/internal/repository"
+)
+
+type RelayConfig struct {
+	// BatchSize is the number of events claimed at once.
+	BatchSize int
+	// Lease is how long claimed events are reserved for this relay.
+	// Events it has not published by then are left to the next claim.
+	Lease time.Duration
+	// PollInterval is how long to sleep when there is nothing to deliver.
+	PollInterval time.Duration
+	// MaxAttempts is the number of failed attempts before dead-lettering.
+	MaxAttempts int
+	// BaseBackoff and MaxBackoff bound the exponential retry delay.
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+}
+
+func DefaultRelayConfig() RelayConfig {
+	return RelayConfig{
+		BatchSize:    100,
+		Lease:        time.Minute,
+		PollInterval: time.Second,
+		MaxAttempts:  10,
+		BaseBackoff:  time.Second,
+		MaxBackoff:   5 * time.Minute,
+	}
+}
+
+type Relay struct {
+	store  repository.OutboxRepository
+	sink   Sink
+	cfg    RelayConfig
+	logger *slog.Logger
+}
+
+func NewRelay(
+	store repository.OutboxRepository,
+	sink Sink,
+	cfg RelayConfig,
+	logger *slog.Logger,
+) *Relay {
+	return &Relay{
+		store:  store,
+		sink:   sink,
+		cfg:    cfg,
+		logger: logger,
+	}
+}
+
+// Run delivers events until ctx is cancelled.
+func (r *Relay) Run(ctx context.Context) {
+	r.logger.Info("outbox relay started")
+	defer r.logger.Info("outbox relay stopped")
+
+	for {
+		n, err := r.RelayBatch(ctx)
+		if err != nil && ctx.Err() == nil {
+			r.logger.Error("outbox relay batch failed", "error", err)
+		}
+
+		r.updateBacklogMetrics(ctx)
+
+		// A full batch means there is probably more waiting.
+		if err == nil && n == r.cfg.BatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.cfg.PollInterval):
+		}
+	}
+}
+
+// RelayBatch leases one batch and attempts to deliver it.
+// It returns the number of events claimed.
+//
+// No transaction is open while the sink is called: the lease is
+// committed first, and each outcome is recorded in a statement of its
+// own right after the event is published.
+func (r *Relay) RelayBatch(ctx context.Context) (int, error) {
+	now := time.Now().UTC()
+	leaseUntil := now.Add(r.cfg.Lease)
+
+	msgs, err := r.store.ClaimPending(ctx, now, leaseUntil, r.cfg.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, m := range msgs {
+		// Another relay may claim the rest once the lease is over.
+		if time.Now().After(leaseUntil) {
+			break
+		}
+
+		if err := r.deliver(ctx, m); err != nil {
+			return len(msgs), err
+		}
+	}
+
+	return len(msgs), nil
+}
+
+// deliver publishes one message and records the outcome.
+// Only bookkeeping errors are returned; a sink failure is recorded
+// on the message and does not abort the batch. A message whose outcome
+// could not be recorded is delivered again after its lease.
+func (r *Relay) deliver(ctx context.Context, m *repository.OutboxMessage) error {
+	pubErr := r.sink.Publish(ctx, eventFromMessage(m))
+	now := time.Now().UTC()
+
+	if pubErr == nil {
+		metrics.OutboxPublished.WithLabelValues(m.EventType).Inc()
+		return r.record(r.store.MarkPublished(ctx, m.ID, m.LockedUntil, now), m)
+	}
+
+	// Shutting down: leave the message to the next run once its lease
+	// is over.
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	metrics.OutboxPublishFailures.WithLabelValues(m.EventType).Inc()
+
+	attempts := m.Attempts + 1
+
+	if attempts >= r.cfg.MaxAttempts {
+		metrics.OutboxDeadLettered.WithLabelValues(m.EventType).Inc()
+		r.logger.Error("outbox event dead-lettered",
+			"event_id", m.EventID,
+			"event_type", m.EventType,
+			"attempts", attempts,
+			"error", pubErr,
+		)
+		return r.record(r.store.MarkDeadLettered(ctx, m.ID, m.LockedUntil, pubErr.Error(), now), m)
+	}
+
+	r.logger.Warn("outbox delivery failed",
+		"event_id", m.EventID,
+		"event_type", m.EventType,
+		"attempts", attempts,
+		"error", pubErr,
+	)
+
+	return r.record(r.store.MarkFailed(ctx, m.ID, m.LockedUntil, pubErr.Error(), now.Add(r.backoff(attempts))), m)
+}
+
+// record passes on the error of recording m's outcome. A lost lease is
+// not one: the relay that took the message over records its own.
+func (r *Relay) record(err error, m *repository.OutboxMessage) error {
+	if errors.Is(err, repository.ErrLeaseLost) {
+		r.logger.Warn("outbox lease lost, event will be delivered again",
+			"event_id", m.EventID,
+			"event_type", m.EventType,
+		)
+		return nil
+	}
+	return err
+}
+
+// backoff returns a jittered exponential delay for the given attempt.
+func (r *Relay) backoff(attempts int) time.Duration {
+	d := r.cfg.BaseBackoff
+	for i := 1; i < attempts && d < r.cfg.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > r.cfg.MaxBackoff {
+		d = r.cfg.MaxBackoff
+	}
+
+	// Equal jitter in [d/2, d] so relays retrying together spread out.
+	half := d / 2
+	return half + rand.N(half+1)
+}
+
+func (r *Relay) updateBacklogMetrics(ctx context.Context) {
+	stats, err := r.store.Stats(ctx)
+	if err != nil {
+		return
+	}
+
+	metrics.OutboxPending.Set(float64(stats.Pending))
+
+	if stats.OldestPending == nil {
+		metrics.OutboxLag.Set(0)
+		return
+	}
+
+	metrics.OutboxLag.Set(time.Since(*stats.OldestPending).Seconds())
+}
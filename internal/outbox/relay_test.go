@@ -0,0 +1,70 @@
+package outbox_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"go-prod-app/internal/outbox"
+	"go-prod-app/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+type sinkFunc func(ctx context.Context, event outbox.Event) error
+
+func (f sinkFunc) Publish(ctx context.Context, event outbox.Event) error {
+	return f(ctx, event)
+}
+
+// A relay whose lease ran out while it published leaves the message to
+// the relay that reclaimed it.
+func TestRelayLeaseLost(t *testing.T) {
+	ctx := context.Background()
+	store := repository.NewMemoryOutboxRepository()
+
+	if err := store.Append(ctx, &repository.OutboxMessage{
+		EventID:     uuid.NewString(),
+		AggregateID: uuid.NewString(),
+		EventType:   "user.created",
+		Payload:     []byte(`{}`),
+	}); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+
+	var reclaimed []*repository.OutboxMessage
+
+	slow := sinkFunc(func(ctx context.Context, event outbox.Event) error {
+		// the lease runs out and another relay claims the message
+		later := time.Now().UTC().Add(time.Hour)
+		var err error
+		reclaimed, err = store.ClaimPending(ctx, later, later.Add(time.Minute), 10)
+		return err
+	})
+
+	cfg := outbox.DefaultRelayConfig()
+	relay := outbox.NewRelay(store, slow, cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	n, err := relay.RelayBatch(ctx)
+	if err != nil {
+		t.Fatalf("RelayBatch: %v", err)
+	}
+	if n != 1 || len(reclaimed) != 1 {
+		t.Fatalf("claimed %d, reclaimed %d, want 1 and 1", n, len(reclaimed))
+	}
+
+	// nothing was recorded by the first relay
+	stats, err := store.Stats(ctx)
+	if err != nil {
+		t.Fatalf("Stats: %v", err)
+	}
+	if stats.Pending != 1 {
+		t.Errorf("pending = %d, want 1", stats.Pending)
+	}
+
+	if err := store.MarkPublished(ctx, reclaimed[0].ID, reclaimed[0].LockedUntil, time.Now().UTC()); err != nil {
+		t.Errorf("MarkPublished by the new owner: %v", err)
+	}
+}
@@ -0,0 +1,190 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"go-prod-app/internal/repository"
+)
+
+//
+// =========
+// Event
+// =========
+//
+
+// Event is the envelope delivered to sinks.
+// ID is stable across retries so consumers can deduplicate.
+type Event struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	AggregateID string          `json:"aggregate_id"`
+	OccurredAt  time.Time       `json:"occurred_at"`
+	Payload     json.RawMessage `json:"payload"`
+}
+
+func eventFromMessage(m *repository.OutboxMessage) Event {
+	return Event{
+		ID:          m.EventID,
+		Type:        m.EventType,
+		AggregateID: m.AggregateID,
+		OccurredAt:  m.CreatedAt,
+		Payload:     json.RawMessage(m.Payload),
+	}
+}
+
+//
+// =========
+// Sink
+// =========
+//
+
+// Sink delivers events downstream.
+//
+// Delivery is at-least-once: Publish may be called again for an event
+// that was already delivered if the relay crashes before recording it.
+type Sink interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+//
+// =========================
+// WriterSink (NDJSON)
+// =========================
+//
+
+// WriterSink writes one JSON event per line.
+type WriterSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+// NewStdoutSink writes NDJSON events to standard output.
+func NewStdoutSink() *WriterSink {
+	return NewWriterSink(os.Stdout)
+}
+
+func (s *WriterSink) Publish(ctx context.Context, event Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err = s.w.Write(line)
+	return err
+}
+
+//
+// =========================
+// FileSink (NDJSON)
+// =========================
+//
+
+// FileSink appends NDJSON events to a file and fsyncs after every event,
+// so an event is durable before the relay marks it published.
+type FileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileSink{file: f}, nil
+}
+
+func (s *FileSink) Publish(ctx context.Context, event Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.file.Write(line); err != nil {
+		return err
+	}
+
+	return s.file.Sync()
+}
+
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
+
+//
+// =========================
+// HTTPSink
+// =========================
+//
+
+// HTTPSink POSTs each event as JSON. Any non-2xx response is a failure.
+// The event ID is sent as Idempotency-Key for receivers that deduplicate.
+type HTTPSink struct {
+	url    string
+	client *http.Client
+}
+
+func NewHTTPSink(url string, timeout time.Duration) *HTTPSink {
+	return &HTTPSink{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (s *HTTPSink) Publish(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", event.ID)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Drain so the connection can be reused.
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("sink responded %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,255 @@
+// Package purge enforces the retention policy for soft-deleted users.
+//
+// Users soft-deleted longer than the retention period are hard-deleted
+// in small batches, each in its own transaction, so a purge never holds
+// long locks and can stop cleanly between batches on shutdown.
+package purge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"go-prod-app/internal/domain"
+	"go-prod-app/internal/metrics"
+	"go-prod-app/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// EventUserPurged is written to the outbox for every purged user so
+// downstream systems can erase their copies.
+const EventUserPurged = "user.purged"
+
+type Config struct {
+	// Retention is how long a user stays soft-deleted before purge.
+	Retention time.Duration
+	// BatchSize is the number of users removed per transaction.
+	BatchSize int
+	// BatchPause is the sleep between batches, to spread the load.
+	BatchPause time.Duration
+	// Interval is the time between runs of the background purger.
+	Interval time.Duration
+	// DryRun reports what would be purged without deleting anything.
+	DryRun bool
+}
+
+// Validate reports a Config the Purger cannot run with.
+func (c Config) Validate() error {
+	if c.Retention <= 0 || c.BatchSize <= 0 || c.Interval <= 0 {
+		return errors.New("retention, batch size and interval must be positive")
+	}
+	if c.BatchPause < 0 {
+		return errors.New("batch pause must not be negative")
+	}
+	return nil
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Retention:  30 * 24 * time.Hour,
+		BatchSize:  100,
+		BatchPause: 100 * time.Millisecond,
+		Interval:   time.Hour,
+	}
+}
+
+// Report summarizes one purge run.
+type Report struct {
+	Cutoff   time.Time
+	Eligible int64
+	Purged   int64
+	Batches  int
+	DryRun   bool
+}
+
+type Purger struct {
+	tx     repository.TxManager
+	users  repository.UserPurger
+	outbox repository.OutboxRepository
+	cfg    Config
+	logger *slog.Logger
+}
+
+// New builds a Purger. outbox may be nil to skip user.purged events.
+func New(
+	tx repository.TxManager,
+	users repository.UserPurger,
+	outbox repository.OutboxRepository,
+	cfg Config,
+	logger *slog.Logger,
+) *Purger {
+	return &Purger{
+		tx:     tx,
+		users:  users,
+		outbox: outbox,
+		cfg:    cfg,
+		logger: logger,
+	}
+}
+
+// Run purges every Interval until ctx is cancelled.
+func (p *Purger) Run(ctx context.Context) {
+	p.logger.Info("user purger started",
+		"retention", p.cfg.Retention.String(),
+		"interval", p.cfg.Interval.String(),
+		"dry_run", p.cfg.DryRun,
+	)
+	defer p.logger.Info("user purger stopped")
+
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := p.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			p.logger.Error("user purge failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce purges everything currently past retention, batch by batch.
+// On cancellation it stops between batches and returns the partial
+// report with ctx's error. Retention applies to every tenant.
+func (p *Purger) RunOnce(ctx context.Context) (Report, error) {
+	ctx = repository.WithAllTenants(ctx)
+
+	report := Report{
+		Cutoff: time.Now().UTC().Add(-p.cfg.Retention),
+		DryRun: p.cfg.DryRun,
+	}
+
+	eligible, err := p.users.CountPurgeable(ctx, report.Cutoff)
+	if err != nil {
+		metrics.PurgeRuns.WithLabelValues("error").Inc()
+		return report, err
+	}
+
+	report.Eligible = eligible
+	metrics.UsersPurgeable.Set(float64(eligible))
+
+	if p.cfg.DryRun || eligible == 0 {
+		metrics.PurgeRuns.WithLabelValues("ok").Inc()
+		p.logReport(report)
+		return report, nil
+	}
+
+	for {
+		n, err := p.purgeBatch(ctx, report.Cutoff)
+		report.Purged += int64(n)
+		if n > 0 {
+			report.Batches++
+		}
+
+		if err != nil {
+			result := "error"
+			if errors.Is(err, context.Canceled) {
+				result = "cancelled"
+			}
+			metrics.PurgeRuns.WithLabelValues(result).Inc()
+			p.logReport(report)
+			return report, err
+		}
+
+		if n < p.cfg.BatchSize {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			metrics.PurgeRuns.WithLabelValues("cancelled").Inc()
+			p.logReport(report)
+			return report, ctx.Err()
+		case <-time.After(p.cfg.BatchPause):
+		}
+	}
+
+	metrics.PurgeRuns.WithLabelValues("ok").Inc()
+	p.logReport(report)
+	return report, nil
+}
+
+// redactedFields are removed from the outbox events of purged users:
+// the name is the only personal data user events carry.
+var redactedFields = []string{"name"}
+
+// purgeBatch removes one batch, redacts the users' earlier outbox
+// events and records the purge events atomically.
+func (p *Purger) purgeBatch(ctx context.Context, cutoff time.Time) (int, error) {
+	var purged []domain.UserID
+
+	err := p.tx.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+
+		purged, err = p.users.PurgeDeleted(ctx, cutoff, p.cfg.BatchSize)
+		if err != nil {
+			return err
+		}
+
+		if err := p.redactEvents(ctx, purged); err != nil {
+			return err
+		}
+
+		for _, id := range purged {
+			if err := p.recordPurged(ctx, id); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	metrics.UsersPurged.Add(float64(len(purged)))
+	return len(purged), nil
+}
+
+func (p *Purger) redactEvents(ctx context.Context, purged []domain.UserID) error {
+	if p.outbox == nil || len(purged) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(purged))
+	for i, id := range purged {
+		ids[i] = string(id)
+	}
+
+	return p.outbox.RedactPayloads(ctx, ids, redactedFields)
+}
+
+func (p *Purger) recordPurged(ctx context.Context, id domain.UserID) error {
+	if p.outbox == nil {
+		return nil
+	}
+
+	payload, err := json.Marshal(map[string]string{"id": string(id)})
+	if err != nil {
+		return err
+	}
+
+	return p.outbox.Append(ctx, &repository.OutboxMessage{
+		EventID:     uuid.NewString(),
+		AggregateID: string(id),
+		EventType:   EventUserPurged,
+		Payload:     payload,
+	})
+}
+
+func (p *Purger) logReport(r Report) {
+	p.logger.Info("user purge finished",
+		"cutoff", r.Cutoff.Format(time.RFC3339),
+		"eligible", r.Eligible,
+		"purged", r.Purged,
+		"batches", r.Batches,
+		"dry_run", r.DryRun,
+	)
+}
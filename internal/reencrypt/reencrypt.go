@@ -0,0 +1,149 @@
+// Package reencrypt moves stored emails to the active encryption key.
+//
+// After a key rotation, rows encrypted under the old key stay readable
+// as long as the old key is in the key ring. The Reencrypter rewrites
+// them in small batches, each in its own transaction, until none is
+// left and the old key can be retired. It also encrypts the plaintext
+// emails left from before encryption was introduced.
+package reencrypt
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"go-prod-app/internal/metrics"
+	"go-prod-app/internal/repository"
+)
+
+type Config struct {
+	// BatchSize is the number of rows re-encrypted per transaction.
+	BatchSize int
+	// BatchPause is the sleep between batches, to spread the load.
+	BatchPause time.Duration
+	// Interval is the time between runs of the background job.
+	Interval time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		BatchSize:  500,
+		BatchPause: 100 * time.Millisecond,
+		Interval:   time.Hour,
+	}
+}
+
+// Report summarizes one run.
+type Report struct {
+	Stale       repository.StaleEmails
+	Reencrypted int64
+	Batches     int
+}
+
+type Reencrypter struct {
+	users  repository.EmailReencrypter
+	cfg    Config
+	logger *slog.Logger
+}
+
+func New(
+	users repository.EmailReencrypter,
+	cfg Config,
+	logger *slog.Logger,
+) *Reencrypter {
+	return &Reencrypter{
+		users:  users,
+		cfg:    cfg,
+		logger: logger,
+	}
+}
+
+// Run re-encrypts every Interval until ctx is cancelled.
+func (r *Reencrypter) Run(ctx context.Context) {
+	r.logger.Info("email re-encryption started", "interval", r.cfg.Interval.String())
+	defer r.logger.Info("email re-encryption stopped")
+
+	ticker := time.NewTicker(r.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			r.logger.Error("email re-encryption failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce re-encrypts every stale email of every tenant, batch by
+// batch. On cancellation it stops between batches and returns the
+// partial report with ctx's error.
+func (r *Reencrypter) RunOnce(ctx context.Context) (Report, error) {
+	ctx = repository.WithAllTenants(ctx)
+
+	var report Report
+
+	stale, err := r.users.CountStaleEmails(ctx)
+	if err != nil {
+		metrics.ReencryptRuns.WithLabelValues("error").Inc()
+		return report, err
+	}
+
+	report.Stale = stale
+	metrics.EmailsStale.Set(float64(stale.Total()))
+
+	if stale.Total() == 0 {
+		metrics.ReencryptRuns.WithLabelValues("ok").Inc()
+		return report, nil
+	}
+
+	for {
+		n, err := r.users.ReencryptEmails(ctx, r.cfg.BatchSize)
+		report.Reencrypted += int64(n)
+		metrics.EmailsReencrypted.Add(float64(n))
+		if n > 0 {
+			report.Batches++
+		}
+
+		if err != nil {
+			result := "error"
+			if errors.Is(err, context.Canceled) {
+				result = "cancelled"
+			}
+			metrics.ReencryptRuns.WithLabelValues(result).Inc()
+			r.logReport(report)
+			return report, err
+		}
+
+		if n < r.cfg.BatchSize {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			metrics.ReencryptRuns.WithLabelValues("cancelled").Inc()
+			r.logReport(report)
+			return report, ctx.Err()
+		case <-time.After(r.cfg.BatchPause):
+		}
+	}
+
+	metrics.EmailsStale.Set(float64(max(stale.Total()-report.Reencrypted, 0)))
+	metrics.ReencryptRuns.WithLabelValues("ok").Inc()
+	r.logReport(report)
+	return report, nil
+}
+
+func (r *Reencrypter) logReport(report Report) {
+	r.logger.Info("email re-encryption finished",
+		"plaintext", report.Stale.Plaintext,
+		"old_key", report.Stale.OldKey,
+		"reencrypted", report.Reencrypted,
+		"batches", report.Batches,
+	)
+}
@@ -0,0 +1,17 @@
+package repository
+
+import "context"
+
+type actorKey struct{}
+
+// WithActor records who is making changes through ctx.
+// Repositories store it with every user version.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor set by WithActor, or "".
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
@@ -0,0 +1,395 @@
+package repository
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"go-prod-app/internal/domain"
+	"go-prod-app/internal/metrics"
+)
+
+type UserCacheConfig struct {
+	// Size is the maximum number of cached users.
+	Size int
+	// TTL is how long an entry is served without going to next.
+	TTL time.Duration
+	// StaleTTL lets an expired entry be served for this much longer when
+	// next fails (database unreachable). Zero disables stale reads.
+	StaleTTL time.Duration
+}
+
+func DefaultUserCacheConfig() UserCacheConfig {
+	return UserCacheConfig{
+		Size: 10000,
+		TTL:  30 * time.Second,
+	}
+}
+
+// CachedUserRepository is a read-through cache in front of a
+// UserRepository for GetByID and GetByEmail.
+//
+// Entries are evicted least recently used first and expire after TTL.
+// Update replaces an entry with a tombstone holding the new version, so
+// a concurrent read that fetched an older version cannot put it back.
+// Reads inside a transaction bypass the cache, and List and Count are
+// always passed through. Entries are keyed by tenant, so a user is only
+// served to its own tenant.
+//
+// Writes made without this decorator (other processes, the purger) are
+// only seen once their entries expire, unless they are fed to Invalidate
+// (see ChangeFeed).
+type CachedUserRepository struct {
+	next UserRepository
+	cfg  UserCacheConfig
+
+	mu      sync.Mutex
+	lru     *list.List // of *cacheEntry, most recent first
+	byID    map[cacheKey]*list.Element
+	byEmail map[cacheEmailKey]domain.UserID
+}
+
+type cacheKey struct {
+	tenant string
+	id     domain.UserID
+}
+
+type cacheEmailKey struct {
+	tenant string
+	email  string
+}
+
+type cacheEntry struct {
+	key cacheKey
+	// user is nil for a tombstone.
+	user *domain.User
+	// minVersion rejects fills older than the last write seen until the
+	// entry expires. A write rolled back after it was seen leaves the
+	// stored version below minVersion, so it must not outlive TTL.
+	minVersion int
+	expires    time.Time
+}
+
+func NewCachedUserRepository(
+	next UserRepository,
+	cfg UserCacheConfig,
+) *CachedUserRepository {
+	return &CachedUserRepository{
+		next:    next,
+		cfg:     cfg,
+		lru:     list.New(),
+		byID:    make(map[cacheKey]*list.Element),
+		byEmail: make(map[cacheEmailKey]domain.UserID),
+	}
+}
+
+//
+// =========================
+// Reads
+// =========================
+//
+
+func (c *CachedUserRepository) GetByID(
+	ctx context.Context,
+	id domain.UserID,
+) (*domain.User, error) {
+
+	if inTx(ctx) || allTenants(ctx) {
+		return c.next.GetByID(ctx, id)
+	}
+
+	key := cacheKey{tenant: TenantFromContext(ctx), id: id}
+
+	if u, ok := c.lookup(key, "id"); ok {
+		return u, nil
+	}
+
+	u, err := c.next.GetByID(ctx, id)
+	if err != nil {
+		return c.stale(key, err)
+	}
+
+	c.put(key.tenant, u)
+	return u, nil
+}
+
+func (c *CachedUserRepository) GetByEmail(
+	ctx context.Context,
+	email string,
+) (*domain.User, error) {
+
+	if inTx(ctx) || allTenants(ctx) {
+		return c.next.GetByEmail(ctx, email)
+	}
+
+	tenant := TenantFromContext(ctx)
+	email = strings.ToLower(email)
+
+	c.mu.Lock()
+	id, known := c.byEmail[cacheEmailKey{tenant: tenant, email: email}]
+	c.mu.Unlock()
+
+	key := cacheKey{tenant: tenant, id: id}
+
+	if known {
+		// The entry must still be that active user with that email.
+		if u, ok := c.lookup(key, "email"); ok &&
+			u.DeletedAt() == nil && strings.ToLower(u.Email()) == email {
+			return u, nil
+		}
+	} else {
+		metrics.UserCacheMisses.WithLabelValues("email").Inc()
+	}
+
+	u, err := c.next.GetByEmail(ctx, email)
+	if err != nil {
+		if known {
+			return c.stale(key, err)
+		}
+		return nil, err
+	}
+
+	c.put(tenant, u)
+	return u, nil
+}
+
+func (c *CachedUserRepository) List(
+	ctx context.Context,
+	filter UserFilter,
+	cursor *Cursor,
+	limit int,
+) (*UserPage, error) {
+	return c.next.List(ctx, filter, cursor, limit)
+}
+
+func (c *CachedUserRepository) Count(
+	ctx context.Context,
+	filter UserFilter,
+) (int64, error) {
+	return c.next.Count(ctx, filter)
+}
+
+//
+// =========================
+// Writes
+// =========================
+//
+
+func (c *CachedUserRepository) Create(
+	ctx context.Context,
+	user *domain.User,
+) error {
+
+	if err := c.next.Create(ctx, user); err != nil {
+		return err
+	}
+
+	// The email may still map to a deleted user that held it.
+	c.mu.Lock()
+	delete(c.byEmail, cacheEmailKey{tenant: TenantFromContext(ctx), email: strings.ToLower(user.Email())})
+	c.mu.Unlock()
+
+	return nil
+}
+
+func (c *CachedUserRepository) Update(
+	ctx context.Context,
+	user *domain.User,
+) error {
+
+	if err := c.next.Update(ctx, user); err != nil {
+		return err
+	}
+
+	// Inside a transaction this happens before commit; a rollback
+	// only costs misses until the tombstone expires.
+	c.invalidate(cacheKey{tenant: TenantFromContext(ctx), id: user.ID()}, user.Version())
+	return nil
+}
+
+func (c *CachedUserRepository) UpsertByEmail(
+	ctx context.Context,
+	user *domain.User,
+) (*domain.User, UpsertOutcome, error) {
+
+	stored, outcome, err := c.next.UpsertByEmail(ctx, user)
+	if err != nil {
+		return nil, "", err
+	}
+
+	tenant := TenantFromContext(ctx)
+
+	switch outcome {
+	case UpsertCreated:
+		c.mu.Lock()
+		delete(c.byEmail, cacheEmailKey{tenant: tenant, email: strings.ToLower(stored.Email())})
+		c.mu.Unlock()
+	case UpsertUpdated:
+		c.invalidate(cacheKey{tenant: tenant, id: stored.ID()}, stored.Version())
+	}
+
+	return stored, outcome, nil
+}
+
+// Invalidate drops tenant's user id from the cache for writes that
+// bypass it. Reads of versions below version are not cached again.
+func (c *CachedUserRepository) Invalidate(tenant string, id domain.UserID, version int) {
+	c.invalidate(cacheKey{tenant: tenant, id: id}, version)
+}
+
+// Purge empties the cache, for when invalidations may have been missed
+// (a ChangeResync).
+func (c *CachedUserRepository) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lru.Init()
+	clear(c.byID)
+	clear(c.byEmail)
+}
+
+//
+// =========================
+// LRU
+// =========================
+//
+
+// lookup returns a fresh copy of the cached user.
+func (c *CachedUserRepository) lookup(key cacheKey, by string) (*domain.User, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.byID[key]
+	if !ok {
+		if by == "id" {
+			metrics.UserCacheMisses.WithLabelValues(by).Inc()
+		}
+		return nil, false
+	}
+
+	e := el.Value.(*cacheEntry)
+	if e.user == nil || time.Now().After(e.expires) {
+		metrics.UserCacheMisses.WithLabelValues(by).Inc()
+		return nil, false
+	}
+
+	c.lru.MoveToFront(el)
+	metrics.UserCacheHits.WithLabelValues(by).Inc()
+	return cloneUser(e.user), true
+}
+
+// stale serves an expired entry within StaleTTL when next failed for
+// any reason other than the user not existing.
+func (c *CachedUserRepository) stale(key cacheKey, err error) (*domain.User, error) {
+	if c.cfg.StaleTTL <= 0 || errors.Is(err, ErrUserNotFound) || errors.Is(err, context.Canceled) {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.byID[key]
+	if !ok {
+		return nil, err
+	}
+
+	e := el.Value.(*cacheEntry)
+	if e.user == nil || time.Now().After(e.expires.Add(c.cfg.StaleTTL)) {
+		return nil, err
+	}
+
+	metrics.UserCacheStale.Inc()
+	return cloneUser(e.user), nil
+}
+
+func (c *CachedUserRepository) put(tenant string, u *domain.User) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := cacheKey{tenant: tenant, id: u.ID()}
+	emailKey := cacheEmailKey{tenant: tenant, email: strings.ToLower(u.Email())}
+
+	if el, ok := c.byID[key]; ok {
+		e := el.Value.(*cacheEntry)
+		if u.Version() < e.minVersion && time.Now().Before(e.expires) {
+			return
+		}
+		c.unlinkEmailLocked(e)
+		e.user = cloneUser(u)
+		e.minVersion = u.Version()
+		e.expires = time.Now().Add(c.cfg.TTL)
+		c.byEmail[emailKey] = u.ID()
+		c.lru.MoveToFront(el)
+		return
+	}
+
+	c.insertLocked(&cacheEntry{
+		key:        key,
+		user:       cloneUser(u),
+		minVersion: u.Version(),
+		expires:    time.Now().Add(c.cfg.TTL),
+	})
+	c.byEmail[emailKey] = u.ID()
+}
+
+// invalidate replaces key's entry with a tombstone at version.
+func (c *CachedUserRepository) invalidate(key cacheKey, version int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.byID[key]; ok {
+		e := el.Value.(*cacheEntry)
+		c.unlinkEmailLocked(e)
+		e.user = nil
+		e.minVersion = max(e.minVersion, version)
+		e.expires = time.Now().Add(c.cfg.TTL)
+		return
+	}
+
+	c.insertLocked(&cacheEntry{
+		key:        key,
+		minVersion: version,
+		expires:    time.Now().Add(c.cfg.TTL),
+	})
+}
+
+// insertLocked adds e, evicting the least recently used entries beyond
+// Size. Caller must hold c.mu.
+func (c *CachedUserRepository) insertLocked(e *cacheEntry) {
+	c.byID[e.key] = c.lru.PushFront(e)
+
+	for c.lru.Len() > c.cfg.Size {
+		oldest := c.lru.Back()
+		evicted := c.lru.Remove(oldest).(*cacheEntry)
+		delete(c.byID, evicted.key)
+		c.unlinkEmailLocked(evicted)
+		metrics.UserCacheEvictions.Inc()
+	}
+}
+
+// unlinkEmailLocked removes e's email mapping if it still points at e.
+// Caller must hold c.mu.
+func (c *CachedUserRepository) unlinkEmailLocked(e *cacheEntry) {
+	if e.user == nil {
+		return
+	}
+	emailKey := cacheEmailKey{tenant: e.key.tenant, email: strings.ToLower(e.user.Email())}
+	if c.byEmail[emailKey] == e.key.id {
+		delete(c.byEmail, emailKey)
+	}
+}
+
+func cloneUser(u *domain.User) *domain.User {
+	return domain.RehydrateUser(
+		u.ID(),
+		u.Name(),
+		u.Email(),
+		u.Version(),
+		u.CreatedAt(),
+		u.UpdatedAt(),
+		copyTime(u.DeletedAt()),
+	)
+}
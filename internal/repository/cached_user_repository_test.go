@@ -0,0 +1,221 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-prod-app/internal/domain"
+	"go-prod-app/internal/repository"
+)
+
+// countingRepo counts the reads that reach the repository behind the
+// cache.
+type countingRepo struct {
+	repository.UserRepository
+
+	byID    int
+	byEmail int
+
+	// afterGet runs once, after the next GetByID has read the user and
+	// before the cache sees it.
+	afterGet func()
+}
+
+func (r *countingRepo) GetByID(ctx context.Context, id domain.UserID) (*domain.User, error) {
+	r.byID++
+	u, err := r.UserRepository.GetByID(ctx, id)
+	if f := r.afterGet; f != nil {
+		r.afterGet = nil
+		f()
+	}
+	return u, err
+}
+
+func (r *countingRepo) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
+	r.byEmail++
+	return r.UserRepository.GetByEmail(ctx, email)
+}
+
+func newCachedRepo(t *testing.T, ttl time.Duration) (*repository.CachedUserRepository, *countingRepo, *repository.MemoryUserRepository) {
+	t.Helper()
+
+	store := repository.NewMemoryUserRepository()
+	next := &countingRepo{UserRepository: store}
+	cache := repository.NewCachedUserRepository(next, repository.UserCacheConfig{Size: 10, TTL: ttl})
+	return cache, next, store
+}
+
+func createCached(t *testing.T, cache *repository.CachedUserRepository) *domain.User {
+	t.Helper()
+
+	u, err := domain.NewUser("Alice", "alice@example.com", time.Now().UTC())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Create(context.Background(), u); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	return u
+}
+
+// rename changes the stored user's name through cache, as another
+// request would.
+func rename(t *testing.T, ctx context.Context, cache *repository.CachedUserRepository, store repository.UserRepository, id domain.UserID, name string) {
+	t.Helper()
+
+	u, err := store.GetByID(ctx, id)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if err := u.ChangeName(name, time.Now().UTC()); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Update(ctx, u); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+}
+
+func TestCachedUserRepositoryHit(t *testing.T) {
+	cache, next, _ := newCachedRepo(t, time.Minute)
+	ctx := context.Background()
+	u := createCached(t, cache)
+
+	for range 3 {
+		got, err := cache.GetByID(ctx, u.ID())
+		if err != nil {
+			t.Fatalf("GetByID: %v", err)
+		}
+		if got.ID() != u.ID() {
+			t.Fatalf("GetByID = %s, want %s", got.ID(), u.ID())
+		}
+	}
+	if next.byID != 1 {
+		t.Errorf("GetByID reached the repository %d times, want 1", next.byID)
+	}
+
+	// filled by GetByID
+	if _, err := cache.GetByEmail(ctx, "Alice@Example.com"); err != nil {
+		t.Fatalf("GetByEmail: %v", err)
+	}
+	if next.byEmail != 0 {
+		t.Errorf("GetByEmail reached the repository %d times, want 0", next.byEmail)
+	}
+
+	// another tenant does not see the entry
+	other := repository.WithTenant(ctx, "acme")
+	if _, err := cache.GetByID(other, u.ID()); !errors.Is(err, repository.ErrUserNotFound) {
+		t.Errorf("GetByID from another tenant: err = %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestCachedUserRepositoryInvalidateOnWrite(t *testing.T) {
+	cache, _, store := newCachedRepo(t, time.Minute)
+	ctx := context.Background()
+	u := createCached(t, cache)
+
+	if _, err := cache.GetByID(ctx, u.ID()); err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+
+	rename(t, ctx, cache, store, u.ID(), "Alice Smith")
+
+	got, err := cache.GetByID(ctx, u.ID())
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if got.Name() != "Alice Smith" || got.Version() != 2 {
+		t.Errorf("after Update: name = %q, version = %d, want Alice Smith, 2", got.Name(), got.Version())
+	}
+
+	// external writes through Invalidate
+	u2, err := store.GetByID(ctx, u.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := u2.ChangeName("Alice Jones", time.Now().UTC()); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Update(ctx, u2); err != nil {
+		t.Fatal(err)
+	}
+	cache.Invalidate(repository.DefaultTenant, u.ID(), u2.Version())
+
+	got, err = cache.GetByID(ctx, u.ID())
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if got.Name() != "Alice Jones" {
+		t.Errorf("after Invalidate: name = %q, want Alice Jones", got.Name())
+	}
+}
+
+// A read that fetched version 1 before an Update finished must not put
+// version 1 back into the cache after it.
+func TestCachedUserRepositoryStaleFill(t *testing.T) {
+	cache, next, store := newCachedRepo(t, time.Minute)
+	ctx := context.Background()
+	u := createCached(t, cache)
+
+	next.afterGet = func() {
+		rename(t, ctx, cache, store, u.ID(), "Alice Smith")
+	}
+
+	got, err := cache.GetByID(ctx, u.ID())
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if got.Version() != 1 {
+		t.Fatalf("racing GetByID = version %d, want 1", got.Version())
+	}
+
+	got, err = cache.GetByID(ctx, u.ID())
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if got.Name() != "Alice Smith" || got.Version() != 2 {
+		t.Errorf("after the race: name = %q, version = %d, want Alice Smith, 2", got.Name(), got.Version())
+	}
+}
+
+// An Update rolled back after the cache saw it leaves a tombstone above
+// the stored version; once the tombstone expires the user is cached
+// again.
+func TestCachedUserRepositoryRollback(t *testing.T) {
+	const ttl = 20 * time.Millisecond
+
+	cache, next, store := newCachedRepo(t, ttl)
+	tx := repository.NewMemoryTxManager(store)
+	ctx := context.Background()
+	u := createCached(t, cache)
+
+	err := tx.WithinTx(ctx, func(ctx context.Context) error {
+		rename(t, ctx, cache, store, u.ID(), "Alice Smith")
+		return errors.New("roll back")
+	})
+	if err == nil {
+		t.Fatal("WithinTx did not fail")
+	}
+
+	got, err := cache.GetByID(ctx, u.ID())
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if got.Name() != "Alice" || got.Version() != 1 {
+		t.Errorf("after rollback: name = %q, version = %d, want Alice, 1", got.Name(), got.Version())
+	}
+
+	time.Sleep(2 * ttl)
+
+	for range 3 {
+		if _, err := cache.GetByID(ctx, u.ID()); err != nil {
+			t.Fatalf("GetByID: %v", err)
+		}
+	}
+
+	// one miss before the tombstone expired, one after, then hits
+	if next.byID != 2 {
+		t.Errorf("GetByID reached the repository %d times, want 2", next.byID)
+	}
+}
@@ -0,0 +1,205 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go-prod-app/internal/domain"
+	"go-prod-app/internal/metrics"
+
+	"github.com/lib/pq"
+)
+
+// UsersChangedChannel is the channel the users trigger notifies on
+// (migration 0007).
+const UsersChangedChannel = "users_changed"
+
+type ChangeOp string
+
+const (
+	ChangeInsert ChangeOp = "insert"
+	ChangeUpdate ChangeOp = "update"
+	ChangeDelete ChangeOp = "delete"
+	// ChangeResync means changes may have been missed (the connection
+	// was lost, or the subscriber fell behind). Subscribers should drop
+	// any state derived from earlier changes.
+	ChangeResync ChangeOp = "resync"
+)
+
+// UserChange is a committed change to a user row. Version is the
+// version after the change, or the last version for a delete (purge).
+// Soft deletes and restores are updates.
+type UserChange struct {
+	TenantID string        `json:"tenant_id"`
+	ID       domain.UserID `json:"id"`
+	Version  int           `json:"version"`
+	Op       ChangeOp      `json:"op"`
+}
+
+type ChangeFeedConfig struct {
+	// MinReconnect and MaxReconnect bound the delay between reconnect
+	// attempts after the connection is lost.
+	MinReconnect time.Duration
+	MaxReconnect time.Duration
+	// PingInterval checks an idle connection is still alive.
+	PingInterval time.Duration
+	// Buffer is the number of changes queued per subscriber.
+	Buffer int
+}
+
+func DefaultChangeFeedConfig() ChangeFeedConfig {
+	return ChangeFeedConfig{
+		MinReconnect: time.Second,
+		MaxReconnect: time.Minute,
+		PingInterval: 90 * time.Second,
+		Buffer:       256,
+	}
+}
+
+// ChangeFeed LISTENs for users_changed notifications and fans them out
+// to in-process subscribers, reconnecting when the connection drops.
+//
+// Delivery is best effort: Postgres drops notifications sent while the
+// feed is disconnected, and a subscriber that does not keep up loses
+// changes. Both are reported as a ChangeResync.
+type ChangeFeed struct {
+	dsn    string
+	cfg    ChangeFeedConfig
+	logger *slog.Logger
+
+	mu   sync.Mutex
+	subs map[*changeSubscriber]struct{}
+}
+
+type changeSubscriber struct {
+	ch chan UserChange
+	// lagged is set when a change was dropped; a resync is owed.
+	lagged bool
+}
+
+func NewChangeFeed(
+	dsn string,
+	cfg ChangeFeedConfig,
+	logger *slog.Logger,
+) *ChangeFeed {
+	return &ChangeFeed{
+		dsn:    dsn,
+		cfg:    cfg,
+		logger: logger,
+		subs:   make(map[*changeSubscriber]struct{}),
+	}
+}
+
+// Subscribe returns a channel of changes and a function that ends the
+// subscription and closes the channel.
+func (f *ChangeFeed) Subscribe() (<-chan UserChange, func()) {
+	sub := &changeSubscriber{ch: make(chan UserChange, f.cfg.Buffer)}
+
+	f.mu.Lock()
+	f.subs[sub] = struct{}{}
+	f.mu.Unlock()
+
+	var once sync.Once
+	return sub.ch, func() {
+		once.Do(func() {
+			f.mu.Lock()
+			delete(f.subs, sub)
+			f.mu.Unlock()
+			close(sub.ch)
+		})
+	}
+}
+
+// Run listens until ctx is cancelled.
+func (f *ChangeFeed) Run(ctx context.Context) {
+	f.logger.Info("change feed started")
+	defer f.logger.Info("change feed stopped")
+
+	listener := pq.NewListener(f.dsn, f.cfg.MinReconnect, f.cfg.MaxReconnect, f.event)
+	defer listener.Close()
+
+	if err := listener.Listen(UsersChangedChannel); err != nil {
+		// pq keeps the LISTEN and retries it once connected.
+		f.logger.Error("change feed listen failed", "error", err)
+	}
+
+	ping := time.NewTicker(f.cfg.PingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case n := <-listener.Notify:
+			// nil follows a reconnect: anything sent meanwhile is lost.
+			if n == nil {
+				f.publish(UserChange{Op: ChangeResync})
+				continue
+			}
+
+			var change UserChange
+			if err := json.Unmarshal([]byte(n.Extra), &change); err != nil {
+				f.logger.Error("change feed: bad notification", "payload", n.Extra, "error", err)
+				continue
+			}
+			f.publish(change)
+
+		case <-ping.C:
+			if err := listener.Ping(); err != nil {
+				f.logger.Warn("change feed ping failed", "error", err)
+			}
+		}
+	}
+}
+
+func (f *ChangeFeed) event(ev pq.ListenerEventType, err error) {
+	switch ev {
+	case pq.ListenerEventDisconnected:
+		f.logger.Warn("change feed disconnected", "error", err)
+	case pq.ListenerEventReconnected:
+		metrics.ChangeFeedReconnects.Inc()
+		f.logger.Info("change feed reconnected")
+	case pq.ListenerEventConnectionAttemptFailed:
+		f.logger.Warn("change feed connection attempt failed", "error", err)
+	}
+}
+
+// publish hands change to every subscriber without blocking. A full
+// subscriber loses the change and gets a ChangeResync once it has room.
+func (f *ChangeFeed) publish(change UserChange) {
+	metrics.ChangeFeedEvents.WithLabelValues(string(change.Op)).Inc()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for sub := range f.subs {
+		if sub.lagged {
+			if !sub.send(UserChange{Op: ChangeResync}) {
+				metrics.ChangeFeedDropped.Inc()
+				continue
+			}
+			sub.lagged = false
+			if change.Op == ChangeResync {
+				continue
+			}
+		}
+
+		if !sub.send(change) {
+			sub.lagged = true
+			metrics.ChangeFeedDropped.Inc()
+		}
+	}
+}
+
+func (s *changeSubscriber) send(change UserChange) bool {
+	select {
+	case s.ch <- change:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go-prod-app/internal/domain"
+	"go-prod-app/internal/metrics"
+)
+
+// InstrumentedUserRepository records the latency and errors of every
+// call to a UserRepository (repository_duration_seconds,
+// repository_errors_total). It wraps any implementation.
+type InstrumentedUserRepository struct {
+	next UserRepository
+}
+
+func NewInstrumentedUserRepository(next UserRepository) *InstrumentedUserRepository {
+	return &InstrumentedUserRepository{next: next}
+}
+
+func (r *InstrumentedUserRepository) Create(
+	ctx context.Context,
+	user *domain.User,
+) error {
+	defer observe("Create", time.Now())
+	return record("Create", r.next.Create(ctx, user))
+}
+
+func (r *InstrumentedUserRepository) Update(
+	ctx context.Context,
+	user *domain.User,
+) error {
+	defer observe("Update", time.Now())
+	return record("Update", r.next.Update(ctx, user))
+}
+
+func (r *InstrumentedUserRepository) UpsertByEmail(
+	ctx context.Context,
+	user *domain.User,
+) (*domain.User, UpsertOutcome, error) {
+	defer observe("UpsertByEmail", time.Now())
+	stored, outcome, err := r.next.UpsertByEmail(ctx, user)
+	return stored, outcome, record("UpsertByEmail", err)
+}
+
+func (r *InstrumentedUserRepository) GetByID(
+	ctx context.Context,
+	id domain.UserID,
+) (*domain.User, error) {
+	defer observe("GetByID", time.Now())
+	u, err := r.next.GetByID(ctx, id)
+	return u, record("GetByID", err)
+}
+
+func (r *InstrumentedUserRepository) GetByEmail(
+	ctx context.Context,
+	email string,
+) (*domain.User, error) {
+	defer observe("GetByEmail", time.Now())
+	u, err := r.next.GetByEmail(ctx, email)
+	return u, record("GetByEmail", err)
+}
+
+func (r *InstrumentedUserRepository) List(
+	ctx context.Context,
+	filter UserFilter,
+	cursor *Cursor,
+	limit int,
+) (*UserPage, error) {
+	defer observe("List", time.Now())
+	page, err := r.next.List(ctx, filter, cursor, limit)
+	return page, record("List", err)
+}
+
+func (r *InstrumentedUserRepository) Count(
+	ctx context.Context,
+	filter UserFilter,
+) (int64, error) {
+	defer observe("Count", time.Now())
+	n, err := r.next.Count(ctx, filter)
+	return n, record("Count", err)
+}
+
+func observe(method string, start time.Time) {
+	metrics.RepositoryDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+// record counts err under its sentinel and returns it unchanged.
+func record(method string, err error) error {
+	if err != nil {
+		metrics.RepositoryErrors.WithLabelValues(method, errorLabel(err)).Inc()
+	}
+	return err
+}
+
+func errorLabel(err error) string {
+	switch {
+	case errors.Is(err, ErrUserNotFound):
+		return "not_found"
+	case errors.Is(err, ErrDuplicateEmail):
+		return "duplicate"
+	case errors.Is(err, ErrVersionConflict):
+		return "conflict"
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,259 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryOutboxRepository is an in-process OutboxRepository.
+type MemoryOutboxRepository struct {
+	mu       sync.RWMutex
+	nextID   int64
+	messages map[int64]memoryOutboxMessage
+}
+
+type memoryOutboxMessage struct {
+	msg            OutboxMessage
+	nextAttemptAt  time.Time
+	lockedUntil    time.Time
+	lastError      string
+	publishedAt    *time.Time
+	deadLetteredAt *time.Time
+}
+
+func NewMemoryOutboxRepository() *MemoryOutboxRepository {
+	return &MemoryOutboxRepository{
+		messages: make(map[int64]memoryOutboxMessage),
+	}
+}
+
+func (r *MemoryOutboxRepository) Append(
+	ctx context.Context,
+	msg *OutboxMessage,
+) error {
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	msg.ID = r.nextID
+	msg.CreatedAt = time.Now().UTC()
+
+	stored := *msg
+	stored.Payload = append([]byte(nil), msg.Payload...)
+
+	r.messages[msg.ID] = memoryOutboxMessage{
+		msg:           stored,
+		nextAttemptAt: msg.CreatedAt,
+	}
+
+	return nil
+}
+
+func (r *MemoryOutboxRepository) ClaimPending(
+	ctx context.Context,
+	now time.Time,
+	leaseUntil time.Time,
+	limit int,
+) ([]*OutboxMessage, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var msgs []*OutboxMessage
+
+	for _, m := range r.messages {
+		if m.publishedAt != nil || m.deadLetteredAt != nil {
+			continue
+		}
+		if m.nextAttemptAt.After(now) || m.lockedUntil.After(now) {
+			continue
+		}
+		c := m.msg
+		c.LockedUntil = leaseUntil
+		msgs = append(msgs, &c)
+	}
+
+	sort.Slice(msgs, func(i, j int) bool {
+		return msgs[i].ID < msgs[j].ID
+	})
+
+	if len(msgs) > limit {
+		msgs = msgs[:limit]
+	}
+
+	for _, c := range msgs {
+		m := r.messages[c.ID]
+		m.lockedUntil = leaseUntil
+		r.messages[c.ID] = m
+	}
+
+	return msgs, nil
+}
+
+func (r *MemoryOutboxRepository) MarkPublished(
+	ctx context.Context,
+	id int64,
+	lease time.Time,
+	at time.Time,
+) error {
+	return r.update(ctx, id, lease, func(m *memoryOutboxMessage) {
+		m.msg.Attempts++
+		m.lastError = ""
+		m.publishedAt = &at
+		m.lockedUntil = time.Time{}
+	})
+}
+
+func (r *MemoryOutboxRepository) MarkFailed(
+	ctx context.Context,
+	id int64,
+	lease time.Time,
+	reason string,
+	nextAttempt time.Time,
+) error {
+	return r.update(ctx, id, lease, func(m *memoryOutboxMessage) {
+		m.msg.Attempts++
+		m.lastError = reason
+		m.nextAttemptAt = nextAttempt
+		m.lockedUntil = time.Time{}
+	})
+}
+
+func (r *MemoryOutboxRepository) MarkDeadLettered(
+	ctx context.Context,
+	id int64,
+	lease time.Time,
+	reason string,
+	at time.Time,
+) error {
+	return r.update(ctx, id, lease, func(m *memoryOutboxMessage) {
+		m.msg.Attempts++
+		m.lastError = reason
+		m.deadLetteredAt = &at
+		m.lockedUntil = time.Time{}
+	})
+}
+
+func (r *MemoryOutboxRepository) RedactPayloads(
+	ctx context.Context,
+	aggregateIDs []string,
+	keys []string,
+) error {
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	redact := make(map[string]bool, len(aggregateIDs))
+	for _, id := range aggregateIDs {
+		redact[id] = true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, m := range r.messages {
+		if !redact[m.msg.AggregateID] {
+			continue
+		}
+
+		var payload map[string]json.RawMessage
+		if err := json.Unmarshal(m.msg.Payload, &payload); err != nil {
+			return err
+		}
+		for _, key := range keys {
+			delete(payload, key)
+		}
+
+		redacted, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		m.msg.Payload = redacted
+		r.messages[id] = m
+	}
+
+	return nil
+}
+
+func (r *MemoryOutboxRepository) Stats(ctx context.Context) (OutboxStats, error) {
+	if err := ctx.Err(); err != nil {
+		return OutboxStats{}, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var s OutboxStats
+
+	for _, m := range r.messages {
+		switch {
+		case m.deadLetteredAt != nil:
+			s.DeadLettered++
+		case m.publishedAt == nil:
+			s.Pending++
+			if s.OldestPending == nil || m.msg.CreatedAt.Before(*s.OldestPending) {
+				t := m.msg.CreatedAt
+				s.OldestPending = &t
+			}
+		}
+	}
+
+	return s, nil
+}
+
+// update applies fn to message id if it is still leased until lease.
+func (r *MemoryOutboxRepository) update(
+	ctx context.Context,
+	id int64,
+	lease time.Time,
+	fn func(m *memoryOutboxMessage),
+) error {
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m, ok := r.messages[id]
+	if !ok || !m.lockedUntil.Equal(lease) {
+		return ErrLeaseLost
+	}
+
+	fn(&m)
+	r.messages[id] = m
+	return nil
+}
+
+// snapshot copies the current state and returns a func restoring it.
+// Used by MemoryTxManager for rollback.
+func (r *MemoryOutboxRepository) snapshot() func() {
+	r.mu.RLock()
+	nextID := r.nextID
+	saved := make(map[int64]memoryOutboxMessage, len(r.messages))
+	for id, m := range r.messages {
+		saved[id] = m
+	}
+	r.mu.RUnlock()
+
+	return func() {
+		r.mu.Lock()
+		r.nextID = nextID
+		r.messages = saved
+		r.mu.Unlock()
+	}
+}
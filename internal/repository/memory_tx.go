@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"sync"
+)
+
+// memoryStore is implemented by in-memory repositories that can take
+// part in a MemoryTxManager transaction.
+type memoryStore interface {
+	snapshot() (restore func())
+}
+
+type memoryTxKey struct{}
+
+// MemoryTxManager implements TxManager for the in-memory repositories.
+//
+// Transactions are serialized and rollback restores the state captured
+// when the transaction began. Isolation and read-only options are
+// accepted but have no effect: serialized execution is already the
+// strongest isolation. Writes made outside WithinTx while a transaction
+// rolls back are lost, so route every write through WithinTx.
+type MemoryTxManager struct {
+	mu     sync.Mutex
+	stores []memoryStore
+}
+
+func NewMemoryTxManager(stores ...memoryStore) *MemoryTxManager {
+	return &MemoryTxManager{stores: stores}
+}
+
+func (m *MemoryTxManager) WithinTx(
+	ctx context.Context,
+	fn func(ctx context.Context) error,
+	opts ...TxOption,
+) (err error) {
+
+	if ctx.Value(memoryTxKey{}) != nil {
+		return fn(ctx)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	restores := make([]func(), 0, len(m.stores))
+	for _, s := range m.stores {
+		restores = append(restores, s.snapshot())
+	}
+
+	rollback := func() {
+		for _, restore := range restores {
+			restore()
+		}
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(context.WithValue(ctx, memoryTxKey{}, true)); err != nil {
+		rollback()
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,810 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-prod-app/internal/domain"
+
+	"github.com/google/uuid"
+)
+
+// MemoryUserRepository is an in-process implementation of UserRepository.
+//
+// It follows the same contract as PostgresUserRepository and is meant
+// for local development and tests. Data is lost on restart.
+type MemoryUserRepository struct {
+	mu       sync.RWMutex
+	users    map[domain.UserID]memoryUser
+	versions map[domain.UserID][]memoryUserVersion
+}
+
+// memoryUser is the stored state of a user.
+// Stored by value so callers can never mutate repository state.
+type memoryUser struct {
+	tenant    string
+	id        domain.UserID
+	name      string
+	email     string
+	version   int
+	createdAt time.Time
+	updatedAt time.Time
+	deletedAt *time.Time
+}
+
+// memoryUserVersion is one entry of a user's history, oldest first.
+type memoryUserVersion struct {
+	user          memoryUser
+	changedBy     string
+	changedFields []string
+	changedAt     time.Time
+}
+
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{
+		users:    make(map[domain.UserID]memoryUser),
+		versions: make(map[domain.UserID][]memoryUserVersion),
+	}
+}
+
+//
+// =========================
+// Create
+// =========================
+// Repository owns ID + persistence metadata
+//
+
+func (r *MemoryUserRepository) Create(
+	ctx context.Context,
+	user *domain.User,
+) error {
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tenant := TenantFromContext(ctx)
+
+	if r.emailTakenLocked(tenant, user.Email(), "") {
+		return ErrDuplicateEmail
+	}
+
+	id := r.insertLocked(ctx, tenant, user, time.Now().UTC())
+
+	// Set ID only AFTER successful insert
+	return user.SetID(id)
+}
+
+// insertLocked stores user as a new user of tenant with its first
+// version. Caller must hold r.mu and have checked the email.
+func (r *MemoryUserRepository) insertLocked(
+	ctx context.Context,
+	tenant string,
+	user *domain.User,
+	now time.Time,
+) domain.UserID {
+
+	// UUID v7 → sortable by time
+	id := domain.UserID(uuid.Must(uuid.NewV7()).String())
+
+	stored := memoryUser{
+		tenant:    tenant,
+		id:        id,
+		name:      user.Name(),
+		email:     user.Email(),
+		version:   1, // initial version
+		createdAt: now,
+		updatedAt: now,
+	}
+
+	r.users[id] = stored
+	r.versions[id] = []memoryUserVersion{{
+		user:          stored,
+		changedBy:     ActorFromContext(ctx),
+		changedFields: []string{FieldName, FieldEmail},
+		changedAt:     now,
+	}}
+
+	return id
+}
+
+//
+// =========================
+// Update (Optimistic Lock)
+// Repository owns version + updated_at
+//
+
+func (r *MemoryUserRepository) Update(
+	ctx context.Context,
+	user *domain.User,
+) error {
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, ok := r.users[user.ID()]
+	if !ok || !inTenant(ctx, current.tenant) || current.version != user.Version() {
+		return ErrVersionConflict
+	}
+
+	if user.DeletedAt() == nil && r.emailTakenLocked(current.tenant, user.Email(), user.ID()) {
+		return ErrDuplicateEmail
+	}
+
+	old := current
+
+	current.name = user.Name()
+	current.email = user.Email()
+	current.version = user.Version() + 1
+	current.updatedAt = time.Now().UTC()
+	current.deletedAt = copyTime(user.DeletedAt())
+
+	r.users[user.ID()] = current
+	r.versions[user.ID()] = append(r.versions[user.ID()], memoryUserVersion{
+		user:          current,
+		changedBy:     ActorFromContext(ctx),
+		changedFields: changedFields(old, current),
+		changedAt:     current.updatedAt,
+	})
+
+	user.IncreaseVersion()
+	return nil
+}
+
+//
+// =========================
+// UpsertByEmail
+// =========================
+//
+
+func (r *MemoryUserRepository) UpsertByEmail(
+	ctx context.Context,
+	user *domain.User,
+) (*domain.User, UpsertOutcome, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UTC()
+	tenant := TenantFromContext(ctx)
+
+	for id, current := range r.users {
+		if current.tenant != tenant || current.deletedAt != nil || current.email != user.Email() {
+			continue
+		}
+
+		if current.name == user.Name() {
+			return current.toDomain(), UpsertUnchanged, nil
+		}
+
+		current.name = user.Name()
+		current.version++
+		current.updatedAt = now
+
+		r.users[id] = current
+		r.versions[id] = append(r.versions[id], memoryUserVersion{
+			user:          current,
+			changedBy:     ActorFromContext(ctx),
+			changedFields: []string{FieldName},
+			changedAt:     now,
+		})
+
+		return current.toDomain(), UpsertUpdated, nil
+	}
+
+	// UUID v7 → sortable by time
+	id := domain.UserID(uuid.Must(uuid.NewV7()).String())
+
+	stored := memoryUser{
+		tenant:    tenant,
+		id:        id,
+		name:      user.Name(),
+		email:     user.Email(),
+		version:   1, // initial version
+		createdAt: now,
+		updatedAt: now,
+	}
+
+	r.users[id] = stored
+	r.versions[id] = []memoryUserVersion{{
+		user:          stored,
+		changedBy:     ActorFromContext(ctx),
+		changedFields: []string{FieldName, FieldEmail},
+		changedAt:     now,
+	}}
+
+	return stored.toDomain(), UpsertCreated, nil
+}
+
+//
+// =========================
+// GetByID
+// Returns user even if soft-deleted
+//
+
+func (r *MemoryUserRepository) GetByID(
+	ctx context.Context,
+	id domain.UserID,
+) (*domain.User, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	u, ok := r.users[id]
+	if !ok || !inTenant(ctx, u.tenant) {
+		return nil, ErrUserNotFound
+	}
+
+	return u.toDomain(), nil
+}
+
+//
+// =========================
+// GetByEmail
+// Returns only active users
+//
+
+func (r *MemoryUserRepository) GetByEmail(
+	ctx context.Context,
+	email string,
+) (*domain.User, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	email = strings.ToLower(email)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, u := range r.users {
+		if u.email == email && u.deletedAt == nil && inTenant(ctx, u.tenant) {
+			return u.toDomain(), nil
+		}
+	}
+
+	return nil, ErrUserNotFound
+}
+
+//
+// =========================
+// List (Keyset Pagination)
+// Ordered by filter.Sort, then id (UUID v7 → time-ordered)
+//
+
+func (r *MemoryUserRepository) List(
+	ctx context.Context,
+	filter UserFilter,
+	cursor *Cursor,
+	limit int,
+) (*UserPage, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		return nil, fmt.Errorf("limit must be > 0")
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
+	}
+
+	sort, err := resolveSort(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateCursor(sort, cursor); err != nil {
+		return nil, err
+	}
+
+	var at listPosition
+	if cursor.positioned() {
+		at.id = cursor.ID
+		at.key, err = decodeSortValue(sort.Field, cursor.Key)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	r.mu.RLock()
+	matched := r.matchLocked(ctx, filter)
+	r.mu.RUnlock()
+
+	positions := make([]listPosition, len(matched))
+	for i, u := range matched {
+		du := u.toDomain()
+		var rank float64
+		if filter.Query != nil {
+			rank = queryRank(u, *filter.Query)
+		}
+		positions[i] = listPosition{
+			user: du,
+			id:   u.id,
+			key:  sortValue(sort.Field, du, rank),
+		}
+	}
+
+	// Walk in the direction of travel, like the reverse query in
+	// PostgresUserRepository.
+	desc := sort.Desc != cursor.backward()
+
+	slices.SortFunc(positions, func(a, b listPosition) int {
+		return a.compare(b, desc)
+	})
+
+	var (
+		users []*domain.User
+		keys  []interface{}
+	)
+
+	for _, p := range positions {
+		if cursor.positioned() && p.compare(at, desc) <= 0 {
+			continue
+		}
+
+		users = append(users, p.user)
+		keys = append(keys, p.key)
+
+		// one extra row tells whether more follow
+		if len(users) > limit {
+			break
+		}
+	}
+
+	return newUserPage(sort, cursor, limit, users, keys), nil
+}
+
+// listPosition is a user's place in List order: (key, id).
+type listPosition struct {
+	user *domain.User
+	key  interface{}
+	id   domain.UserID
+}
+
+// compare orders positions by key then id, both reversed when desc.
+func (p listPosition) compare(o listPosition, desc bool) int {
+	c := 0
+	if p.key != nil && o.key != nil {
+		c = compareSortValues(p.key, o.key)
+	}
+	if c == 0 {
+		c = strings.Compare(string(p.id), string(o.id))
+	}
+	if desc {
+		return -c
+	}
+	return c
+}
+
+//
+// =========================
+// Count
+// =========================
+//
+
+func (r *MemoryUserRepository) Count(
+	ctx context.Context,
+	filter UserFilter,
+) (int64, error) {
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return int64(len(r.matchLocked(ctx, filter))), nil
+}
+
+//
+// =========================
+// Export
+// Copies the matches, then streams them without the lock
+//
+
+func (r *MemoryUserRepository) Export(
+	ctx context.Context,
+	filter UserFilter,
+	afterID domain.UserID,
+	fn func(*domain.User) error,
+) error {
+
+	r.mu.RLock()
+	matched := r.matchLocked(ctx, filter)
+	r.mu.RUnlock()
+
+	slices.SortFunc(matched, func(a, b memoryUser) int {
+		return strings.Compare(string(a.id), string(b.id))
+	})
+
+	for _, u := range matched {
+		if u.id <= afterID {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(u.toDomain()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//
+// =========================
+// Import
+// Active emails are collected once instead of per user
+//
+
+func (r *MemoryUserRepository) Import(
+	ctx context.Context,
+	users []*domain.User,
+) ([]bool, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tenant := TenantFromContext(ctx)
+
+	taken := make(map[string]bool)
+	for _, u := range r.users {
+		if u.tenant == tenant && u.deletedAt == nil {
+			taken[u.email] = true
+		}
+	}
+
+	now := time.Now().UTC()
+	created := make([]bool, len(users))
+
+	for i, user := range users {
+		if taken[user.Email()] {
+			continue
+		}
+		taken[user.Email()] = true
+
+		if err := user.SetID(r.insertLocked(ctx, tenant, user, now)); err != nil {
+			return nil, err
+		}
+		created[i] = true
+	}
+
+	return created, nil
+}
+
+func (r *MemoryUserRepository) EmailsTaken(
+	ctx context.Context,
+	users []*domain.User,
+) ([]bool, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tenant := TenantFromContext(ctx)
+
+	active := make(map[string]bool)
+	for _, u := range r.users {
+		if u.tenant == tenant && u.deletedAt == nil {
+			active[u.email] = true
+		}
+	}
+
+	taken := make([]bool, len(users))
+	for i, user := range users {
+		taken[i] = active[user.Email()]
+	}
+
+	return taken, nil
+}
+
+func (r *MemoryUserRepository) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+//
+// =========================
+// Purge
+// =========================
+//
+
+func (r *MemoryUserRepository) PurgeDeleted(
+	ctx context.Context,
+	cutoff time.Time,
+	limit int,
+) ([]domain.UserID, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	candidates := r.purgeableLocked(ctx, cutoff)
+
+	// oldest deletion first
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].deletedAt.Before(*candidates[j].deletedAt)
+	})
+
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+
+	ids := make([]domain.UserID, 0, len(candidates))
+	for _, u := range candidates {
+		delete(r.users, u.id)
+		delete(r.versions, u.id)
+		ids = append(ids, u.id)
+	}
+
+	return ids, nil
+}
+
+func (r *MemoryUserRepository) CountPurgeable(
+	ctx context.Context,
+	cutoff time.Time,
+) (int64, error) {
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return int64(len(r.purgeableLocked(ctx, cutoff))), nil
+}
+
+// purgeableLocked returns users of ctx's tenant soft-deleted before
+// cutoff. Caller must hold r.mu.
+func (r *MemoryUserRepository) purgeableLocked(ctx context.Context, cutoff time.Time) []memoryUser {
+	var matched []memoryUser
+	for _, u := range r.users {
+		if inTenant(ctx, u.tenant) && u.deletedAt != nil && u.deletedAt.Before(cutoff) {
+			matched = append(matched, u)
+		}
+	}
+	return matched
+}
+
+//
+// =========================
+// History
+// =========================
+//
+
+func (r *MemoryUserRepository) ListVersions(
+	ctx context.Context,
+	id domain.UserID,
+	beforeVersion int,
+	limit int,
+) ([]*UserVersion, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		return nil, fmt.Errorf("limit must be > 0")
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	history := r.visibleVersionsLocked(ctx, id)
+
+	var versions []*UserVersion
+
+	for i := len(history) - 1; i >= 0 && len(versions) < limit; i-- {
+		v := history[i]
+		if beforeVersion > 0 && v.user.version >= beforeVersion {
+			continue
+		}
+		versions = append(versions, v.toUserVersion())
+	}
+
+	return versions, nil
+}
+
+func (r *MemoryUserRepository) GetAsOf(
+	ctx context.Context,
+	id domain.UserID,
+	t time.Time,
+) (*domain.User, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	history := r.visibleVersionsLocked(ctx, id)
+
+	for i := len(history) - 1; i >= 0; i-- {
+		if !history[i].changedAt.After(t) {
+			return history[i].user.toDomain(), nil
+		}
+	}
+
+	return nil, ErrUserNotFound
+}
+
+//
+// =========================
+// Helpers
+// =========================
+//
+
+// visibleVersionsLocked returns the history of id if the user belongs
+// to ctx's tenant. Caller must hold r.mu.
+func (r *MemoryUserRepository) visibleVersionsLocked(
+	ctx context.Context,
+	id domain.UserID,
+) []memoryUserVersion {
+	history := r.versions[id]
+	if len(history) == 0 || !inTenant(ctx, history[0].user.tenant) {
+		return nil
+	}
+	return history
+}
+
+// matchLocked returns the users of ctx's tenant matching filter.
+// Caller must hold r.mu.
+func (r *MemoryUserRepository) matchLocked(ctx context.Context, filter UserFilter) []memoryUser {
+	var email string
+	if filter.Email != nil {
+		email = strings.ToLower(*filter.Email)
+	}
+
+	var matched []memoryUser
+
+	for _, u := range r.users {
+		if !inTenant(ctx, u.tenant) {
+			continue
+		}
+		if filter.OnlyDeleted && u.deletedAt == nil {
+			continue
+		}
+		if !filter.OnlyDeleted && !filter.IncludeDeleted && u.deletedAt != nil {
+			continue
+		}
+		if filter.Email != nil && u.email != email {
+			continue
+		}
+		if filter.CreatedAfter != nil && !u.createdAt.After(*filter.CreatedAfter) {
+			continue
+		}
+		if filter.CreatedBefore != nil && !u.createdAt.Before(*filter.CreatedBefore) {
+			continue
+		}
+		if filter.Query != nil && !matchesQuery(u, *filter.Query) {
+			continue
+		}
+		matched = append(matched, u)
+	}
+
+	return matched
+}
+
+// emailTakenLocked mirrors the partial unique index on
+// users(tenant_id, lower(email)): only active users hold their email,
+// within their tenant. Caller must hold r.mu.
+func (r *MemoryUserRepository) emailTakenLocked(
+	tenant string,
+	email string,
+	except domain.UserID,
+) bool {
+	for _, u := range r.users {
+		if u.tenant == tenant && u.id != except && u.deletedAt == nil && u.email == email {
+			return true
+		}
+	}
+	return false
+}
+
+func (v memoryUserVersion) toUserVersion() *UserVersion {
+	return &UserVersion{
+		User:          v.user.toDomain(),
+		ChangedBy:     v.changedBy,
+		ChangedFields: append([]string(nil), v.changedFields...),
+		ChangedAt:     v.changedAt,
+	}
+}
+
+func (u memoryUser) toDomain() *domain.User {
+	return domain.RehydrateUser(
+		u.id,
+		u.name,
+		u.email,
+		u.version,
+		u.createdAt,
+		u.updatedAt,
+		copyTime(u.deletedAt),
+	)
+}
+
+func changedFields(old, updated memoryUser) []string {
+	fields := []string{}
+
+	if old.name != updated.name {
+		fields = append(fields, FieldName)
+	}
+	if old.email != updated.email {
+		fields = append(fields, FieldEmail)
+	}
+	if (old.deletedAt == nil) != (updated.deletedAt == nil) ||
+		(old.deletedAt != nil && !old.deletedAt.Equal(*updated.deletedAt)) {
+		fields = append(fields, FieldDeletedAt)
+	}
+
+	return fields
+}
+
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	return &c
+}
+
+// snapshot copies the current state and returns a func restoring it.
+// Used by MemoryTxManager for rollback.
+func (r *MemoryUserRepository) snapshot() func() {
+	r.mu.RLock()
+	saved := make(map[domain.UserID]memoryUser, len(r.users))
+	for id, u := range r.users {
+		saved[id] = u
+	}
+	// Versions are append-only: keeping the slice headers is enough.
+	savedVersions := make(map[domain.UserID][]memoryUserVersion, len(r.versions))
+	for id, v := range r.versions {
+		savedVersions[id] = v
+	}
+	r.mu.RUnlock()
+
+	return func() {
+		r.mu.Lock()
+		r.users = saved
+		r.versions = savedVersions
+		r.mu.Unlock()
+	}
+}
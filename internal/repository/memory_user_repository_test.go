@@ -0,0 +1,14 @@
+package repository_test
+
+import (
+	"testing"
+
+	"go-prod-app/internal/repository"
+	"go-prod-app/internal/repository/repotest"
+)
+
+func TestMemoryUserRepository(t *testing.T) {
+	repotest.TestUserRepository(t, func(t *testing.T) repotest.Repository {
+		return repository.NewMemoryUserRepository()
+	})
+}
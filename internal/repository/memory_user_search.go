@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"go-prod-app/internal/domain"
+)
+
+// wordSimilarityThreshold mirrors pg_trgm.word_similarity_threshold.
+const wordSimilarityThreshold = 0.6
+
+func (r *MemoryUserRepository) Suggest(
+	ctx context.Context,
+	q string,
+	limit int,
+) ([]*domain.User, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		return nil, fmt.Errorf("limit must be > 0")
+	}
+
+	r.mu.RLock()
+	matched := r.matchLocked(ctx, UserFilter{Query: &q})
+	r.mu.RUnlock()
+
+	sortByRank(matched, q)
+
+	if len(matched) > limit {
+		matched = matched[:limit]
+	}
+
+	users := make([]*domain.User, 0, len(matched))
+	for _, u := range matched {
+		users = append(users, u.toDomain())
+	}
+
+	return users, nil
+}
+
+//
+// =========================
+// Trigram Matching
+// =========================
+// An approximation of pg_trgm, close enough for local development
+//
+
+func matchesQuery(u memoryUser, q string) bool {
+	if strings.Contains(strings.ToLower(u.name), strings.ToLower(q)) {
+		return true
+	}
+	return queryRank(u, q) >= wordSimilarityThreshold
+}
+
+// queryRank is 1 for an exact email match, else the share of the
+// query's trigrams found in the name.
+func queryRank(u memoryUser, q string) float64 {
+	if u.email == domain.NormalizeEmail(q) {
+		return 1
+	}
+	return wordSimilarity(q, u.name)
+}
+
+func wordSimilarity(q, text string) float64 {
+	qt := trigrams(q)
+	if len(qt) == 0 {
+		return 0
+	}
+
+	tt := trigrams(text)
+
+	common := 0
+	for t := range qt {
+		if _, ok := tt[t]; ok {
+			common++
+		}
+	}
+
+	return float64(common) / float64(len(qt))
+}
+
+// trigrams extracts pg_trgm style trigrams: lower-cased alphanumeric
+// words padded with two leading spaces and one trailing space.
+func trigrams(s string) map[string]struct{} {
+	set := make(map[string]struct{})
+
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for _, w := range words {
+		padded := []rune("  " + w + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			set[string(padded[i:i+3])] = struct{}{}
+		}
+	}
+
+	return set
+}
+
+// sortByRank orders users by (rank DESC, id ASC).
+func sortByRank(users []memoryUser, q string) {
+	sort.Slice(users, func(i, j int) bool {
+		ri, rj := queryRank(users[i], q), queryRank(users[j], q)
+		if ri != rj {
+			return ri > rj
+		}
+		return users[i].id < users[j].id
+	})
+}
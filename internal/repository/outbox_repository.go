@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrLeaseLost is returned when a message's lease ran out and another
+// claim took the message over before the outcome was recorded.
+var ErrLeaseLost = errors.New("outbox lease lost")
+
+//
+// =========
+// Outbox
+// =========
+//
+
+// OutboxMessage is an event waiting to be delivered to downstream systems.
+type OutboxMessage struct {
+	ID          int64
+	EventID     string
+	AggregateID string
+	EventType   string
+	Payload     []byte // JSON
+	CreatedAt   time.Time
+	Attempts    int
+	// LockedUntil is the lease ClaimPending took; recording an outcome
+	// requires it to still be held.
+	LockedUntil time.Time
+}
+
+// OutboxStats describes the undelivered backlog.
+type OutboxStats struct {
+	Pending      int64
+	DeadLettered int64
+	// OldestPending is the CreatedAt of the oldest undelivered message,
+	// nil when the backlog is empty.
+	OldestPending *time.Time
+}
+
+type OutboxRepository interface {
+	// Append stores a message.
+	// Call it inside the transaction of the change it describes, so the
+	// message exists if and only if the change is committed.
+	Append(ctx context.Context, msg *OutboxMessage) error
+
+	// ClaimPending leases up to limit undelivered messages that are due
+	// at now, ordered by ID, until leaseUntil and returns them. Messages
+	// leased by another relay are skipped until their lease runs out.
+	// The lease is committed before it returns: call it outside a
+	// transaction, so nothing is held open while the messages are
+	// published.
+	ClaimPending(ctx context.Context, now, leaseUntil time.Time, limit int) ([]*OutboxMessage, error)
+
+	// The Mark methods record the outcome of a claimed message and end
+	// its lease. lease is the message's LockedUntil: when the message is
+	// no longer leased until exactly then, another claim owns it and
+	// they fail with ErrLeaseLost, recording nothing.
+
+	// MarkPublished records successful delivery.
+	MarkPublished(ctx context.Context, id int64, lease time.Time, at time.Time) error
+
+	// MarkFailed records a failed attempt and schedules the next one.
+	MarkFailed(ctx context.Context, id int64, lease time.Time, reason string, nextAttempt time.Time) error
+
+	// MarkDeadLettered gives up on a message. It is kept for inspection
+	// but never claimed again.
+	MarkDeadLettered(ctx context.Context, id int64, lease time.Time, reason string, at time.Time) error
+
+	// RedactPayloads removes keys from the payloads of every message
+	// about the aggregates, delivered or not. Call it inside the
+	// transaction that erases them.
+	RedactPayloads(ctx context.Context, aggregateIDs []string, keys []string) error
+
+	// Stats reports the size and age of the backlog.
+	Stats(ctx context.Context) (OutboxStats, error)
+}
@@ -0,0 +1,113 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-prod-app/internal/repository"
+	"go-prod-app/internal/repository/repotest"
+
+	"github.com/google/uuid"
+)
+
+func TestMemoryOutboxLease(t *testing.T) {
+	testOutboxLease(t, repository.NewMemoryOutboxRepository())
+}
+
+// Runs against the database in TEST_DB_DSN; skipped without it.
+func TestPostgresOutboxLease(t *testing.T) {
+	db := repotest.OpenPostgres(t)
+	if _, err := db.Exec(`TRUNCATE outbox`); err != nil {
+		t.Fatalf("truncate outbox: %v", err)
+	}
+	testOutboxLease(t, repository.NewPostgresOutboxRepository(db))
+}
+
+// testOutboxLease lets a lease run out while its relay is still
+// publishing: another relay reclaims the message, and only the new
+// lease can record an outcome.
+func testOutboxLease(t *testing.T, store repository.OutboxRepository) {
+	ctx := context.Background()
+
+	id := uuid.NewString()
+	if err := store.Append(ctx, &repository.OutboxMessage{
+		EventID:     uuid.NewString(),
+		AggregateID: id,
+		EventType:   "user.created",
+		Payload:     []byte(`{"id":"` + id + `","name":"Alice"}`),
+	}); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+
+	// due now; Postgres keeps microseconds
+	t0 := time.Now().UTC().Add(time.Second).Truncate(time.Millisecond)
+
+	claim := func(now time.Time, lease time.Duration) []*repository.OutboxMessage {
+		t.Helper()
+		msgs, err := store.ClaimPending(ctx, now, now.Add(lease), 10)
+		if err != nil {
+			t.Fatalf("ClaimPending: %v", err)
+		}
+		return msgs
+	}
+
+	first := claim(t0, time.Minute)
+	if len(first) != 1 {
+		t.Fatalf("claimed %d messages, want 1", len(first))
+	}
+	if !first[0].LockedUntil.Equal(t0.Add(time.Minute)) {
+		t.Errorf("LockedUntil = %v, want %v", first[0].LockedUntil, t0.Add(time.Minute))
+	}
+
+	if msgs := claim(t0.Add(30*time.Second), time.Minute); len(msgs) != 0 {
+		t.Errorf("claimed %d leased messages, want 0", len(msgs))
+	}
+
+	// the first lease ran out: another relay takes the message over
+	second := claim(t0.Add(2*time.Minute), time.Minute)
+	if len(second) != 1 || second[0].ID != first[0].ID {
+		t.Fatalf("reclaimed %v, want message %d", second, first[0].ID)
+	}
+
+	if err := store.MarkPublished(ctx, first[0].ID, first[0].LockedUntil, t0); !errors.Is(err, repository.ErrLeaseLost) {
+		t.Errorf("MarkPublished with the expired lease: err = %v, want ErrLeaseLost", err)
+	}
+	if err := store.MarkDeadLettered(ctx, first[0].ID, first[0].LockedUntil, "boom", t0); !errors.Is(err, repository.ErrLeaseLost) {
+		t.Errorf("MarkDeadLettered with the expired lease: err = %v, want ErrLeaseLost", err)
+	}
+
+	stats, err := store.Stats(ctx)
+	if err != nil {
+		t.Fatalf("Stats: %v", err)
+	}
+	if stats.Pending != 1 || stats.DeadLettered != 0 {
+		t.Errorf("stats = %+v, want 1 pending", stats)
+	}
+
+	// the new owner records a failure and retries later
+	next := t0.Add(10 * time.Minute)
+	if err := store.MarkFailed(ctx, second[0].ID, second[0].LockedUntil, "boom", next); err != nil {
+		t.Fatalf("MarkFailed: %v", err)
+	}
+	if err := store.MarkPublished(ctx, second[0].ID, second[0].LockedUntil, t0); !errors.Is(err, repository.ErrLeaseLost) {
+		t.Errorf("MarkPublished after the lease ended: err = %v, want ErrLeaseLost", err)
+	}
+
+	if msgs := claim(t0.Add(5*time.Minute), time.Minute); len(msgs) != 0 {
+		t.Errorf("claimed %d messages before their next attempt, want 0", len(msgs))
+	}
+
+	third := claim(next, time.Minute)
+	if len(third) != 1 || third[0].Attempts != 1 {
+		t.Fatalf("claimed %v at the next attempt, want the message with 1 attempt", third)
+	}
+	if err := store.MarkPublished(ctx, third[0].ID, third[0].LockedUntil, next); err != nil {
+		t.Fatalf("MarkPublished: %v", err)
+	}
+
+	if msgs := claim(next.Add(time.Hour), time.Minute); len(msgs) != 0 {
+		t.Errorf("claimed %d published messages, want 0", len(msgs))
+	}
+}
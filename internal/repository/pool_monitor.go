@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+type PoolMonitorConfig struct {
+	// Interval is the time between db.Stats() samples.
+	Interval time.Duration
+	// Window is how long the pool must stay saturated before it is
+	// reported; short bursts are normal.
+	Window time.Duration
+}
+
+func DefaultPoolMonitorConfig() PoolMonitorConfig {
+	return PoolMonitorConfig{
+		Interval: time.Second,
+		Window:   30 * time.Second,
+	}
+}
+
+// PoolMonitor watches a connection pool for sustained saturation: every
+// connection in use, or callers waiting for one, on every sample
+// throughout Window.
+type PoolMonitor struct {
+	db  *sql.DB
+	cfg PoolMonitorConfig
+
+	mu        sync.Mutex
+	waitCount int64
+	since     time.Time // start of the current saturated streak
+}
+
+func NewPoolMonitor(db *sql.DB, cfg PoolMonitorConfig) *PoolMonitor {
+	return &PoolMonitor{db: db, cfg: cfg}
+}
+
+// Run samples the pool every Interval until ctx is cancelled.
+func (m *PoolMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		m.sample(time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *PoolMonitor) sample(now time.Time) {
+	stats := m.db.Stats()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	full := stats.MaxOpenConnections > 0 && stats.InUse >= stats.MaxOpenConnections
+	waited := stats.WaitCount > m.waitCount
+	m.waitCount = stats.WaitCount
+
+	switch {
+	case !full && !waited:
+		m.since = time.Time{}
+	case m.since.IsZero():
+		m.since = now
+	}
+}
+
+// Saturated reports whether the pool has been saturated for at least
+// Window.
+func (m *PoolMonitor) Saturated() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return !m.since.IsZero() && time.Since(m.since) >= m.cfg.Window
+}
@@ -0,0 +1,250 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type PostgresOutboxRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresOutboxRepository(db *sql.DB) *PostgresOutboxRepository {
+	return &PostgresOutboxRepository{db: db}
+}
+
+//
+// =========================
+// Append
+// =========================
+//
+
+func (r *PostgresOutboxRepository) Append(
+	ctx context.Context,
+	msg *OutboxMessage,
+) error {
+
+	query := `
+		INSERT INTO outbox (
+			event_id, aggregate_id, event_type, payload, created_at
+		)
+		VALUES ($1,$2,$3,$4,$5)
+		RETURNING id, created_at
+	`
+
+	return conn(ctx, r.db).QueryRowContext(
+		ctx,
+		query,
+		msg.EventID,
+		msg.AggregateID,
+		msg.EventType,
+		msg.Payload,
+		time.Now().UTC(),
+	).Scan(&msg.ID, &msg.CreatedAt)
+}
+
+//
+// =========================
+// ClaimPending
+// Leased in one statement → committed before anything is published
+//
+
+func (r *PostgresOutboxRepository) ClaimPending(
+	ctx context.Context,
+	now time.Time,
+	leaseUntil time.Time,
+	limit int,
+) ([]*OutboxMessage, error) {
+
+	// SKIP LOCKED only keeps two relays claiming at the same moment
+	// apart; the lease keeps them apart while the messages are published.
+	query := `
+		UPDATE outbox
+		SET locked_until = $2
+		WHERE id IN (
+			SELECT id
+			FROM outbox
+			WHERE published_at IS NULL
+			  AND dead_lettered_at IS NULL
+			  AND next_attempt_at <= $1
+			  AND (locked_until IS NULL OR locked_until <= $1)
+			ORDER BY id ASC
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, event_id, aggregate_id, event_type,
+		          payload, created_at, attempts, locked_until
+	`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, now, leaseUntil, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var msgs []*OutboxMessage
+
+	for rows.Next() {
+		var m OutboxMessage
+		if err := rows.Scan(
+			&m.ID,
+			&m.EventID,
+			&m.AggregateID,
+			&m.EventType,
+			&m.Payload,
+			&m.CreatedAt,
+			&m.Attempts,
+			&m.LockedUntil,
+		); err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, &m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// RETURNING does not keep the subquery's order.
+	sort.Slice(msgs, func(i, j int) bool {
+		return msgs[i].ID < msgs[j].ID
+	})
+
+	return msgs, nil
+}
+
+//
+// =========================
+// Delivery Bookkeeping
+// locked_until = lease: only the claim that holds the lease records
+// The lease is compared as RETURNING gave it, at the column's precision
+//
+
+func (r *PostgresOutboxRepository) MarkPublished(
+	ctx context.Context,
+	id int64,
+	lease time.Time,
+	at time.Time,
+) error {
+
+	return r.mark(ctx, `
+		UPDATE outbox
+		SET published_at = $3,
+		    attempts = attempts + 1,
+		    last_error = NULL,
+		    locked_until = NULL
+		WHERE id = $1
+		  AND locked_until = $2
+	`, id, lease, at)
+}
+
+func (r *PostgresOutboxRepository) MarkFailed(
+	ctx context.Context,
+	id int64,
+	lease time.Time,
+	reason string,
+	nextAttempt time.Time,
+) error {
+
+	return r.mark(ctx, `
+		UPDATE outbox
+		SET attempts = attempts + 1,
+		    last_error = $3,
+		    next_attempt_at = $4,
+		    locked_until = NULL
+		WHERE id = $1
+		  AND locked_until = $2
+	`, id, lease, reason, nextAttempt)
+}
+
+func (r *PostgresOutboxRepository) MarkDeadLettered(
+	ctx context.Context,
+	id int64,
+	lease time.Time,
+	reason string,
+	at time.Time,
+) error {
+
+	return r.mark(ctx, `
+		UPDATE outbox
+		SET attempts = attempts + 1,
+		    last_error = $3,
+		    dead_lettered_at = $4,
+		    locked_until = NULL
+		WHERE id = $1
+		  AND locked_until = $2
+	`, id, lease, reason, at)
+}
+
+// mark runs one of the Mark statements, which take the message ID and
+// the lease as $1 and $2.
+func (r *PostgresOutboxRepository) mark(
+	ctx context.Context,
+	query string,
+	args ...any,
+) error {
+
+	res, err := conn(ctx, r.db).ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+//
+// =========================
+// RedactPayloads
+// =========================
+//
+
+func (r *PostgresOutboxRepository) RedactPayloads(
+	ctx context.Context,
+	aggregateIDs []string,
+	keys []string,
+) error {
+
+	if len(aggregateIDs) == 0 || len(keys) == 0 {
+		return nil
+	}
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, `
+		UPDATE outbox
+		SET payload = payload - $2::text[]
+		WHERE aggregate_id = ANY($1::uuid[])
+		  AND payload ?| $2::text[]
+	`, pq.Array(aggregateIDs), pq.Array(keys))
+
+	return err
+}
+
+//
+// =========================
+// Stats
+// =========================
+//
+
+func (r *PostgresOutboxRepository) Stats(ctx context.Context) (OutboxStats, error) {
+	var s OutboxStats
+
+	err := conn(ctx, r.db).QueryRowContext(ctx, `
+		SELECT
+			COUNT(*) FILTER (WHERE published_at IS NULL AND dead_lettered_at IS NULL),
+			COUNT(*) FILTER (WHERE dead_lettered_at IS NOT NULL),
+			MIN(created_at) FILTER (WHERE published_at IS NULL AND dead_lettered_at IS NULL)
+		FROM outbox
+	`).Scan(&s.Pending, &s.DeadLettered, &s.OldestPending)
+
+	return s, err
+}
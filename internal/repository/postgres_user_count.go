@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+//
+// =========================
+// EstimateCount
+// Planner statistics, no scan
+//
+
+func (r *PostgresUserRepository) EstimateCount(
+	ctx context.Context,
+	filter UserFilter,
+) (int64, error) {
+
+	// The planner's row estimate for the matching query. The conditions
+	// always include the tenant and, unless deleted users are counted,
+	// deleted_at, so the table-wide pg_class.reltuples would overcount.
+	conditions, args := r.filterConditions(ctx, filter)
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	query := fmt.Sprintf(`EXPLAIN (FORMAT JSON) SELECT 1 FROM users %s`, where)
+
+	raw, err := withSession(ctx, r.reader(ctx), func(q dbtx) ([]byte, error) {
+		var raw []byte
+		err := q.QueryRowContext(ctx, query, args...).Scan(&raw)
+		return raw, err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var plan []struct {
+		Plan struct {
+			Rows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal(raw, &plan); err != nil {
+		return 0, fmt.Errorf("parse explain output: %w", err)
+	}
+	if len(plan) == 0 {
+		return 0, fmt.Errorf("parse explain output: no plan")
+	}
+
+	return int64(plan[0].Plan.Rows), nil
+}
@@ -0,0 +1,271 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"go-prod-app/internal/domain"
+
+	"github.com/lib/pq"
+)
+
+//
+// =========================
+// Email Encryption
+// =========================
+// users.email_ciphertext holds the envelope, bound to the user ID;
+// users.email_hash is the blind index every email lookup goes through.
+// user_versions copies the envelope of the users row.
+//
+
+// sealedEmail is an email as stored.
+type sealedEmail struct {
+	ciphertext []byte
+	hash       []byte
+	keyID      string
+}
+
+func (r *PostgresUserRepository) sealEmail(
+	id string,
+	email string,
+) (sealedEmail, error) {
+
+	ciphertext, err := r.emails.Encrypt([]byte(email), []byte(id))
+	if err != nil {
+		return sealedEmail{}, fmt.Errorf("encrypt email: %w", err)
+	}
+
+	return sealedEmail{
+		ciphertext: ciphertext,
+		hash:       r.emailHash(email),
+		keyID:      r.emails.ActiveKeyID(),
+	}, nil
+}
+
+func (r *PostgresUserRepository) openEmail(id string, ciphertext []byte) (string, error) {
+	if ciphertext == nil {
+		return "", fmt.Errorf("user %s: email is not encrypted, run `app reencrypt`", id)
+	}
+
+	email, err := r.emails.Decrypt(ciphertext, []byte(id))
+	if err != nil {
+		return "", fmt.Errorf("user %s: decrypt email: %w", id, err)
+	}
+	return string(email), nil
+}
+
+// emailHash is the blind index of email as the domain normalizes it.
+func (r *PostgresUserRepository) emailHash(email string) []byte {
+	return r.emails.BlindIndex(domain.NormalizeEmail(email))
+}
+
+//
+// =========================
+// ReencryptEmails
+// Stale users rows first, then user_versions
+// Callers work across tenants (WithAllTenants)
+//
+
+func (r *PostgresUserRepository) ReencryptEmails(
+	ctx context.Context,
+	limit int,
+) (int, error) {
+
+	if limit <= 0 {
+		return 0, fmt.Errorf("limit must be > 0")
+	}
+
+	return withSession(ctx, conn(ctx, r.db), func(q dbtx) (int, error) {
+		users, err := r.reencryptUsers(ctx, q, limit)
+		if err != nil || users == limit {
+			return users, err
+		}
+
+		versions, err := r.reencryptVersions(ctx, q, limit-users)
+		return users + versions, err
+	})
+}
+
+func (r *PostgresUserRepository) reencryptUsers(
+	ctx context.Context,
+	q dbtx,
+	limit int,
+) (int, error) {
+
+	// SKIP LOCKED: a user being written right now gets the active key
+	// from that write
+	rows, err := q.QueryContext(ctx, `
+		SELECT id, email, email_ciphertext
+		FROM users
+		WHERE (email_key_id IS NULL OR email_key_id <> $1)
+		  AND `+tenantCondition(3)+`
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED
+	`, r.emails.ActiveKeyID(), limit, tenantParam(ctx))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var (
+		ids         []string
+		ciphertexts [][]byte
+		hashes      [][]byte
+	)
+
+	for rows.Next() {
+		var (
+			id         string
+			plaintext  *string
+			ciphertext []byte
+		)
+
+		if err := rows.Scan(&id, &plaintext, &ciphertext); err != nil {
+			return 0, err
+		}
+
+		sealed, err := r.resealEmail(id, plaintext, ciphertext)
+		if err != nil {
+			return 0, err
+		}
+
+		ids = append(ids, id)
+		ciphertexts = append(ciphertexts, sealed.ciphertext)
+		hashes = append(hashes, sealed.hash)
+	}
+
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	// version and updated_at stay: the user did not change
+	_, err = q.ExecContext(ctx, `
+		UPDATE users u
+		SET email = NULL,
+			email_ciphertext = s.ciphertext,
+			email_hash = s.hash,
+			email_key_id = $1
+		FROM unnest($2::uuid[], $3::bytea[], $4::bytea[]) AS s(id, ciphertext, hash)
+		WHERE u.id = s.id
+	`, r.emails.ActiveKeyID(), pq.Array(ids), pq.Array(ciphertexts), pq.Array(hashes))
+	if err != nil {
+		return 0, err
+	}
+
+	return len(ids), nil
+}
+
+func (r *PostgresUserRepository) reencryptVersions(
+	ctx context.Context,
+	q dbtx,
+	limit int,
+) (int, error) {
+
+	rows, err := q.QueryContext(ctx, `
+		SELECT user_id, version, email, email_ciphertext
+		FROM user_versions
+		WHERE (email_key_id IS NULL OR email_key_id <> $1)
+		  AND `+tenantCondition(3)+`
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED
+	`, r.emails.ActiveKeyID(), limit, tenantParam(ctx))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var (
+		ids         []string
+		versions    []int64
+		ciphertexts [][]byte
+	)
+
+	for rows.Next() {
+		var (
+			id         string
+			version    int64
+			plaintext  *string
+			ciphertext []byte
+		)
+
+		if err := rows.Scan(&id, &version, &plaintext, &ciphertext); err != nil {
+			return 0, err
+		}
+
+		sealed, err := r.resealEmail(id, plaintext, ciphertext)
+		if err != nil {
+			return 0, err
+		}
+
+		ids = append(ids, id)
+		versions = append(versions, version)
+		ciphertexts = append(ciphertexts, sealed.ciphertext)
+	}
+
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	_, err = q.ExecContext(ctx, `
+		UPDATE user_versions v
+		SET email = NULL,
+			email_ciphertext = s.ciphertext,
+			email_key_id = $1
+		FROM unnest($2::uuid[], $3::int[], $4::bytea[]) AS s(user_id, version, ciphertext)
+		WHERE v.user_id = s.user_id
+		  AND v.version = s.version
+	`, r.emails.ActiveKeyID(), pq.Array(ids), pq.Array(versions), pq.Array(ciphertexts))
+	if err != nil {
+		return 0, err
+	}
+
+	return len(ids), nil
+}
+
+// resealEmail encrypts a stored email, plaintext or under an old key,
+// with the active key.
+func (r *PostgresUserRepository) resealEmail(
+	id string,
+	plaintext *string,
+	ciphertext []byte,
+) (sealedEmail, error) {
+
+	if ciphertext == nil && plaintext != nil {
+		return r.sealEmail(id, domain.NormalizeEmail(*plaintext))
+	}
+
+	email, err := r.openEmail(id, ciphertext)
+	if err != nil {
+		return sealedEmail{}, err
+	}
+	return r.sealEmail(id, email)
+}
+
+func (r *PostgresUserRepository) CountStaleEmails(
+	ctx context.Context,
+) (StaleEmails, error) {
+
+	return withSession(ctx, conn(ctx, r.db), func(q dbtx) (StaleEmails, error) {
+		var stale StaleEmails
+		err := q.QueryRowContext(ctx, `
+			SELECT COUNT(*) FILTER (WHERE email_key_id IS NULL),
+			       COUNT(*) FILTER (WHERE email_key_id <> $1)
+			FROM (
+				SELECT email_key_id FROM users
+				WHERE (email_key_id IS NULL OR email_key_id <> $1)
+				  AND `+tenantCondition(2)+`
+				UNION ALL
+				SELECT email_key_id FROM user_versions
+				WHERE (email_key_id IS NULL OR email_key_id <> $1)
+				  AND `+tenantCondition(2)+`
+			) stale
+		`, r.emails.ActiveKeyID(), tenantParam(ctx)).Scan(&stale.Plaintext, &stale.OldKey)
+		return stale, err
+	})
+}
@@ -0,0 +1,258 @@
+package repository_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"go-prod-app/internal/domain"
+	"go-prod-app/internal/fieldcrypt"
+	"go-prod-app/internal/repository"
+	"go-prod-app/internal/repository/repotest"
+
+	"github.com/google/uuid"
+)
+
+// Run against the database in TEST_DB_DSN; skipped without it.
+
+func TestPostgresEmailEncrypted(t *testing.T) {
+	db := repotest.OpenPostgres(t)
+	repo := repository.NewPostgresUserRepository(db, testKeyRing(t))
+	ctx := context.Background()
+
+	u := createUser(t, repo, "alice@example.com")
+
+	ciphertext, hash, keyID := storedEmail(t, db, u.ID())
+	if bytes.Contains(ciphertext, []byte("alice@example.com")) {
+		t.Error("users.email_ciphertext contains the plaintext")
+	}
+	if len(hash) == 0 || keyID != "test" {
+		t.Errorf("email_hash = %x, email_key_id = %q, want a hash and test", hash, keyID)
+	}
+
+	// the blind index is taken of the normalized email
+	got, err := repo.GetByEmail(ctx, "ALICE@example.com")
+	if err != nil {
+		t.Fatalf("GetByEmail: %v", err)
+	}
+	if got.ID() != u.ID() || got.Email() != "alice@example.com" {
+		t.Errorf("GetByEmail = %s %q, want %s alice@example.com", got.ID(), got.Email(), u.ID())
+	}
+}
+
+func TestPostgresEmailTampered(t *testing.T) {
+	db := repotest.OpenPostgres(t)
+	repo := repository.NewPostgresUserRepository(db, testKeyRing(t))
+
+	alice := createUser(t, repo, "alice@example.com")
+	bob := createUser(t, repo, "bob@example.com")
+
+	// bob's envelope is bound to bob's ID
+	ciphertext, _, _ := storedEmail(t, db, bob.ID())
+	execAllTenants(t, db, `UPDATE users SET email_ciphertext = $1 WHERE id = $2`, ciphertext, alice.ID())
+
+	if _, err := repo.GetByID(context.Background(), alice.ID()); !errors.Is(err, fieldcrypt.ErrDecrypt) {
+		t.Errorf("GetByID with another user's envelope: err = %v, want ErrDecrypt", err)
+	}
+}
+
+func TestPostgresEmailUnknownKey(t *testing.T) {
+	db := repotest.OpenPostgres(t)
+	u := createUser(t, repository.NewPostgresUserRepository(db, testKeyRing(t)), "alice@example.com")
+
+	other := repository.NewPostgresUserRepository(db, keyRing(t, "other", fieldcrypt.Key{
+		ID: "other", Secret: bytes.Repeat([]byte{3}, fieldcrypt.KeySize),
+	}))
+
+	if _, err := other.GetByID(context.Background(), u.ID()); !errors.Is(err, fieldcrypt.ErrUnknownKey) {
+		t.Errorf("GetByID without the key: err = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestPostgresEmailRotation(t *testing.T) {
+	db := repotest.OpenPostgres(t)
+	ctx := repository.WithAllTenants(context.Background())
+
+	u := createUser(t, repository.NewPostgresUserRepository(db, testKeyRing(t)), "alice@example.com")
+	_, hashBefore, _ := storedEmail(t, db, u.ID())
+
+	next := fieldcrypt.Key{ID: "next", Secret: bytes.Repeat([]byte{4}, fieldcrypt.KeySize)}
+	rotated := repository.NewPostgresUserRepository(db, keyRing(t, "next", testKey, next))
+
+	stale, err := rotated.CountStaleEmails(ctx)
+	if err != nil {
+		t.Fatalf("CountStaleEmails: %v", err)
+	}
+	// the users row and its first version
+	if stale.OldKey != 2 || stale.Plaintext != 0 {
+		t.Errorf("stale = %+v, want 2 under an old key", stale)
+	}
+
+	n, err := rotated.ReencryptEmails(ctx, 100)
+	if err != nil {
+		t.Fatalf("ReencryptEmails: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("ReencryptEmails = %d, want 2", n)
+	}
+
+	_, hashAfter, keyID := storedEmail(t, db, u.ID())
+	if keyID != "next" {
+		t.Errorf("email_key_id = %q, want next", keyID)
+	}
+	if !bytes.Equal(hashBefore, hashAfter) {
+		t.Error("email_hash changed with the encryption key")
+	}
+
+	// the old key can be retired
+	retired := repository.NewPostgresUserRepository(db, keyRing(t, "next", next))
+
+	got, err := retired.GetByEmail(context.Background(), "alice@example.com")
+	if err != nil {
+		t.Fatalf("GetByEmail after retiring the old key: %v", err)
+	}
+	if got.Email() != "alice@example.com" {
+		t.Errorf("email = %q, want alice@example.com", got.Email())
+	}
+
+	versions, err := retired.ListVersions(context.Background(), u.ID(), 0, 10)
+	if err != nil {
+		t.Fatalf("ListVersions after retiring the old key: %v", err)
+	}
+	if len(versions) != 1 || versions[0].User.Email() != "alice@example.com" {
+		t.Errorf("versions = %+v", versions)
+	}
+}
+
+// A row written before migration 0009 has a plaintext email and no
+// blind index until it is re-encrypted.
+func TestPostgresEmailPlaintextBackfill(t *testing.T) {
+	db := repotest.OpenPostgres(t)
+	repo := repository.NewPostgresUserRepository(db, testKeyRing(t))
+	ctx := repository.WithAllTenants(context.Background())
+
+	id := uuid.NewString()
+	now := time.Now().UTC()
+	execAllTenants(t, db, `
+		INSERT INTO users (id, name, email, version, created_at, updated_at, tenant_id)
+		VALUES ($1, 'Alice', 'alice@example.com', 1, $2, $2, $3)
+	`, id, now, repository.DefaultTenant)
+
+	stale, err := repo.CountStaleEmails(ctx)
+	if err != nil {
+		t.Fatalf("CountStaleEmails: %v", err)
+	}
+	if stale.Plaintext != 1 {
+		t.Errorf("stale = %+v, want 1 plaintext", stale)
+	}
+
+	if _, err := repo.GetByEmail(context.Background(), "alice@example.com"); !errors.Is(err, repository.ErrUserNotFound) {
+		t.Errorf("GetByEmail before the backfill: err = %v, want ErrUserNotFound", err)
+	}
+
+	if _, err := repo.ReencryptEmails(ctx, 100); err != nil {
+		t.Fatalf("ReencryptEmails: %v", err)
+	}
+
+	got, err := repo.GetByEmail(context.Background(), "alice@example.com")
+	if err != nil {
+		t.Fatalf("GetByEmail after the backfill: %v", err)
+	}
+	if string(got.ID()) != id {
+		t.Errorf("GetByEmail = %s, want %s", got.ID(), id)
+	}
+
+	var plaintext sql.NullString
+	queryAllTenants(t, db, `SELECT email FROM users WHERE id = $1`, []any{id}, &plaintext)
+	if plaintext.Valid {
+		t.Errorf("users.email = %q after the backfill, want NULL", plaintext.String)
+	}
+}
+
+//
+// =========================
+// Helpers
+// =========================
+//
+
+// testKey is the key of testKeyRing.
+var testKey = fieldcrypt.Key{ID: "test", Secret: bytes.Repeat([]byte{1}, fieldcrypt.KeySize)}
+
+// keyRing builds a ring with testKeyRing's index key, so blind indexes
+// match across rings.
+func keyRing(t *testing.T, active string, keys ...fieldcrypt.Key) *fieldcrypt.KeyRing {
+	t.Helper()
+
+	ring, err := fieldcrypt.NewKeyRing(keys, active, bytes.Repeat([]byte{2}, 32))
+	if err != nil {
+		t.Fatalf("key ring: %v", err)
+	}
+	return ring
+}
+
+func createUser(t *testing.T, repo repository.UserRepository, email string) *domain.User {
+	t.Helper()
+
+	u, err := domain.NewUser("Alice", email, time.Now().UTC())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Create(context.Background(), u); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	return u
+}
+
+func storedEmail(t *testing.T, db *sql.DB, id domain.UserID) (ciphertext, hash []byte, keyID string) {
+	t.Helper()
+
+	queryAllTenants(t, db, `
+		SELECT email_ciphertext, email_hash, email_key_id
+		FROM users
+		WHERE id = $1
+	`, []any{id}, &ciphertext, &hash, &keyID)
+	return ciphertext, hash, keyID
+}
+
+// queryAllTenants scans the row query returns into dest, in a
+// transaction that row-level security lets see every tenant.
+func queryAllTenants(t *testing.T, db *sql.DB, query string, args []any, dest ...any) {
+	t.Helper()
+
+	tx := allTenantsTx(t, db)
+	defer func() { _ = tx.Rollback() }()
+
+	if err := tx.QueryRow(query, args...).Scan(dest...); err != nil {
+		t.Fatalf("query: %v", err)
+	}
+}
+
+func execAllTenants(t *testing.T, db *sql.DB, query string, args ...any) {
+	t.Helper()
+
+	tx := allTenantsTx(t, db)
+	if _, err := tx.Exec(query, args...); err != nil {
+		_ = tx.Rollback()
+		t.Fatalf("exec: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+}
+
+func allTenantsTx(t *testing.T, db *sql.DB) *sql.Tx {
+	t.Helper()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	if _, err := tx.Exec(`SELECT set_config('app.all_tenants', 'on', true)`); err != nil {
+		_ = tx.Rollback()
+		t.Fatalf("set app.all_tenants: %v", err)
+	}
+	return tx
+}
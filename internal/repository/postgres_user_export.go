@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go-prod-app/internal/domain"
+)
+
+// exportPageSize is the number of users an export reads per query.
+const exportPageSize = 1000
+
+//
+// =========================
+// Export
+// Pages by ID, each page its own short read
+// Runs on a replica when there is one
+//
+
+func (r *PostgresUserRepository) Export(
+	ctx context.Context,
+	filter UserFilter,
+	afterID domain.UserID,
+	fn func(*domain.User) error,
+) error {
+
+	conditions, args := r.filterConditions(ctx, filter)
+
+	args = append(args, nullString(string(afterID)), exportPageSize)
+	afterParam, limitParam := len(args)-1, len(args)
+	conditions = append(conditions, fmt.Sprintf("($%[1]d::uuid IS NULL OR id > $%[1]d::uuid)", afterParam))
+
+	query := fmt.Sprintf(`
+		SELECT id, name, email_ciphertext, version,
+		       created_at, updated_at, deleted_at
+		FROM users
+		WHERE %s
+		ORDER BY id
+		LIMIT $%d
+	`, strings.Join(conditions, " AND "), limitParam)
+
+	// One pool for every page, so a lagging replica cannot hand out a
+	// page the previous one already went past.
+	db := r.reader(ctx)
+
+	// A page is read in full before fn sees it: a slow consumer holds
+	// no transaction or snapshot open between pages.
+	for {
+		page, err := withSession(ctx, db, func(q dbtx) ([]*domain.User, error) {
+			return r.exportPage(ctx, q, query, args)
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, u := range page {
+			if err := fn(u); err != nil {
+				return err
+			}
+		}
+
+		if len(page) < exportPageSize {
+			return nil
+		}
+		args[afterParam-1] = string(page[len(page)-1].ID())
+	}
+}
+
+// exportPage reads the next page of an export.
+func (r *PostgresUserRepository) exportPage(
+	ctx context.Context,
+	q dbtx,
+	query string,
+	args []interface{},
+) ([]*domain.User, error) {
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := make([]*domain.User, 0, exportPageSize)
+	for rows.Next() {
+		u, err := r.scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		page = append(page, u)
+	}
+
+	return page, rows.Err()
+}
@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-prod-app/internal/domain"
+
+	"github.com/lib/pq"
+)
+
+//
+// =========================
+// ListVersions
+// Newest first, keyset on version
+//
+
+func (r *PostgresUserRepository) ListVersions(
+	ctx context.Context,
+	id domain.UserID,
+	beforeVersion int,
+	limit int,
+) ([]*UserVersion, error) {
+
+	if limit <= 0 {
+		return nil, fmt.Errorf("limit must be > 0")
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
+	}
+
+	query := `
+		SELECT user_id, name, email_ciphertext, version,
+		       created_at, updated_at, deleted_at,
+		       changed_by, changed_fields, changed_at
+		FROM user_versions
+		WHERE user_id = $1
+		  AND ($2 = 0 OR version < $2)
+		  AND ` + tenantCondition(4) + `
+		ORDER BY version DESC
+		LIMIT $3
+	`
+
+	return withSession(ctx, conn(ctx, r.db), func(q dbtx) ([]*UserVersion, error) {
+		rows, err := q.QueryContext(ctx, query, id, beforeVersion, limit, tenantParam(ctx))
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		var versions []*UserVersion
+
+		for rows.Next() {
+			v, err := r.scanUserVersion(rows)
+			if err != nil {
+				return nil, err
+			}
+			versions = append(versions, v)
+		}
+
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+
+		return versions, nil
+	})
+}
+
+//
+// =========================
+// GetAsOf
+// Latest version written at or before t
+//
+
+func (r *PostgresUserRepository) GetAsOf(
+	ctx context.Context,
+	id domain.UserID,
+	t time.Time,
+) (*domain.User, error) {
+
+	query := `
+		SELECT user_id, name, email_ciphertext, version,
+		       created_at, updated_at, deleted_at,
+		       changed_by, changed_fields, changed_at
+		FROM user_versions
+		WHERE user_id = $1
+		  AND changed_at <= $2
+		  AND ` + tenantCondition(3) + `
+		ORDER BY version DESC
+		LIMIT 1
+	`
+
+	v, err := withSession(ctx, conn(ctx, r.db), func(q dbtx) (*UserVersion, error) {
+		return r.scanUserVersion(q.QueryRowContext(ctx, query, id, t, tenantParam(ctx)))
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return v.User, nil
+}
+
+func (r *PostgresUserRepository) scanUserVersion(s scanner) (*UserVersion, error) {
+	var (
+		id            string
+		name          string
+		ciphertext    []byte
+		version       int
+		createdAt     time.Time
+		updatedAt     time.Time
+		deletedAt     *time.Time
+		changedBy     sql.NullString
+		changedFields pq.StringArray
+		changedAt     time.Time
+	)
+
+	if err := s.Scan(
+		&id,
+		&name,
+		&ciphertext,
+		&version,
+		&createdAt,
+		&updatedAt,
+		&deletedAt,
+		&changedBy,
+		&changedFields,
+		&changedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	email, err := r.openEmail(id, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UserVersion{
+		User: domain.RehydrateUser(
+			domain.UserID(id),
+			name,
+			email,
+			version,
+			createdAt,
+			updatedAt,
+			deletedAt,
+		),
+		ChangedBy:     changedBy.String,
+		ChangedFields: []string(changedFields),
+		ChangedAt:     changedAt,
+	}, nil
+}
@@ -0,0 +1,218 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go-prod-app/internal/domain"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+//
+// =========================
+// Import
+// COPY into a staging table, then one merge into users
+// The staging table lives and dies in withSession's transaction
+//
+
+func (r *PostgresUserRepository) Import(
+	ctx context.Context,
+	users []*domain.User,
+) ([]bool, error) {
+
+	if len(users) == 0 {
+		return nil, nil
+	}
+
+	now := time.Now().UTC()
+
+	// UUID v7 → sortable by time; only used for the rows inserted
+	ids := make([]string, len(users))
+	for i := range users {
+		ids[i] = uuid.Must(uuid.NewV7()).String()
+	}
+
+	// Users whose email an active user has are skipped by ON CONFLICT;
+	// the staging rows that were inserted come back by position.
+	merge := `
+		WITH ins AS (
+			INSERT INTO users (
+				id, name, email_ciphertext, email_hash, email_key_id,
+				version, created_at, updated_at, deleted_at,
+				tenant_id
+			)
+			SELECT id, name, email_ciphertext, email_hash, email_key_id,
+			       1, $1, $1, NULL,
+			       $3
+			FROM users_import
+			ORDER BY pos
+			ON CONFLICT (tenant_id, email_hash) WHERE deleted_at IS NULL
+			DO NOTHING
+			RETURNING id, name, email_ciphertext, email_key_id, version,
+			          created_at, updated_at, deleted_at,
+			          tenant_id
+		), ver AS (
+			INSERT INTO user_versions (
+				user_id, version, name, email_ciphertext, email_key_id,
+				created_at, updated_at, deleted_at,
+				changed_by, changed_fields, changed_at,
+				tenant_id
+			)
+			SELECT id, version, name, email_ciphertext, email_key_id,
+			       created_at, updated_at, deleted_at,
+			       $2, ARRAY['name','email'], created_at,
+			       tenant_id
+			FROM ins
+		)
+		SELECT s.pos
+		FROM ins
+		JOIN users_import s USING (id)
+	`
+
+	created, err := withSession(ctx, conn(ctx, r.db), func(q dbtx) ([]bool, error) {
+		if _, err := q.ExecContext(ctx, `
+			CREATE TEMP TABLE users_import (
+				pos int NOT NULL,
+				id uuid NOT NULL,
+				name text NOT NULL,
+				email_ciphertext bytea NOT NULL,
+				email_hash bytea NOT NULL,
+				email_key_id text NOT NULL
+			) ON COMMIT DROP
+		`); err != nil {
+			return nil, err
+		}
+
+		if err := r.copyImport(ctx, q, users, ids); err != nil {
+			return nil, err
+		}
+
+		rows, err := q.QueryContext(ctx, merge, now, nullString(ActorFromContext(ctx)), TenantFromContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		created := make([]bool, len(users))
+		for rows.Next() {
+			var pos int
+			if err := rows.Scan(&pos); err != nil {
+				return nil, err
+			}
+			created[pos] = true
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+
+		// a caller's transaction outlives the import
+		_, err = q.ExecContext(ctx, `DROP TABLE users_import`)
+		return created, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r.wrote(ctx)
+
+	// Set IDs only AFTER the merge succeeded
+	for i, u := range users {
+		if !created[i] {
+			continue
+		}
+		if err := u.SetID(domain.UserID(ids[i])); err != nil {
+			return nil, err
+		}
+	}
+
+	return created, nil
+}
+
+// copyImport encrypts users and streams them into users_import with
+// COPY.
+func (r *PostgresUserRepository) copyImport(
+	ctx context.Context,
+	q dbtx,
+	users []*domain.User,
+	ids []string,
+) error {
+
+	stmt, err := q.PrepareContext(ctx, pq.CopyIn("users_import",
+		"pos", "id", "name", "email_ciphertext", "email_hash", "email_key_id"))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for i, u := range users {
+		email, err := r.sealEmail(ids[i], u.Email())
+		if err != nil {
+			return err
+		}
+
+		if _, err := stmt.ExecContext(ctx,
+			i, ids[i], u.Name(), email.ciphertext, email.hash, email.keyID,
+		); err != nil {
+			return fmt.Errorf("copy user %d: %w", i, err)
+		}
+	}
+
+	// An Exec without arguments ends the COPY
+	_, err = stmt.ExecContext(ctx)
+	return err
+}
+
+//
+// =========================
+// EmailsTaken
+// A plain read of the blind index: no staging table, no merge
+//
+
+func (r *PostgresUserRepository) EmailsTaken(
+	ctx context.Context,
+	users []*domain.User,
+) ([]bool, error) {
+
+	if len(users) == 0 {
+		return nil, nil
+	}
+
+	hashes := make([][]byte, len(users))
+	positions := make(map[string][]int, len(users))
+	for i, u := range users {
+		hashes[i] = r.emailHash(u.Email())
+		positions[string(hashes[i])] = append(positions[string(hashes[i])], i)
+	}
+
+	query := `
+		SELECT email_hash
+		FROM users
+		WHERE email_hash = ANY($1::bytea[])
+		  AND deleted_at IS NULL
+		  AND ` + tenantCondition(2) + `
+	`
+
+	return withSession(ctx, conn(ctx, r.db), func(q dbtx) ([]bool, error) {
+		rows, err := q.QueryContext(ctx, query, pq.Array(hashes), tenantParam(ctx))
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		taken := make([]bool, len(users))
+		for rows.Next() {
+			var hash []byte
+			if err := rows.Scan(&hash); err != nil {
+				return nil, err
+			}
+			for _, i := range positions[string(hash)] {
+				taken[i] = true
+			}
+		}
+
+		return taken, rows.Err()
+	})
+}
@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"go-prod-app/internal/domain"
+)
+
+//
+// =========================
+// PurgeDeleted
+// user_versions rows go with ON DELETE CASCADE
+// Only the tenant of ctx, unless ctx is WithAllTenants
+//
+
+func (r *PostgresUserRepository) PurgeDeleted(
+	ctx context.Context,
+	cutoff time.Time,
+	limit int,
+) ([]domain.UserID, error) {
+
+	// SKIP LOCKED: a user being restored right now is left for the next run
+	query := `
+		DELETE FROM users
+		WHERE id IN (
+			SELECT id
+			FROM users
+			WHERE deleted_at IS NOT NULL
+			  AND deleted_at < $1
+			  AND ` + tenantCondition(3) + `
+			ORDER BY deleted_at ASC
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id
+	`
+
+	return withSession(ctx, conn(ctx, r.db), func(q dbtx) ([]domain.UserID, error) {
+		rows, err := q.QueryContext(ctx, query, cutoff, limit, tenantParam(ctx))
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		var ids []domain.UserID
+
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				return nil, err
+			}
+			ids = append(ids, domain.UserID(id))
+		}
+
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+
+		return ids, nil
+	})
+}
+
+func (r *PostgresUserRepository) CountPurgeable(
+	ctx context.Context,
+	cutoff time.Time,
+) (int64, error) {
+
+	return withSession(ctx, conn(ctx, r.db), func(q dbtx) (int64, error) {
+		var count int64
+		err := q.QueryRowContext(ctx, `
+			SELECT COUNT(*)
+			FROM users
+			WHERE deleted_at IS NOT NULL
+			  AND deleted_at < $1
+			  AND `+tenantCondition(2)+`
+		`, cutoff, tenantParam(ctx)).Scan(&count)
+		return count, err
+	})
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"go-prod-app/internal/domain"
+	"go-prod-app/internal/fieldcrypt"
 
 	"github.com/google/uuid"
 	"github.com/lib/pq"
@@ -16,12 +17,58 @@ import (
 
 const maxListLimit = 1000
 
+// PostgresSchemaVersion is the migration version (see database/migrations)
+// this build of PostgresUserRepository expects the database to be at.
+const PostgresSchemaVersion = 12
+
 type PostgresUserRepository struct {
-	db *sql.DB
+	db       *sql.DB
+	emails   *fieldcrypt.KeyRing
+	replicas *ReplicaSet
+}
+
+type PostgresUserOption func(*PostgresUserRepository)
+
+// WithReplicas sends GetByID, GetByEmail, List and Count to the read
+// replicas of rs. db stays the primary for everything else.
+func WithReplicas(rs *ReplicaSet) PostgresUserOption {
+	return func(r *PostgresUserRepository) {
+		r.replicas = rs
+	}
+}
+
+// NewPostgresUserRepository stores emails encrypted with emails (see
+// postgres_user_email.go).
+func NewPostgresUserRepository(
+	db *sql.DB,
+	emails *fieldcrypt.KeyRing,
+	opts ...PostgresUserOption,
+) *PostgresUserRepository {
+
+	r := &PostgresUserRepository{db: db, emails: emails}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// reader is conn for replica-eligible reads. A transaction still wins,
+// so reads inside one see its writes.
+func (r *PostgresUserRepository) reader(ctx context.Context) dbtx {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	if r.replicas == nil {
+		return r.db
+	}
+	return r.replicas.reader(ctx)
 }
 
-func NewPostgresUserRepository(db *sql.DB) *PostgresUserRepository {
-	return &PostgresUserRepository{db: db}
+// wrote records a successful write for read-your-writes.
+func (r *PostgresUserRepository) wrote(ctx context.Context) {
+	if r.replicas != nil {
+		r.replicas.noteWrite(ctx)
+	}
 }
 
 //
@@ -41,28 +88,57 @@ func (r *PostgresUserRepository) Create(
 	// UUID v7 → sortable by time
 	id := uuid.Must(uuid.NewV7())
 
+	email, err := r.sealEmail(id.String(), user.Email())
+	if err != nil {
+		return err
+	}
+
+	// Insert the user and its first version in one statement
 	query := `
-		INSERT INTO users (
-			id, name, email, version,
-			created_at, updated_at, deleted_at
+		WITH ins AS (
+			INSERT INTO users (
+				id, name, email_ciphertext, email_hash, email_key_id,
+				version, created_at, updated_at, deleted_at,
+				tenant_id
+			)
+			VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$11)
+			RETURNING id, name, email_ciphertext, email_key_id, version,
+			          created_at, updated_at, deleted_at,
+			          tenant_id
 		)
-		VALUES ($1,$2,$3,$4,$5,$6,$7)
-		RETURNING id
+		INSERT INTO user_versions (
+			user_id, version, name, email_ciphertext, email_key_id,
+			created_at, updated_at, deleted_at,
+			changed_by, changed_fields, changed_at,
+			tenant_id
+		)
+		SELECT id, version, name, email_ciphertext, email_key_id,
+		       created_at, updated_at, deleted_at,
+		       $10, ARRAY['name','email'], created_at,
+		       tenant_id
+		FROM ins
+		RETURNING user_id
 	`
 
-	var returnedID string
-
-	err := r.db.QueryRowContext(
-		ctx,
-		query,
-		id.String(),
-		user.Name(),
-		user.Email(),
-		1,   // initial version
-		now, // created_at
-		now, // updated_at
-		nil,
-	).Scan(&returnedID)
+	returnedID, err := withSession(ctx, conn(ctx, r.db), func(q dbtx) (string, error) {
+		var returnedID string
+		err := q.QueryRowContext(
+			ctx,
+			query,
+			id.String(),
+			user.Name(),
+			email.ciphertext,
+			email.hash,
+			email.keyID,
+			1,   // initial version
+			now, // created_at
+			now, // updated_at
+			nil,
+			nullString(ActorFromContext(ctx)),
+			TenantFromContext(ctx),
+		).Scan(&returnedID)
+		return returnedID, err
+	})
 
 	if err != nil {
 		if isUniqueViolation(err) {
@@ -71,6 +147,8 @@ func (r *PostgresUserRepository) Create(
 		return err
 	}
 
+	r.wrote(ctx)
+
 	// Set ID only AFTER successful insert
 	if err := user.SetID(domain.UserID(returnedID)); err != nil {
 		return err
@@ -93,28 +171,81 @@ func (r *PostgresUserRepository) Update(
 	now := time.Now().UTC()
 	newVersion := user.Version() + 1
 
+	email, err := r.sealEmail(string(user.ID()), user.Email())
+	if err != nil {
+		return err
+	}
+
+	// Update the row and record the new version in one statement.
+	// old reads the statement's snapshot, so it sees the pre-update row
+	// and changed_fields is exact. It must not lock: sibling CTEs run in
+	// no defined order, and a locking read after upd would skip the row
+	// upd just changed. The version guard on upd serializes writers.
+	// Every write re-encrypts, so emails compare by blind index.
 	query := `
-		UPDATE users
-		SET name = $1,
-			email = $2,
-			version = $3,
-			updated_at = $4,
-			deleted_at = $5
-		WHERE id = $6
-		  AND version = $7
+		WITH old AS (
+			SELECT name, email_hash, deleted_at
+			FROM users
+			WHERE id = $8
+			  AND version = $9
+			  AND ` + tenantCondition(11) + `
+		), upd AS (
+			UPDATE users
+			SET name = $1,
+				email = NULL,
+				email_ciphertext = $2,
+				email_hash = $3,
+				email_key_id = $4,
+				version = $5,
+				updated_at = $6,
+				deleted_at = $7
+			WHERE id = $8
+			  AND version = $9
+			  AND ` + tenantCondition(11) + `
+			RETURNING id, name, email_ciphertext, email_hash, email_key_id,
+			          version, created_at, updated_at, deleted_at,
+			          tenant_id
+		)
+		INSERT INTO user_versions (
+			user_id, version, name, email_ciphertext, email_key_id,
+			created_at, updated_at, deleted_at,
+			changed_by, changed_fields, changed_at,
+			tenant_id
+		)
+		SELECT upd.id, upd.version, upd.name, upd.email_ciphertext, upd.email_key_id,
+		       upd.created_at, upd.updated_at, upd.deleted_at,
+		       $10,
+		       array_remove(ARRAY[
+		           CASE WHEN old.name IS DISTINCT FROM upd.name THEN 'name' END,
+		           CASE WHEN old.email_hash IS DISTINCT FROM upd.email_hash THEN 'email' END,
+		           CASE WHEN old.deleted_at IS DISTINCT FROM upd.deleted_at THEN 'deleted_at' END
+		       ], NULL),
+		       upd.updated_at,
+		       upd.tenant_id
+		FROM upd, old
 	`
 
-	res, err := r.db.ExecContext(
-		ctx,
-		query,
-		user.Name(),
-		user.Email(),
-		newVersion,
-		now,
-		user.DeletedAt(),
-		user.ID(),
-		user.Version(),
-	)
+	rows, err := withSession(ctx, conn(ctx, r.db), func(q dbtx) (int64, error) {
+		res, err := q.ExecContext(
+			ctx,
+			query,
+			user.Name(),
+			email.ciphertext,
+			email.hash,
+			email.keyID,
+			newVersion,
+			now,
+			user.DeletedAt(),
+			user.ID(),
+			user.Version(),
+			nullString(ActorFromContext(ctx)),
+			tenantParam(ctx),
+		)
+		if err != nil {
+			return 0, err
+		}
+		return res.RowsAffected()
+	})
 
 	if err != nil {
 		if isUniqueViolation(err) {
@@ -123,19 +254,137 @@ func (r *PostgresUserRepository) Update(
 		return err
 	}
 
-	rows, err := res.RowsAffected()
-	if err != nil {
-		return err
-	}
-
 	if rows == 0 {
 		return ErrVersionConflict
 	}
 
+	r.wrote(ctx)
+
 	user.IncreaseVersion()
 	return nil
 }
 
+//
+// =========================
+// UpsertByEmail
+// Single statement: ON CONFLICT on the active-email index
+//
+
+func (r *PostgresUserRepository) UpsertByEmail(
+	ctx context.Context,
+	user *domain.User,
+) (*domain.User, UpsertOutcome, error) {
+
+	now := time.Now().UTC()
+
+	// UUID v7 → sortable by time; only used if the row is inserted
+	id := uuid.Must(uuid.NewV7())
+
+	email, err := r.sealEmail(id.String(), user.Email())
+	if err != nil {
+		return nil, "", err
+	}
+
+	// The DO UPDATE WHERE skips unchanged rows, so nothing is returned
+	// for them. The returned id tells an insert from an update; an
+	// updated row keeps its own envelope.
+	query := `
+		WITH up AS (
+			INSERT INTO users (
+				id, name, email_ciphertext, email_hash, email_key_id,
+				version, created_at, updated_at, deleted_at,
+				tenant_id
+			)
+			VALUES ($1, $2, $3, $4, $5, 1, $6, $6, NULL, $8)
+			ON CONFLICT (tenant_id, email_hash) WHERE deleted_at IS NULL
+			DO UPDATE
+			SET name = EXCLUDED.name,
+				version = users.version + 1,
+				updated_at = EXCLUDED.updated_at
+			WHERE users.name IS DISTINCT FROM EXCLUDED.name
+			RETURNING id, name, email_ciphertext, email_key_id, version,
+			          created_at, updated_at, deleted_at,
+			          tenant_id
+		), ver AS (
+			INSERT INTO user_versions (
+				user_id, version, name, email_ciphertext, email_key_id,
+				created_at, updated_at, deleted_at,
+				changed_by, changed_fields, changed_at,
+				tenant_id
+			)
+			SELECT id, version, name, email_ciphertext, email_key_id,
+			       created_at, updated_at, deleted_at,
+			       $7,
+			       CASE WHEN id = $1 THEN ARRAY['name','email']
+			            ELSE ARRAY['name'] END,
+			       updated_at,
+			       tenant_id
+			FROM up
+		)
+		SELECT id, name, email_ciphertext, version,
+		       created_at, updated_at, deleted_at
+		FROM up
+	`
+
+	stored, err := withSession(ctx, conn(ctx, r.db), func(q dbtx) (*domain.User, error) {
+		return r.scanUser(q.QueryRowContext(
+			ctx,
+			query,
+			id.String(),
+			user.Name(),
+			email.ciphertext,
+			email.hash,
+			email.keyID,
+			now,
+			nullString(ActorFromContext(ctx)),
+			TenantFromContext(ctx),
+		))
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return r.unchangedByEmail(ctx, user.Email())
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	r.wrote(ctx)
+
+	if stored.ID() == domain.UserID(id.String()) {
+		return stored, UpsertCreated, nil
+	}
+	return stored, UpsertUpdated, nil
+}
+
+// unchangedByEmail reads the active user an upsert left as it was, from
+// the primary.
+func (r *PostgresUserRepository) unchangedByEmail(
+	ctx context.Context,
+	email string,
+) (*domain.User, UpsertOutcome, error) {
+
+	query := `
+		SELECT id, name, email_ciphertext, version,
+		       created_at, updated_at, deleted_at
+		FROM users
+		WHERE email_hash = $1
+		  AND deleted_at IS NULL
+		  AND ` + tenantCondition(2) + `
+	`
+
+	u, err := withSession(ctx, conn(ctx, r.db), func(q dbtx) (*domain.User, error) {
+		return r.scanUser(q.QueryRowContext(ctx, query, r.emailHash(email), tenantParam(ctx)))
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		// deleted between the upsert and this read
+		return nil, "", ErrVersionConflict
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	return u, UpsertUnchanged, nil
+}
+
 //
 // =========================
 // GetByID
@@ -148,15 +397,16 @@ func (r *PostgresUserRepository) GetByID(
 ) (*domain.User, error) {
 
 	query := `
-		SELECT id, name, email, version,
+		SELECT id, name, email_ciphertext, version,
 		       created_at, updated_at, deleted_at
 		FROM users
 		WHERE id = $1
+		  AND ` + tenantCondition(2) + `
 	`
 
-	row := r.db.QueryRowContext(ctx, query, id)
-
-	u, err := scanUser(row)
+	u, err := withSession(ctx, r.reader(ctx), func(q dbtx) (*domain.User, error) {
+		return r.scanUser(q.QueryRowContext(ctx, query, id, tenantParam(ctx)))
+	})
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, ErrUserNotFound
 	}
@@ -179,16 +429,17 @@ func (r *PostgresUserRepository) GetByEmail(
 ) (*domain.User, error) {
 
 	query := `
-		SELECT id, name, email, version,
+		SELECT id, name, email_ciphertext, version,
 		       created_at, updated_at, deleted_at
 		FROM users
-		WHERE email = $1
+		WHERE email_hash = $1
 		  AND deleted_at IS NULL
+		  AND ` + tenantCondition(2) + `
 	`
 
-	row := r.db.QueryRowContext(ctx, query, strings.ToLower(email))
-
-	u, err := scanUser(row)
+	u, err := withSession(ctx, r.reader(ctx), func(q dbtx) (*domain.User, error) {
+		return r.scanUser(q.QueryRowContext(ctx, query, r.emailHash(email), tenantParam(ctx)))
+	})
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, ErrUserNotFound
 	}
@@ -202,7 +453,7 @@ func (r *PostgresUserRepository) GetByEmail(
 //
 // =========================
 // List (Keyset Pagination)
-// Ordered by id ASC (UUID v7 → time-ordered)
+// Ordered by filter.Sort, then id (UUID v7 → time-ordered)
 //
 
 func (r *PostgresUserRepository) List(
@@ -210,50 +461,67 @@ func (r *PostgresUserRepository) List(
 	filter UserFilter,
 	cursor *Cursor,
 	limit int,
-) ([]*domain.User, *Cursor, error) {
+) (*UserPage, error) {
 
 	if limit <= 0 {
-		return nil, nil, fmt.Errorf("limit must be > 0")
+		return nil, fmt.Errorf("limit must be > 0")
 	}
 	if limit > maxListLimit {
 		limit = maxListLimit
 	}
 
-	var (
-		args       []interface{}
-		conditions []string
-	)
-
-	if !filter.IncludeDeleted {
-		conditions = append(conditions, "deleted_at IS NULL")
+	sort, err := resolveSort(filter)
+	if err != nil {
+		return nil, err
 	}
 
-	if filter.Email != nil {
-		args = append(args, strings.ToLower(*filter.Email))
-		conditions = append(conditions,
-			fmt.Sprintf("email = $%d", len(args)))
+	if err := validateCursor(sort, cursor); err != nil {
+		return nil, err
 	}
 
-	if filter.CreatedAfter != nil {
-		args = append(args, *filter.CreatedAfter)
-		conditions = append(conditions,
-			fmt.Sprintf("created_at > $%d", len(args)))
+	conditions, args := r.filterConditions(ctx, filter)
+
+	rank := "NULL::float8"
+	if filter.Query != nil {
+		args = append(args, *filter.Query, r.emailHash(*filter.Query))
+		rank = rankExpr(len(args)-1, len(args))
 	}
 
-	if filter.CreatedBefore != nil {
-		args = append(args, *filter.CreatedBefore)
-		conditions = append(conditions,
-			fmt.Sprintf("created_at < $%d", len(args)))
+	col, cast := sortColumn(sort.Field)
+
+	// A backward page runs the reverse query; newUserPage flips the
+	// rows back into list order.
+	desc := sort.Desc != cursor.backward()
+
+	dir, cmpOp := "ASC", ">"
+	if desc {
+		dir, cmpOp = "DESC", "<"
 	}
 
-	if cursor != nil {
-		args = append(args, cursor.AfterID)
-		conditions = append(conditions,
-			fmt.Sprintf("id > $%d", len(args)))
+	// Keyset: (key, id) compared as a row so both follow the sort
+	// direction and the (key, id) indexes can serve it.
+	var keyset []string
+
+	if cursor.positioned() {
+		args = append(args, cursor.ID)
+		idParam := len(args)
+
+		if col == "id" {
+			keyset = append(keyset, fmt.Sprintf("id %s $%d", cmpOp, idParam))
+		} else {
+			after, err := decodeSortValue(sort.Field, cursor.Key)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, after)
+			keyset = append(keyset, fmt.Sprintf(
+				"(%s, id) %s ($%d::%s, $%d::uuid)",
+				col, cmpOp, len(args), cast, idParam))
+		}
 	}
 
-	// limit parameterized
-	args = append(args, limit)
+	// limit parameterized; one extra row tells whether more follow
+	args = append(args, limit+1)
 	limitParam := len(args)
 
 	where := ""
@@ -261,43 +529,66 @@ func (r *PostgresUserRepository) List(
 		where = "WHERE " + strings.Join(conditions, " AND ")
 	}
 
-	query := fmt.Sprintf(`
-		SELECT id, name, email, version,
-		       created_at, updated_at, deleted_at
-		FROM users
-		%s
-		ORDER BY id ASC
-		LIMIT $%d
-	`, where, limitParam)
+	outerWhere := ""
+	if len(keyset) > 0 {
+		outerWhere = "WHERE " + strings.Join(keyset, " AND ")
+	}
 
-	rows, err := r.db.QueryContext(ctx, query, args...)
-	if err != nil {
-		return nil, nil, err
+	orderBy := fmt.Sprintf("id %s", dir)
+	if col != "id" {
+		orderBy = fmt.Sprintf("%s %s, id %s", col, dir, dir)
 	}
-	defer rows.Close()
 
-	var users []*domain.User
-	var lastID domain.UserID
+	query := fmt.Sprintf(`
+		SELECT id, name, email_ciphertext, version,
+		       created_at, updated_at, deleted_at, rank
+		FROM (
+			SELECT id, name, email_ciphertext, version,
+			       created_at, updated_at, deleted_at,
+			       %s AS rank
+			FROM users
+			%s
+		) matched
+		%s
+		ORDER BY %s
+		LIMIT $%d
+	`, rank, where, outerWhere, orderBy, limitParam)
 
-	for rows.Next() {
-		u, err := scanUser(rows)
+	return withSession(ctx, r.reader(ctx), func(q dbtx) (*UserPage, error) {
+		rows, err := q.QueryContext(ctx, query, args...)
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
-		users = append(users, u)
-		lastID = u.ID()
-	}
+		defer rows.Close()
 
-	if err := rows.Err(); err != nil {
-		return nil, nil, err
-	}
+		var (
+			users []*domain.User
+			keys  []interface{}
+		)
 
-	var nextCursor *Cursor
-	if len(users) == limit {
-		nextCursor = &Cursor{AfterID: lastID}
-	}
+		for rows.Next() {
+			var rowRank *float64
+
+			u, err := r.scanUser(rankScanner{s: rows, rank: &rowRank})
+			if err != nil {
+				return nil, err
+			}
+
+			var rank float64
+			if rowRank != nil {
+				rank = *rowRank
+			}
+
+			users = append(users, u)
+			keys = append(keys, sortValue(sort.Field, u, rank))
+		}
 
-	return users, nextCursor, nil
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+
+		return newUserPage(sort, cursor, limit, users, keys), nil
+	})
 }
 
 //
@@ -311,19 +602,59 @@ func (r *PostgresUserRepository) Count(
 	filter UserFilter,
 ) (int64, error) {
 
+	conditions, args := r.filterConditions(ctx, filter)
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	query := fmt.Sprintf(`SELECT COUNT(*) FROM users %s`, where)
+
+	return withSession(ctx, r.reader(ctx), func(q dbtx) (int64, error) {
+		var count int64
+		err := q.QueryRowContext(ctx, query, args...).Scan(&count)
+		return count, err
+	})
+}
+
+//
+// =========================
+// Helpers
+// =========================
+//
+
+// filterConditions translates filter into WHERE conditions and their args.
+// The tenant condition duplicates row-level security (see
+// tenantCondition) and lets the planner use the tenant-prefixed
+// indexes with the actual value.
+func (r *PostgresUserRepository) filterConditions(
+	ctx context.Context,
+	filter UserFilter,
+) ([]string, []interface{}) {
+
 	var (
 		args       []interface{}
 		conditions []string
 	)
 
-	if !filter.IncludeDeleted {
+	if !allTenants(ctx) {
+		args = append(args, TenantFromContext(ctx))
+		conditions = append(conditions,
+			fmt.Sprintf("tenant_id = $%d", len(args)))
+	}
+
+	switch {
+	case filter.OnlyDeleted:
+		conditions = append(conditions, "deleted_at IS NOT NULL")
+	case !filter.IncludeDeleted:
 		conditions = append(conditions, "deleted_at IS NULL")
 	}
 
 	if filter.Email != nil {
-		args = append(args, strings.ToLower(*filter.Email))
+		args = append(args, r.emailHash(*filter.Email))
 		conditions = append(conditions,
-			fmt.Sprintf("email = $%d", len(args)))
+			fmt.Sprintf("email_hash = $%d", len(args)))
 	}
 
 	if filter.CreatedAfter != nil {
@@ -338,47 +669,84 @@ func (r *PostgresUserRepository) Count(
 			fmt.Sprintf("created_at < $%d", len(args)))
 	}
 
-	where := ""
-	if len(conditions) > 0 {
-		where = "WHERE " + strings.Join(conditions, " AND ")
+	// Fuzzy on name: word similarity (pg_trgm) or plain substring.
+	// Encrypted emails only match exactly.
+	if filter.Query != nil {
+		args = append(args, *filter.Query)
+		q := len(args)
+		args = append(args, "%"+escapeLike(*filter.Query)+"%")
+		like := len(args)
+		args = append(args, r.emailHash(*filter.Query))
+		hash := len(args)
+
+		conditions = append(conditions, fmt.Sprintf(
+			"($%[1]d <%% name OR name ILIKE $%[2]d OR email_hash = $%[3]d)",
+			q, like, hash))
 	}
 
-	query := fmt.Sprintf(`SELECT COUNT(*) FROM users %s`, where)
+	return conditions, args
+}
 
-	var count int64
-	err := r.db.QueryRowContext(ctx, query, args...).Scan(&count)
-	if err != nil {
-		return 0, err
+// sortColumn maps a sort field to its column in List's inner select
+// and the SQL type of its cursor value.
+func sortColumn(field SortField) (string, string) {
+	switch field {
+	case SortByCreatedAt:
+		return "created_at", "timestamptz"
+	case SortByUpdatedAt:
+		return "updated_at", "timestamptz"
+	case SortByName:
+		return "name", "text"
+	case SortByRelevance:
+		return "rank", "float8"
+	default:
+		return "id", "uuid"
 	}
+}
 
-	return count, nil
+// rankExpr scores a row against the search term in parameter q; an
+// exact email match (blind index in parameter hash) ranks first.
+func rankExpr(q, hash int) string {
+	return fmt.Sprintf(
+		"(CASE WHEN email_hash = $%[2]d THEN 1 ELSE word_similarity($%[1]d, name) END)::float8",
+		q, hash)
 }
 
-//
-// =========================
-// Helpers
-// =========================
-//
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// rankScanner scans a user row followed by its search rank.
+type rankScanner struct {
+	s    scanner
+	rank **float64
+}
+
+func (rs rankScanner) Scan(dest ...interface{}) error {
+	return rs.s.Scan(append(dest, rs.rank)...)
+}
 
 type scanner interface {
 	Scan(dest ...interface{}) error
 }
 
-func scanUser(s scanner) (*domain.User, error) {
+// scanUser scans id, name, email_ciphertext, version, created_at,
+// updated_at and deleted_at, decrypting the email.
+func (r *PostgresUserRepository) scanUser(s scanner) (*domain.User, error) {
 	var (
-		id        string
-		name      string
-		email     string
-		version   int
-		createdAt time.Time
-		updatedAt time.Time
-		deletedAt *time.Time
+		id         string
+		name       string
+		ciphertext []byte
+		version    int
+		createdAt  time.Time
+		updatedAt  time.Time
+		deletedAt  *time.Time
 	)
 
 	if err := s.Scan(
 		&id,
 		&name,
-		&email,
+		&ciphertext,
 		&version,
 		&createdAt,
 		&updatedAt,
@@ -387,6 +755,11 @@ func scanUser(s scanner) (*domain.User, error) {
 		return nil, err
 	}
 
+	email, err := r.openEmail(id, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
 	return domain.RehydrateUser(
 		domain.UserID(id),
 		name,
@@ -398,6 +771,10 @@ func scanUser(s scanner) (*domain.User, error) {
 	), nil
 }
 
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
 func isUniqueViolation(err error) bool {
 	var pqErr *pq.Error
 	if errors.As(err, &pqErr) {
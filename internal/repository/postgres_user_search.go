@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go-prod-app/internal/domain"
+)
+
+//
+// =========================
+// Suggest
+// Same matching as UserFilter.Query, top N only
+//
+
+func (r *PostgresUserRepository) Suggest(
+	ctx context.Context,
+	q string,
+	limit int,
+) ([]*domain.User, error) {
+
+	if limit <= 0 {
+		return nil, fmt.Errorf("limit must be > 0")
+	}
+
+	conditions, args := r.filterConditions(ctx, UserFilter{Query: &q})
+
+	args = append(args, q, r.emailHash(q))
+	rank := rankExpr(len(args)-1, len(args))
+
+	args = append(args, limit)
+	limitParam := len(args)
+
+	query := fmt.Sprintf(`
+		SELECT id, name, email_ciphertext, version,
+		       created_at, updated_at, deleted_at
+		FROM users
+		WHERE %s
+		ORDER BY %s DESC, id ASC
+		LIMIT $%d
+	`, strings.Join(conditions, " AND "), rank, limitParam)
+
+	return withSession(ctx, conn(ctx, r.db), func(q dbtx) ([]*domain.User, error) {
+		rows, err := q.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		var users []*domain.User
+
+		for rows.Next() {
+			u, err := r.scanUser(rows)
+			if err != nil {
+				return nil, err
+			}
+			users = append(users, u)
+		}
+
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+
+		return users, nil
+	})
+}
@@ -0,0 +1,317 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-prod-app/internal/metrics"
+)
+
+//
+// =========================
+// Read-Your-Writes Context
+// =========================
+// The client carries the WAL position of its last write, so any
+// process can serve its next read
+//
+
+var ErrInvalidConsistencyToken = errors.New("invalid consistency token")
+
+type readAfterKey struct{}
+type writesKey struct{}
+type primaryReadsKey struct{}
+
+// WithReadAfter makes reads through ctx see the writes token stands
+// for: they go to a replica that has replayed them, or to the primary.
+// token comes from ConsistencyToken, usually of an earlier request.
+func WithReadAfter(ctx context.Context, token string) (context.Context, error) {
+	lsn, err := parseLSN(token)
+	if err != nil {
+		return ctx, ErrInvalidConsistencyToken
+	}
+	return context.WithValue(ctx, readAfterKey{}, lsn), nil
+}
+
+// WithWriteTracking records the writes made through ctx, so that
+// ConsistencyToken can report them.
+func WithWriteTracking(ctx context.Context) context.Context {
+	return context.WithValue(ctx, writesKey{}, &writeTracker{})
+}
+
+// ConsistencyToken returns a token for the writes made through ctx
+// (see WithWriteTracking), to pass to WithReadAfter on later reads.
+// Call it once the writes are committed. It returns "" when there were
+// none or reads are not spread over replicas.
+func ConsistencyToken(ctx context.Context) (string, error) {
+	w, _ := ctx.Value(writesKey{}).(*writeTracker)
+	if w == nil {
+		return "", nil
+	}
+
+	primary := w.get()
+	if primary == nil {
+		return "", nil
+	}
+
+	// Past the commit of every write made through ctx.
+	var lsn string
+	err := primary.QueryRowContext(ctx, `SELECT pg_current_wal_lsn()::text`).Scan(&lsn)
+	return lsn, err
+}
+
+// WithPrimaryReads marks ctx as needing up-to-date reads: every read
+// made through it goes to the primary.
+func WithPrimaryReads(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryReadsKey{}, true)
+}
+
+func readAfter(ctx context.Context) (uint64, bool) {
+	lsn, ok := ctx.Value(readAfterKey{}).(uint64)
+	return lsn, ok
+}
+
+func primaryReads(ctx context.Context) bool {
+	v, _ := ctx.Value(primaryReadsKey{}).(bool)
+	return v
+}
+
+// writeTracker holds the primary written to, nil until the first write.
+type writeTracker struct {
+	mu      sync.Mutex
+	primary *sql.DB
+}
+
+func (w *writeTracker) set(primary *sql.DB) {
+	w.mu.Lock()
+	w.primary = primary
+	w.mu.Unlock()
+}
+
+func (w *writeTracker) get() *sql.DB {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.primary
+}
+
+// parseLSN parses a WAL position as PostgreSQL prints it ("16/B374D848").
+func parseLSN(s string) (uint64, error) {
+	hi, lo, ok := strings.Cut(s, "/")
+	if !ok {
+		return 0, fmt.Errorf("invalid lsn %q", s)
+	}
+
+	h, err := strconv.ParseUint(hi, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid lsn %q", s)
+	}
+	l, err := strconv.ParseUint(lo, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid lsn %q", s)
+	}
+
+	return h<<32 | l, nil
+}
+
+//
+// =========================
+// ReplicaSet
+// =========================
+// Routes reads to healthy replicas
+//
+
+type ReplicaConfig struct {
+	// MaxLag takes a replica out of rotation while it is further behind.
+	MaxLag time.Duration
+	// CheckInterval is the time between replica health checks.
+	CheckInterval time.Duration
+}
+
+func DefaultReplicaConfig() ReplicaConfig {
+	return ReplicaConfig{
+		MaxLag:        10 * time.Second,
+		CheckInterval: 5 * time.Second,
+	}
+}
+
+type Replica struct {
+	Name string
+	DB   *sql.DB
+}
+
+type replica struct {
+	Replica
+	// healthy starts false: reads go to the primary until the first
+	// check passes.
+	healthy atomic.Bool
+	// replayed is the WAL position the replica had replayed at the last
+	// check. It only lags the real one, so reads after a position at or
+	// below it are safe there.
+	replayed atomic.Uint64
+}
+
+// ReplicaSet picks the pool for each read: a healthy replica when one
+// is available, the primary when there is none, inside a transaction,
+// or when no replica has replayed the writes a read must see.
+type ReplicaSet struct {
+	primary  *sql.DB
+	replicas []*replica
+	cfg      ReplicaConfig
+	logger   *slog.Logger
+
+	next atomic.Uint64
+}
+
+func NewReplicaSet(
+	primary *sql.DB,
+	replicas []Replica,
+	cfg ReplicaConfig,
+	logger *slog.Logger,
+) *ReplicaSet {
+
+	rs := &ReplicaSet{
+		primary: primary,
+		cfg:     cfg,
+		logger:  logger,
+	}
+
+	for _, r := range replicas {
+		rs.replicas = append(rs.replicas, &replica{Replica: r})
+	}
+
+	return rs
+}
+
+// Replicas returns the replicas the set routes reads to.
+func (rs *ReplicaSet) Replicas() []Replica {
+	out := make([]Replica, len(rs.replicas))
+	for i, r := range rs.replicas {
+		out[i] = r.Replica
+	}
+	return out
+}
+
+// reader returns the pool a read through ctx should use.
+func (rs *ReplicaSet) reader(ctx context.Context) *sql.DB {
+	if primaryReads(ctx) {
+		metrics.DBReads.WithLabelValues("primary").Inc()
+		return rs.primary
+	}
+
+	after, hasAfter := readAfter(ctx)
+
+	// Round-robin over healthy replicas that have caught up
+	n := len(rs.replicas)
+	start := int(rs.next.Add(1) % uint64(max(n, 1)))
+
+	for i := range n {
+		r := rs.replicas[(start+i)%n]
+		if r.healthy.Load() && (!hasAfter || r.replayed.Load() >= after) {
+			metrics.DBReads.WithLabelValues("replica").Inc()
+			return r.DB
+		}
+	}
+
+	metrics.DBReads.WithLabelValues("primary").Inc()
+	return rs.primary
+}
+
+// noteWrite records a write through ctx for ConsistencyToken.
+func (rs *ReplicaSet) noteWrite(ctx context.Context) {
+	if w, ok := ctx.Value(writesKey{}).(*writeTracker); ok {
+		w.set(rs.primary)
+	}
+}
+
+// Run checks replica health every CheckInterval until ctx is cancelled.
+func (rs *ReplicaSet) Run(ctx context.Context) {
+	ticker := time.NewTicker(rs.cfg.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		rs.CheckReplicas(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckReplicas measures every replica's lag and takes those that are
+// unreachable or too far behind out of rotation.
+func (rs *ReplicaSet) CheckReplicas(ctx context.Context) {
+	for _, r := range rs.replicas {
+		lag, replayed, err := replicaLag(ctx, r.DB, rs.cfg.CheckInterval)
+		if err == nil {
+			r.replayed.Store(replayed)
+		}
+
+		healthy := err == nil && lag <= rs.cfg.MaxLag
+		if was := r.healthy.Swap(healthy); was != healthy {
+			rs.logger.Warn("replica health changed",
+				"replica", r.Name,
+				"healthy", healthy,
+				"lag", lag.String(),
+				"error", err,
+			)
+		}
+
+		if err == nil {
+			metrics.ReplicaLag.WithLabelValues(r.Name).Set(lag.Seconds())
+		}
+		metrics.ReplicaHealthy.WithLabelValues(r.Name).Set(boolGauge(healthy))
+	}
+}
+
+// replicaLag returns how far behind the primary a standby is, and the
+// WAL position it has replayed.
+// An idle primary looks like growing lag, so a standby that has
+// replayed everything it received reports zero.
+func replicaLag(ctx context.Context, db *sql.DB, timeout time.Duration) (time.Duration, uint64, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// A server that is not in recovery has replayed everything it has.
+	query := `
+		SELECT CASE
+			WHEN NOT pg_is_in_recovery() THEN 0
+			WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+			ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+		END::float8,
+		COALESCE(CASE
+			WHEN pg_is_in_recovery() THEN pg_last_wal_replay_lsn()
+			ELSE pg_current_wal_lsn()
+		END, '0/0')::text
+	`
+
+	var (
+		seconds float64
+		lsn     string
+	)
+	if err := db.QueryRowContext(ctx, query).Scan(&seconds, &lsn); err != nil {
+		return 0, 0, err
+	}
+
+	replayed, err := parseLSN(lsn)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return time.Duration(seconds * float64(time.Second)), replayed, nil
+}
+
+func boolGauge(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
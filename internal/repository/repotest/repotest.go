@@ -0,0 +1,1063 @@
+// Package repotest provides a conformance suite for repository.UserRepository.
+//
+// The interface comments in repository/user_repository.go are the spec;
+// this suite is how implementations prove they follow it. Call
+// TestUserRepository from a test with a factory that returns an empty
+// repository for every subtest.
+package repotest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"go-prod-app/internal/domain"
+	"go-prod-app/internal/repository"
+)
+
+// Repository is what the suite exercises.
+type Repository interface {
+	repository.UserRepository
+	repository.HealthChecker
+}
+
+// Factory returns an empty repository. It is called once per subtest.
+type Factory func(t *testing.T) Repository
+
+// TestUserRepository runs the full contract against the repository
+// returned by newRepo.
+func TestUserRepository(t *testing.T, newRepo Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, repo Repository)
+	}{
+		{"CreateAssignsIDAndVersion", testCreateAssignsIDAndVersion},
+		{"CreateDuplicateEmail", testCreateDuplicateEmail},
+		{"GetByIDNotFound", testGetByIDNotFound},
+		{"GetByIDReturnsDeleted", testGetByIDReturnsDeleted},
+		{"GetByEmail", testGetByEmail},
+		{"GetByEmailExcludesDeleted", testGetByEmailExcludesDeleted},
+		{"UpdateIncreasesVersion", testUpdateIncreasesVersion},
+		{"UpdateVersionConflict", testUpdateVersionConflict},
+		{"UpdateDuplicateEmail", testUpdateDuplicateEmail},
+		{"EmailReusableAfterDelete", testEmailReusableAfterDelete},
+		{"RestoreEmailTaken", testRestoreEmailTaken},
+		{"UpsertByEmail", testUpsertByEmail},
+		{"UpsertByEmailIgnoresDeleted", testUpsertByEmailIgnoresDeleted},
+		{"ListRejectsInvalidLimit", testListRejectsInvalidLimit},
+		{"ListExcludesDeleted", testListExcludesDeleted},
+		{"ListEmailFilter", testListEmailFilter},
+		{"ListCreatedRange", testListCreatedRange},
+		{"ListKeysetPagination", testListKeysetPagination},
+		{"ListSortedPagination", testListSortedPagination},
+		{"ListCursorBoundToSort", testListCursorBoundToSort},
+		{"ListBackwardPagination", testListBackwardPagination},
+		{"ListQuery", testListQuery},
+		{"ListSortRelevance", testListSortRelevance},
+		{"Count", testCount},
+		{"TenantIsolation", testTenantIsolation},
+		{"CrossTenantAccess", testCrossTenantAccess},
+		{"ListVersions", testListVersions},
+		{"GetAsOf", testGetAsOf},
+		{"Ping", testPing},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newRepo(t))
+		})
+	}
+}
+
+// OpenPostgres connects to the database in TEST_DB_DSN, which must be
+// migrated to repository.PostgresSchemaVersion, and empties the users
+// table. The test is skipped when TEST_DB_DSN is not set.
+func OpenPostgres(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DB_DSN not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	if _, err := db.Exec(`TRUNCATE users CASCADE`); err != nil {
+		t.Fatalf("truncate users: %v", err)
+	}
+
+	return db
+}
+
+//
+// =========================
+// Create
+// =========================
+//
+
+func testCreateAssignsIDAndVersion(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	u := mustCreate(t, repo, "Alice", "alice@example.com")
+
+	if u.ID() == "" {
+		t.Fatal("expected ID to be set after Create")
+	}
+
+	got, err := repo.GetByID(ctx, u.ID())
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+
+	if got.Name() != "Alice" || got.Email() != "alice@example.com" {
+		t.Errorf("got %q <%s>, want Alice <alice@example.com>", got.Name(), got.Email())
+	}
+	if got.Version() != 1 {
+		t.Errorf("version = %d, want 1", got.Version())
+	}
+	if got.IsDeleted() {
+		t.Error("new user must not be deleted")
+	}
+}
+
+func testCreateDuplicateEmail(t *testing.T, repo Repository) {
+	mustCreate(t, repo, "Alice", "alice@example.com")
+
+	dup := newUser(t, "Other Alice", "ALICE@example.com")
+
+	err := repo.Create(context.Background(), dup)
+	if !errors.Is(err, repository.ErrDuplicateEmail) {
+		t.Fatalf("err = %v, want ErrDuplicateEmail", err)
+	}
+	if dup.ID() != "" {
+		t.Error("ID must not be set when Create fails")
+	}
+}
+
+//
+// =========================
+// Read
+// =========================
+//
+
+func testGetByIDNotFound(t *testing.T, repo Repository) {
+	_, err := repo.GetByID(context.Background(), "0190b1a2-0000-7000-8000-000000000000")
+	if !errors.Is(err, repository.ErrUserNotFound) {
+		t.Fatalf("err = %v, want ErrUserNotFound", err)
+	}
+}
+
+func testGetByIDReturnsDeleted(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	u := mustCreate(t, repo, "Alice", "alice@example.com")
+	mustDelete(t, repo, u)
+
+	got, err := repo.GetByID(ctx, u.ID())
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if !got.IsDeleted() {
+		t.Error("expected deleted user to be returned with DeletedAt set")
+	}
+}
+
+func testGetByEmail(t *testing.T, repo Repository) {
+	u := mustCreate(t, repo, "Alice", "alice@example.com")
+
+	got, err := repo.GetByEmail(context.Background(), "ALICE@Example.com")
+	if err != nil {
+		t.Fatalf("GetByEmail: %v", err)
+	}
+	if got.ID() != u.ID() {
+		t.Errorf("id = %s, want %s", got.ID(), u.ID())
+	}
+
+	_, err = repo.GetByEmail(context.Background(), "nobody@example.com")
+	if !errors.Is(err, repository.ErrUserNotFound) {
+		t.Fatalf("err = %v, want ErrUserNotFound", err)
+	}
+}
+
+func testGetByEmailExcludesDeleted(t *testing.T, repo Repository) {
+	u := mustCreate(t, repo, "Alice", "alice@example.com")
+	mustDelete(t, repo, u)
+
+	_, err := repo.GetByEmail(context.Background(), "alice@example.com")
+	if !errors.Is(err, repository.ErrUserNotFound) {
+		t.Fatalf("err = %v, want ErrUserNotFound", err)
+	}
+}
+
+//
+// =========================
+// Update
+// =========================
+//
+
+func testUpdateIncreasesVersion(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	u := mustCreate(t, repo, "Alice", "alice@example.com")
+
+	if err := u.ChangeName("Alice Smith", time.Now().UTC()); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Update(ctx, u); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if u.Version() != 2 {
+		t.Errorf("in-memory version = %d, want 2", u.Version())
+	}
+
+	got, err := repo.GetByID(ctx, u.ID())
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if got.Version() != 2 || got.Name() != "Alice Smith" {
+		t.Errorf("stored = v%d %q, want v2 \"Alice Smith\"", got.Version(), got.Name())
+	}
+}
+
+func testUpdateVersionConflict(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	u := mustCreate(t, repo, "Alice", "alice@example.com")
+
+	first, err := repo.GetByID(ctx, u.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := repo.GetByID(ctx, u.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = first.ChangeName("First Writer", time.Now().UTC())
+	if err := repo.Update(ctx, first); err != nil {
+		t.Fatalf("first Update: %v", err)
+	}
+
+	_ = second.ChangeName("Second Writer", time.Now().UTC())
+	err = repo.Update(ctx, second)
+	if !errors.Is(err, repository.ErrVersionConflict) {
+		t.Fatalf("err = %v, want ErrVersionConflict", err)
+	}
+	if second.Version() != 1 {
+		t.Errorf("version = %d, must not change on conflict", second.Version())
+	}
+}
+
+func testUpdateDuplicateEmail(t *testing.T, repo Repository) {
+	mustCreate(t, repo, "Alice", "alice@example.com")
+	bob := mustCreate(t, repo, "Bob", "bob@example.com")
+
+	_ = bob.ChangeEmail("alice@example.com", time.Now().UTC())
+
+	err := repo.Update(context.Background(), bob)
+	if !errors.Is(err, repository.ErrDuplicateEmail) {
+		t.Fatalf("err = %v, want ErrDuplicateEmail", err)
+	}
+}
+
+func testEmailReusableAfterDelete(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	old := mustCreate(t, repo, "Alice", "alice@example.com")
+	mustDelete(t, repo, old)
+
+	reused := mustCreate(t, repo, "New Alice", "alice@example.com")
+
+	got, err := repo.GetByEmail(ctx, "alice@example.com")
+	if err != nil {
+		t.Fatalf("GetByEmail: %v", err)
+	}
+	if got.ID() != reused.ID() {
+		t.Errorf("GetByEmail = %s, want the active user %s", got.ID(), reused.ID())
+	}
+}
+
+func testRestoreEmailTaken(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	old := mustCreate(t, repo, "Alice", "alice@example.com")
+	mustDelete(t, repo, old)
+	mustCreate(t, repo, "New Alice", "alice@example.com")
+
+	if err := old.Restore(time.Now().UTC()); err != nil {
+		t.Fatal(err)
+	}
+
+	err := repo.Update(ctx, old)
+	if !errors.Is(err, repository.ErrDuplicateEmail) {
+		t.Fatalf("err = %v, want ErrDuplicateEmail", err)
+	}
+
+	got, err := repo.GetByID(ctx, old.ID())
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if !got.IsDeleted() {
+		t.Error("user must stay deleted when restore conflicts")
+	}
+}
+
+//
+// =========================
+// List
+// =========================
+//
+
+func testUpsertByEmail(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	steps := []struct {
+		name    string
+		outcome repository.UpsertOutcome
+		version int
+	}{
+		{"Alice", repository.UpsertCreated, 1},
+		{"Alice", repository.UpsertUnchanged, 1},
+		{"Alice Smith", repository.UpsertUpdated, 2},
+	}
+
+	var id domain.UserID
+	for _, step := range steps {
+		got, outcome, err := repo.UpsertByEmail(ctx, newUser(t, step.name, "alice@example.com"))
+		if err != nil {
+			t.Fatalf("UpsertByEmail(%q): %v", step.name, err)
+		}
+		if outcome != step.outcome || got.Version() != step.version || got.Name() != step.name {
+			t.Errorf("UpsertByEmail(%q) = %s v%d %q, want %s v%d",
+				step.name, outcome, got.Version(), got.Name(), step.outcome, step.version)
+		}
+		if id == "" {
+			id = got.ID()
+		} else if got.ID() != id {
+			t.Errorf("UpsertByEmail(%q) id = %s, want %s", step.name, got.ID(), id)
+		}
+	}
+
+	stored, err := repo.GetByID(ctx, id)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if stored.Version() != 2 || stored.Name() != "Alice Smith" {
+		t.Errorf("stored = v%d %q, want v2 \"Alice Smith\"", stored.Version(), stored.Name())
+	}
+}
+
+func testUpsertByEmailIgnoresDeleted(t *testing.T, repo Repository) {
+	old := mustCreate(t, repo, "Alice", "alice@example.com")
+	mustDelete(t, repo, old)
+
+	got, outcome, err := repo.UpsertByEmail(context.Background(), newUser(t, "Alice", "alice@example.com"))
+	if err != nil {
+		t.Fatalf("UpsertByEmail: %v", err)
+	}
+	if outcome != repository.UpsertCreated || got.ID() == old.ID() {
+		t.Errorf("UpsertByEmail = %s %s, want a new user", outcome, got.ID())
+	}
+}
+
+func testListRejectsInvalidLimit(t *testing.T, repo Repository) {
+	_, err := repo.List(context.Background(), repository.UserFilter{}, nil, 0)
+	if err == nil {
+		t.Fatal("expected error for limit 0")
+	}
+}
+
+func testListExcludesDeleted(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	alice := mustCreate(t, repo, "Alice", "alice@example.com")
+	bob := mustCreate(t, repo, "Bob", "bob@example.com")
+	mustDelete(t, repo, bob)
+
+	page, err := repo.List(ctx, repository.UserFilter{}, nil, 10)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	assertIDs(t, page.Users, alice.ID())
+
+	page, err = repo.List(ctx, repository.UserFilter{IncludeDeleted: true}, nil, 10)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	assertIDs(t, page.Users, alice.ID(), bob.ID())
+}
+
+func testListEmailFilter(t *testing.T, repo Repository) {
+	mustCreate(t, repo, "Alice", "alice@example.com")
+	bob := mustCreate(t, repo, "Bob", "bob@example.com")
+
+	email := "BOB@example.com"
+
+	page, err := repo.List(
+		context.Background(),
+		repository.UserFilter{Email: &email},
+		nil,
+		10,
+	)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	assertIDs(t, page.Users, bob.ID())
+}
+
+func testListCreatedRange(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	mustCreate(t, repo, "Alice", "alice@example.com")
+	after := tick()
+	bob := mustCreate(t, repo, "Bob", "bob@example.com")
+	before := tick()
+	mustCreate(t, repo, "Carol", "carol@example.com")
+
+	filter := repository.UserFilter{
+		CreatedAfter:  &after,
+		CreatedBefore: &before,
+	}
+
+	page, err := repo.List(ctx, filter, nil, 10)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	assertIDs(t, page.Users, bob.ID())
+
+	n, err := repo.Count(ctx, filter)
+	if err != nil {
+		t.Fatalf("Count: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("count = %d, want 1", n)
+	}
+}
+
+func testListKeysetPagination(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	var want []domain.UserID
+	for _, e := range []string{"a@example.com", "b@example.com", "c@example.com", "d@example.com", "e@example.com"} {
+		want = append(want, mustCreate(t, repo, "User "+e[:1], e).ID())
+	}
+
+	var (
+		got    []domain.UserID
+		cursor *repository.Cursor
+		pages  int
+	)
+
+	for {
+		page, err := repo.List(ctx, repository.UserFilter{}, cursor, 2)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		for _, u := range page.Users {
+			got = append(got, u.ID())
+		}
+		pages++
+
+		if page.HasMore != (page.Next != nil) {
+			t.Fatalf("page %d: has_more = %v with next = %v", pages, page.HasMore, page.Next)
+		}
+		if (pages > 1) != (page.Prev != nil) {
+			t.Fatalf("page %d: prev = %v", pages, page.Prev)
+		}
+
+		if page.Next == nil {
+			break
+		}
+		if pages > len(want) {
+			t.Fatal("pagination did not terminate")
+		}
+		cursor = page.Next
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d users, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("position %d: got %s, want %s (must be ordered by id)", i, got[i], want[i])
+		}
+	}
+	if pages != 3 {
+		t.Errorf("pages = %d, want 3", pages)
+	}
+}
+
+func testListSortedPagination(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	// Duplicate names exercise the id tiebreaker.
+	for _, e := range []string{"b1@example.com", "c@example.com", "a@example.com", "b2@example.com", "d@example.com"} {
+		mustCreate(t, repo, "User "+e[:1], e)
+	}
+
+	sort, err := repository.ParseUserSort("-name")
+	if err != nil {
+		t.Fatalf("ParseUserSort: %v", err)
+	}
+	filter := repository.UserFilter{Sort: sort}
+
+	var (
+		got    []*domain.User
+		cursor *repository.Cursor
+	)
+
+	for range 5 {
+		page, err := repo.List(ctx, filter, cursor, 2)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		got = append(got, page.Users...)
+
+		if page.Next == nil {
+			break
+		}
+		cursor = page.Next
+	}
+
+	if len(got) != 5 {
+		t.Fatalf("got %d users, want 5", len(got))
+	}
+	for i := 1; i < len(got); i++ {
+		a, b := got[i-1], got[i]
+		if a.Name() < b.Name() || (a.Name() == b.Name() && a.ID() < b.ID()) {
+			t.Fatalf("position %d: %s/%s after %s/%s (must be ordered by name DESC, id DESC)",
+				i, b.Name(), b.ID(), a.Name(), a.ID())
+		}
+	}
+}
+
+func testListCursorBoundToSort(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	mustCreate(t, repo, "Alice", "alice@example.com")
+	mustCreate(t, repo, "Bob", "bob@example.com")
+
+	page, err := repo.List(ctx, repository.UserFilter{}, nil, 1)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if page.Next == nil {
+		t.Fatal("expected a next cursor")
+	}
+
+	filter := repository.UserFilter{
+		Sort: repository.UserSort{Field: repository.SortByCreatedAt, Desc: true},
+	}
+
+	_, err = repo.List(ctx, filter, page.Next, 1)
+	if !errors.Is(err, repository.ErrInvalidCursor) {
+		t.Fatalf("err = %v, want ErrInvalidCursor", err)
+	}
+}
+
+func testListBackwardPagination(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	var want []domain.UserID
+	for _, e := range []string{"a@example.com", "b@example.com", "c@example.com", "d@example.com", "e@example.com"} {
+		want = append(want, mustCreate(t, repo, "User "+e[:1], e).ID())
+	}
+
+	filter := repository.UserFilter{
+		Sort: repository.UserSort{Field: repository.SortByCreatedAt, Desc: true},
+	}
+	slices.Reverse(want)
+
+	// Last page holds the remainder, still in list order.
+	page, err := repo.List(ctx, filter, repository.LastPage(), 2)
+	if err != nil {
+		t.Fatalf("List last page: %v", err)
+	}
+	assertIDs(t, page.Users, want[3], want[4])
+	if page.Next != nil {
+		t.Error("last page must not have a next cursor")
+	}
+	if page.Prev == nil || !page.HasMore {
+		t.Fatal("last page must have a prev cursor and has_more")
+	}
+
+	page, err = repo.List(ctx, filter, page.Prev, 2)
+	if err != nil {
+		t.Fatalf("List prev: %v", err)
+	}
+	assertIDs(t, page.Users, want[1], want[2])
+	if page.Next == nil || page.Prev == nil {
+		t.Fatal("middle page must have prev and next cursors")
+	}
+
+	page, err = repo.List(ctx, filter, page.Prev, 2)
+	if err != nil {
+		t.Fatalf("List prev: %v", err)
+	}
+	assertIDs(t, page.Users, want[0])
+	if page.Prev != nil || page.HasMore {
+		t.Error("first page must not have a prev cursor or has_more")
+	}
+
+	// And forward again from there.
+	page, err = repo.List(ctx, filter, page.Next, 2)
+	if err != nil {
+		t.Fatalf("List next: %v", err)
+	}
+	assertIDs(t, page.Users, want[1], want[2])
+}
+
+//
+// =========================
+// Search
+// =========================
+//
+
+func testListQuery(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	alice := mustCreate(t, repo, "Alice Smith", "alice@example.com")
+	bob := mustCreate(t, repo, "Bob Jones", "bob@example.com")
+	carol := mustCreate(t, repo, "Carol Smith", "carol@example.com")
+	mustDelete(t, repo, carol)
+
+	list := func(q string, filter repository.UserFilter) []*domain.User {
+		t.Helper()
+		filter.Query = &q
+		filter.Sort = repository.UserSort{Field: repository.SortByID}
+		page, err := repo.List(ctx, filter, nil, 10)
+		if err != nil {
+			t.Fatalf("List(q=%q): %v", q, err)
+		}
+		return page.Users
+	}
+
+	// part of a name, in any case
+	assertIDs(t, list("SMITH", repository.UserFilter{}), alice.ID())
+	assertIDs(t, list("smith", repository.UserFilter{IncludeDeleted: true}), sortedIDs(alice, carol)...)
+
+	// a whole email only
+	assertIDs(t, list("bob@example.com", repository.UserFilter{}), bob.ID())
+	assertIDs(t, list("bob@example", repository.UserFilter{}))
+
+	q := "smith"
+	n, err := repo.Count(ctx, repository.UserFilter{Query: &q})
+	if err != nil {
+		t.Fatalf("Count: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("count = %d, want 1", n)
+	}
+}
+
+func testListSortRelevance(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	partial := mustCreate(t, repo, "Ann Blacksmith", "ann@example.com")
+	mustCreate(t, repo, "Bob Jones", "bob@example.com")
+	exact := mustCreate(t, repo, "Smith", "smith@example.com")
+
+	if _, err := repo.List(ctx, repository.UserFilter{
+		Sort: repository.UserSort{Field: repository.SortByRelevance, Desc: true},
+	}, nil, 10); !errors.Is(err, repository.ErrInvalidSort) {
+		t.Errorf("relevance without a query: err = %v, want ErrInvalidSort", err)
+	}
+
+	// The zero Sort ranks a query; page through one user at a time so
+	// the relevance cursor is exercised too.
+	q := "smith"
+	filter := repository.UserFilter{Query: &q}
+
+	var (
+		got    []*domain.User
+		cursor *repository.Cursor
+	)
+
+	for range 3 {
+		page, err := repo.List(ctx, filter, cursor, 1)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		got = append(got, page.Users...)
+
+		if page.Next == nil {
+			break
+		}
+		cursor = page.Next
+	}
+
+	assertIDs(t, got, exact.ID(), partial.ID())
+
+	// the email ranks its user first
+	q = "ann@example.com"
+	page, err := repo.List(ctx, repository.UserFilter{Query: &q}, nil, 10)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(page.Users) == 0 || page.Users[0].ID() != partial.ID() {
+		t.Errorf("query by email: first user is not %s", partial.ID())
+	}
+}
+
+//
+// =========================
+// Count / Health
+// =========================
+//
+
+func testCount(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	mustCreate(t, repo, "Alice", "alice@example.com")
+	bob := mustCreate(t, repo, "Bob", "bob@example.com")
+	mustDelete(t, repo, bob)
+
+	n, err := repo.Count(ctx, repository.UserFilter{})
+	if err != nil {
+		t.Fatalf("Count: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("count = %d, want 1", n)
+	}
+
+	n, err = repo.Count(ctx, repository.UserFilter{IncludeDeleted: true})
+	if err != nil {
+		t.Fatalf("Count: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("count including deleted = %d, want 2", n)
+	}
+}
+
+//
+// =========================
+// Tenants
+// =========================
+//
+
+func testTenantIsolation(t *testing.T, repo Repository) {
+	acme := repository.WithTenant(context.Background(), "acme")
+	globex := repository.WithTenant(context.Background(), "globex")
+
+	alice := newUser(t, "Alice", "alice@example.com")
+	if err := repo.Create(acme, alice); err != nil {
+		if errors.Is(err, repository.ErrTenantNotSupported) {
+			t.Skip("single-tenant repository")
+		}
+		t.Fatalf("Create(acme): %v", err)
+	}
+
+	// the same email is free in another tenant
+	other := newUser(t, "Alice", "alice@example.com")
+	if err := repo.Create(globex, other); err != nil {
+		t.Fatalf("Create(globex): %v", err)
+	}
+
+	if _, err := repo.GetByID(globex, alice.ID()); !errors.Is(err, repository.ErrUserNotFound) {
+		t.Errorf("GetByID from another tenant: err = %v, want ErrUserNotFound", err)
+	}
+
+	got, err := repo.GetByEmail(globex, "alice@example.com")
+	if err != nil {
+		t.Fatalf("GetByEmail: %v", err)
+	}
+	if got.ID() != other.ID() {
+		t.Errorf("GetByEmail = %s, want %s", got.ID(), other.ID())
+	}
+
+	page, err := repo.List(acme, repository.UserFilter{}, nil, 10)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	assertIDs(t, page.Users, alice.ID())
+
+	n, err := repo.Count(globex, repository.UserFilter{})
+	if err != nil {
+		t.Fatalf("Count: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("count = %d, want 1", n)
+	}
+
+	if err := alice.ChangeName("Alice Smith", time.Now().UTC()); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Update(globex, alice); !errors.Is(err, repository.ErrVersionConflict) {
+		t.Errorf("Update from another tenant: err = %v, want ErrVersionConflict", err)
+	}
+}
+
+// testCrossTenantAccess reads and writes a default-tenant user from
+// another tenant. Single-tenant repositories may refuse the tenant
+// outright; none may hand out or change the user.
+func testCrossTenantAccess(t *testing.T, repo Repository) {
+	ctx := context.Background()
+	acme := repository.WithTenant(ctx, "acme")
+
+	alice := mustCreate(t, repo, "Alice", "alice@example.com")
+
+	refused := func(err error, want error) bool {
+		return errors.Is(err, want) || errors.Is(err, repository.ErrTenantNotSupported)
+	}
+
+	if _, err := repo.GetByID(acme, alice.ID()); !refused(err, repository.ErrUserNotFound) {
+		t.Errorf("GetByID from another tenant: err = %v, want ErrUserNotFound", err)
+	}
+
+	if _, err := repo.GetByEmail(acme, "alice@example.com"); !refused(err, repository.ErrUserNotFound) {
+		t.Errorf("GetByEmail from another tenant: err = %v, want ErrUserNotFound", err)
+	}
+
+	if err := alice.ChangeName("Mallory", time.Now().UTC()); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Update(acme, alice); !refused(err, repository.ErrVersionConflict) {
+		t.Errorf("Update from another tenant: err = %v, want ErrVersionConflict", err)
+	}
+
+	got, err := repo.GetByID(ctx, alice.ID())
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if got.Name() != "Alice" || got.Version() != 1 {
+		t.Errorf("after Update from another tenant: name = %q, version = %d, want Alice, 1",
+			got.Name(), got.Version())
+	}
+}
+
+//
+// =========================
+// History
+// =========================
+// Only for repositories that implement UserHistoryRepository
+//
+
+func historyOf(t *testing.T, repo Repository) repository.UserHistoryRepository {
+	t.Helper()
+
+	h, ok := repo.(repository.UserHistoryRepository)
+	if !ok {
+		t.Skip("no version history")
+	}
+	return h
+}
+
+func testListVersions(t *testing.T, repo Repository) {
+	history := historyOf(t, repo)
+	ctx := repository.WithActor(context.Background(), "admin")
+
+	u := newUser(t, "Alice", "alice@example.com")
+	if err := repo.Create(ctx, u); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := u.ChangeName("Alice Smith", time.Now().UTC()); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Update(ctx, u); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	mustDelete(t, repo, u)
+
+	versions, err := history.ListVersions(ctx, u.ID(), 0, 10)
+	if err != nil {
+		t.Fatalf("ListVersions: %v", err)
+	}
+	if len(versions) != 3 {
+		t.Fatalf("got %d versions, want 3", len(versions))
+	}
+
+	want := []struct {
+		version   int
+		name      string
+		fields    []string
+		changedBy string
+		deleted   bool
+	}{
+		{3, "Alice Smith", []string{repository.FieldDeletedAt}, "", true},
+		{2, "Alice Smith", []string{repository.FieldName}, "admin", false},
+		{1, "Alice", []string{repository.FieldName, repository.FieldEmail}, "admin", false},
+	}
+
+	for i, w := range want {
+		v := versions[i]
+		if v.User.Version() != w.version || v.User.Name() != w.name {
+			t.Errorf("position %d: version %d %q, want %d %q", i, v.User.Version(), v.User.Name(), w.version, w.name)
+		}
+		if v.User.Email() != "alice@example.com" {
+			t.Errorf("version %d: email = %q, want alice@example.com", w.version, v.User.Email())
+		}
+		if !slices.Equal(v.ChangedFields, w.fields) {
+			t.Errorf("version %d: changed fields = %v, want %v", w.version, v.ChangedFields, w.fields)
+		}
+		if v.ChangedBy != w.changedBy {
+			t.Errorf("version %d: changed by = %q, want %q", w.version, v.ChangedBy, w.changedBy)
+		}
+		if v.User.IsDeleted() != w.deleted {
+			t.Errorf("version %d: deleted = %v, want %v", w.version, v.User.IsDeleted(), w.deleted)
+		}
+	}
+
+	// paging with beforeVersion
+	versions, err = history.ListVersions(ctx, u.ID(), 3, 1)
+	if err != nil {
+		t.Fatalf("ListVersions: %v", err)
+	}
+	if len(versions) != 1 || versions[0].User.Version() != 2 {
+		t.Errorf("before version 3, limit 1: got %d versions, want version 2", len(versions))
+	}
+
+	if _, err := history.ListVersions(ctx, u.ID(), 0, 0); err == nil {
+		t.Error("ListVersions with limit 0 succeeded")
+	}
+
+	versions, err = history.ListVersions(ctx, "0190b1a2-0000-7000-8000-000000000000", 0, 10)
+	if err != nil {
+		t.Fatalf("ListVersions of an unknown user: %v", err)
+	}
+	if len(versions) != 0 {
+		t.Errorf("unknown user: got %d versions, want 0", len(versions))
+	}
+
+	versions, err = history.ListVersions(repository.WithTenant(ctx, "acme"), u.ID(), 0, 10)
+	if err != nil && !errors.Is(err, repository.ErrTenantNotSupported) {
+		t.Fatalf("ListVersions from another tenant: %v", err)
+	}
+	if len(versions) != 0 {
+		t.Errorf("another tenant: got %d versions, want 0", len(versions))
+	}
+}
+
+func testGetAsOf(t *testing.T, repo Repository) {
+	history := historyOf(t, repo)
+	ctx := context.Background()
+
+	before := tick()
+	u := mustCreate(t, repo, "Alice", "alice@example.com")
+	created := tick()
+
+	if err := u.ChangeName("Alice Smith", time.Now().UTC()); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Update(ctx, u); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	renamed := tick()
+
+	mustDelete(t, repo, u)
+
+	if _, err := history.GetAsOf(ctx, u.ID(), before); !errors.Is(err, repository.ErrUserNotFound) {
+		t.Errorf("before Create: err = %v, want ErrUserNotFound", err)
+	}
+
+	for _, tt := range []struct {
+		at      time.Time
+		name    string
+		version int
+		deleted bool
+	}{
+		{created, "Alice", 1, false},
+		{renamed, "Alice Smith", 2, false},
+		{time.Now().UTC(), "Alice Smith", 3, true},
+	} {
+		got, err := history.GetAsOf(ctx, u.ID(), tt.at)
+		if err != nil {
+			t.Fatalf("GetAsOf(%v): %v", tt.at, err)
+		}
+		if got.Name() != tt.name || got.Version() != tt.version || got.IsDeleted() != tt.deleted {
+			t.Errorf("GetAsOf(%v) = %q v%d deleted=%v, want %q v%d deleted=%v",
+				tt.at, got.Name(), got.Version(), got.IsDeleted(), tt.name, tt.version, tt.deleted)
+		}
+	}
+
+	if _, err := history.GetAsOf(ctx, "0190b1a2-0000-7000-8000-000000000000", time.Now().UTC()); !errors.Is(err, repository.ErrUserNotFound) {
+		t.Errorf("unknown user: err = %v, want ErrUserNotFound", err)
+	}
+
+	acme := repository.WithTenant(ctx, "acme")
+	if _, err := history.GetAsOf(acme, u.ID(), time.Now().UTC()); !errors.Is(err, repository.ErrUserNotFound) &&
+		!errors.Is(err, repository.ErrTenantNotSupported) {
+		t.Errorf("from another tenant: err = %v, want ErrUserNotFound", err)
+	}
+}
+
+func testPing(t *testing.T, repo Repository) {
+	if err := repo.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+}
+
+//
+// =========================
+// Helpers
+// =========================
+//
+
+func newUser(t *testing.T, name, email string) *domain.User {
+	t.Helper()
+
+	u, err := domain.NewUser(name, email, time.Now().UTC())
+	if err != nil {
+		t.Fatalf("NewUser(%q, %q): %v", name, email, err)
+	}
+	return u
+}
+
+func mustCreate(t *testing.T, repo Repository, name, email string) *domain.User {
+	t.Helper()
+
+	u := newUser(t, name, email)
+	if err := repo.Create(context.Background(), u); err != nil {
+		t.Fatalf("Create(%s): %v", email, err)
+	}
+	return u
+}
+
+func mustDelete(t *testing.T, repo Repository, u *domain.User) {
+	t.Helper()
+
+	if err := u.Delete(time.Now().UTC()); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Update(context.Background(), u); err != nil {
+		t.Fatalf("Update(delete): %v", err)
+	}
+}
+
+// tick returns a timestamp strictly between the users created around it.
+func tick() time.Time {
+	time.Sleep(5 * time.Millisecond)
+	now := time.Now().UTC()
+	time.Sleep(5 * time.Millisecond)
+	return now
+}
+
+// sortedIDs returns the IDs of users in ascending order.
+func sortedIDs(users ...*domain.User) []domain.UserID {
+	ids := make([]domain.UserID, len(users))
+	for i, u := range users {
+		ids[i] = u.ID()
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func assertIDs(t *testing.T, users []*domain.User, want ...domain.UserID) {
+	t.Helper()
+
+	if len(users) != len(want) {
+		t.Fatalf("got %d users, want %d", len(users), len(want))
+	}
+	for i, u := range users {
+		if u.ID() != want[i] {
+			t.Fatalf("position %d: got %s, want %s", i, u.ID(), want[i])
+		}
+	}
+}
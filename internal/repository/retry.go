@@ -0,0 +1,160 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"syscall"
+	"time"
+
+	"go-prod-app/internal/metrics"
+
+	"github.com/lib/pq"
+)
+
+// ErrTransient wraps database errors that are expected to go away on
+// their own (failover, serialization failure, deadlock) and that
+// survived any retries. Callers may retry later.
+var ErrTransient = errors.New("transient database error")
+
+//
+// =========================
+// Classification
+// =========================
+//
+
+// Transient error classes, used as the retry metric label.
+const (
+	ErrorClassSerialization = "serialization"
+	ErrorClassDeadlock      = "deadlock"
+	ErrorClassShutdown      = "shutdown"
+	ErrorClassConnection    = "connection"
+)
+
+// ClassifyError returns the transient class of err, or "" for a
+// permanent error. Context errors are permanent: the caller gave up.
+//
+// Network errors count only on an established connection, or when
+// the server refused one while it restarts: a dial that fails to
+// resolve or reach the host is a misconfiguration, and a bare io.EOF
+// is as likely the end of some other stream.
+func ClassifyError(err error) string {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return ""
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch {
+		case pqErr.Code == "40001": // serialization_failure
+			return ErrorClassSerialization
+		case pqErr.Code == "40P01": // deadlock_detected
+			return ErrorClassDeadlock
+		case pqErr.Code == "57P01", // admin_shutdown
+			pqErr.Code == "57P02", // crash_shutdown
+			pqErr.Code == "57P03": // cannot_connect_now
+			return ErrorClassShutdown
+		case pqErr.Code.Class() == "08": // connection_exception
+			return ErrorClassConnection
+		}
+		return ""
+	}
+
+	var opErr *net.OpError
+	switch {
+	case errors.Is(err, driver.ErrBadConn),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.EPIPE),
+		errors.As(err, &opErr) && opErr.Op != "dial":
+		return ErrorClassConnection
+	}
+
+	return ""
+}
+
+//
+// =========================
+// Retry
+// =========================
+//
+
+type RetryPolicy struct {
+	// MaxAttempts includes the first try; 1 disables retries.
+	MaxAttempts int
+	// BaseBackoff and MaxBackoff bound the exponential retry delay.
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		BaseBackoff: 50 * time.Millisecond,
+		MaxBackoff:  time.Second,
+	}
+}
+
+// withRetry runs fn until it succeeds, fails permanently, runs out of
+// attempts, or the next delay would outlast ctx. fn must be idempotent.
+// A transient error that is given up on is wrapped in ErrTransient.
+func withRetry[T any](
+	ctx context.Context,
+	policy RetryPolicy,
+	fn func() (T, error),
+) (T, error) {
+
+	for attempt := 1; ; attempt++ {
+		v, err := fn()
+
+		class := ClassifyError(err)
+		if class == "" {
+			return v, err
+		}
+
+		delay := policy.backoff(attempt)
+		deadline, hasDeadline := ctx.Deadline()
+
+		if attempt >= policy.MaxAttempts ||
+			(hasDeadline && time.Until(deadline) < delay) {
+			return v, fmt.Errorf("%w: %w", ErrTransient, err)
+		}
+
+		metrics.DBRetries.WithLabelValues(class).Inc()
+
+		select {
+		case <-ctx.Done():
+			return v, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// backoff returns a jittered exponential delay for the given attempt.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseBackoff
+	for i := 1; i < attempt && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+
+	// Equal jitter in [d/2, d] so clients retrying together spread out.
+	half := d / 2
+	return half + rand.N(half+1)
+}
+
+// transient wraps err in ErrTransient when it is transient, for
+// operations that are not retried.
+func transient(err error) error {
+	if errors.Is(err, ErrTransient) || ClassifyError(err) == "" {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrTransient, err)
+}
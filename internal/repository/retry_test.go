@@ -0,0 +1,67 @@
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"go-prod-app/internal/repository"
+
+	"github.com/lib/pq"
+)
+
+func TestClassifyError(t *testing.T) {
+	dial := func(err error) error {
+		return &net.OpError{Op: "dial", Net: "tcp", Err: err}
+	}
+	read := func(err error) error {
+		return &net.OpError{Op: "read", Net: "tcp", Err: err}
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"nil", nil, ""},
+		{"no rows", sql.ErrNoRows, ""},
+		{"canceled", fmt.Errorf("query: %w", context.Canceled), ""},
+		{"deadline", context.DeadlineExceeded, ""},
+		{"canceled while reading", fmt.Errorf("%w: %w", context.Canceled, read(syscall.ECONNRESET)), ""},
+
+		{"serialization failure", &pq.Error{Code: "40001"}, repository.ErrorClassSerialization},
+		{"deadlock", fmt.Errorf("update: %w", &pq.Error{Code: "40P01"}), repository.ErrorClassDeadlock},
+		{"admin shutdown", &pq.Error{Code: "57P01"}, repository.ErrorClassShutdown},
+		{"cannot connect now", &pq.Error{Code: "57P03"}, repository.ErrorClassShutdown},
+		{"connection failure", &pq.Error{Code: "08006"}, repository.ErrorClassConnection},
+		{"unique violation", &pq.Error{Code: "23505"}, ""},
+		{"query canceled", &pq.Error{Code: "57014"}, ""},
+
+		{"bad connection", driver.ErrBadConn, repository.ErrorClassConnection},
+		{"unexpected eof", io.ErrUnexpectedEOF, repository.ErrorClassConnection},
+		{"bare eof", io.EOF, ""},
+		{"wrapped eof", fmt.Errorf("decode: %w", io.EOF), ""},
+		{"eof on the connection", read(io.EOF), repository.ErrorClassConnection},
+		{"reset", read(&os.SyscallError{Syscall: "read", Err: syscall.ECONNRESET}), repository.ErrorClassConnection},
+		{"broken pipe", &net.OpError{Op: "write", Net: "tcp", Err: syscall.EPIPE}, repository.ErrorClassConnection},
+
+		{"dial refused", dial(&os.SyscallError{Syscall: "connect", Err: syscall.ECONNREFUSED}), repository.ErrorClassConnection},
+		{"dial unknown host", dial(&net.DNSError{Err: "no such host", Name: "db.invalid", IsNotFound: true}), ""},
+		{"dial unreachable", dial(&os.SyscallError{Syscall: "connect", Err: syscall.EHOSTUNREACH}), ""},
+		{"dial bad address", dial(&net.AddrError{Err: "missing port in address", Addr: "db"}), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := repository.ClassifyError(tt.err); got != tt.want {
+				t.Errorf("ClassifyError(%v) = %q, want %q", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"go-prod-app/internal/domain"
+)
+
+// RetryingUserRepository retries the reads of a UserRepository on
+// transient database errors (see ClassifyError).
+//
+// Writes are not retried: a write whose commit was lost with the
+// connection may have been applied, and repeating it would fail or, for
+// UpsertByEmail, misreport the outcome. Their transient errors are still
+// wrapped in ErrTransient. Calls inside a transaction are never retried:
+// the transaction is already aborted.
+type RetryingUserRepository struct {
+	next   UserRepository
+	policy RetryPolicy
+}
+
+func NewRetryingUserRepository(
+	next UserRepository,
+	policy RetryPolicy,
+) *RetryingUserRepository {
+	return &RetryingUserRepository{next: next, policy: policy}
+}
+
+func (r *RetryingUserRepository) Create(
+	ctx context.Context,
+	user *domain.User,
+) error {
+	return transient(r.next.Create(ctx, user))
+}
+
+func (r *RetryingUserRepository) Update(
+	ctx context.Context,
+	user *domain.User,
+) error {
+	return transient(r.next.Update(ctx, user))
+}
+
+func (r *RetryingUserRepository) UpsertByEmail(
+	ctx context.Context,
+	user *domain.User,
+) (*domain.User, UpsertOutcome, error) {
+	stored, outcome, err := r.next.UpsertByEmail(ctx, user)
+	return stored, outcome, transient(err)
+}
+
+func (r *RetryingUserRepository) GetByID(
+	ctx context.Context,
+	id domain.UserID,
+) (*domain.User, error) {
+	return retryRead(ctx, r.policy, func() (*domain.User, error) {
+		return r.next.GetByID(ctx, id)
+	})
+}
+
+func (r *RetryingUserRepository) GetByEmail(
+	ctx context.Context,
+	email string,
+) (*domain.User, error) {
+	return retryRead(ctx, r.policy, func() (*domain.User, error) {
+		return r.next.GetByEmail(ctx, email)
+	})
+}
+
+func (r *RetryingUserRepository) List(
+	ctx context.Context,
+	filter UserFilter,
+	cursor *Cursor,
+	limit int,
+) (*UserPage, error) {
+	return retryRead(ctx, r.policy, func() (*UserPage, error) {
+		return r.next.List(ctx, filter, cursor, limit)
+	})
+}
+
+func (r *RetryingUserRepository) Count(
+	ctx context.Context,
+	filter UserFilter,
+) (int64, error) {
+	return retryRead(ctx, r.policy, func() (int64, error) {
+		return r.next.Count(ctx, filter)
+	})
+}
+
+// retryRead is withRetry outside transactions.
+func retryRead[T any](
+	ctx context.Context,
+	policy RetryPolicy,
+	fn func() (T, error),
+) (T, error) {
+
+	if inTx(ctx) {
+		v, err := fn()
+		return v, transient(err)
+	}
+
+	return withRetry(ctx, policy, fn)
+}
+
+// RetryingUserHistory retries the reads of a UserHistoryRepository on
+// transient database errors, as RetryingUserRepository does.
+type RetryingUserHistory struct {
+	next   UserHistoryRepository
+	policy RetryPolicy
+}
+
+func NewRetryingUserHistory(
+	next UserHistoryRepository,
+	policy RetryPolicy,
+) *RetryingUserHistory {
+	return &RetryingUserHistory{next: next, policy: policy}
+}
+
+func (r *RetryingUserHistory) ListVersions(
+	ctx context.Context,
+	id domain.UserID,
+	beforeVersion int,
+	limit int,
+) ([]*UserVersion, error) {
+	return retryRead(ctx, r.policy, func() ([]*UserVersion, error) {
+		return r.next.ListVersions(ctx, id, beforeVersion, limit)
+	})
+}
+
+func (r *RetryingUserHistory) GetAsOf(
+	ctx context.Context,
+	id domain.UserID,
+	t time.Time,
+) (*domain.User, error) {
+	return retryRead(ctx, r.policy, func() (*domain.User, error) {
+		return r.next.GetAsOf(ctx, id, t)
+	})
+}
+
+// RetryingUserSearcher retries Suggest on transient database errors.
+type RetryingUserSearcher struct {
+	next   UserSearcher
+	policy RetryPolicy
+}
+
+func NewRetryingUserSearcher(
+	next UserSearcher,
+	policy RetryPolicy,
+) *RetryingUserSearcher {
+	return &RetryingUserSearcher{next: next, policy: policy}
+}
+
+func (r *RetryingUserSearcher) Suggest(
+	ctx context.Context,
+	q string,
+	limit int,
+) ([]*domain.User, error) {
+	return retryRead(ctx, r.policy, func() ([]*domain.User, error) {
+		return r.next.Suggest(ctx, q, limit)
+	})
+}
+
+// RetryingUserCountEstimator retries EstimateCount on transient
+// database errors.
+type RetryingUserCountEstimator struct {
+	next   UserCountEstimator
+	policy RetryPolicy
+}
+
+func NewRetryingUserCountEstimator(
+	next UserCountEstimator,
+	policy RetryPolicy,
+) *RetryingUserCountEstimator {
+	return &RetryingUserCountEstimator{next: next, policy: policy}
+}
+
+func (r *RetryingUserCountEstimator) EstimateCount(
+	ctx context.Context,
+	filter UserFilter,
+) (int64, error) {
+	return retryRead(ctx, r.policy, func() (int64, error) {
+		return r.next.EstimateCount(ctx, filter)
+	})
+}
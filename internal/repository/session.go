@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ErrTimeout is returned when a database call runs out of the time
+// budget carried by its context, whether the statement was cancelled
+// by Postgres (statement_timeout) or by the client.
+var ErrTimeout = errors.New("database timeout")
+
+//
+// =========================
+// Postgres Session Settings
+// =========================
+// Row-level security reads the tenant from app.tenant_id, and Postgres
+// keeps running a statement after the client gives up on it unless
+// statement_timeout stops it at the same deadline
+//
+
+// sessionSettings returns the statement applying ctx's tenant and
+// deadline to the rest of a transaction. The values are inlined rather
+// than bound, so it goes out in the simple protocol: one round trip,
+// which BEGIN can share.
+func sessionSettings(ctx context.Context) string {
+	var settings []string
+
+	set := func(name, value string) {
+		settings = append(settings,
+			fmt.Sprintf("set_config('%s', %s, true)", name, pq.QuoteLiteral(value)))
+	}
+
+	if allTenants(ctx) {
+		set("app.all_tenants", "on")
+	} else {
+		set("app.tenant_id", TenantFromContext(ctx))
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		// 0 would disable the timeout
+		ms := max(time.Until(deadline).Milliseconds(), 1)
+		set("statement_timeout", strconv.FormatInt(ms, 10))
+	}
+
+	if len(settings) == 0 {
+		return ""
+	}
+	return "SELECT " + strings.Join(settings, ", ")
+}
+
+// configureSession applies ctx's tenant and deadline to the remaining
+// statements of tx.
+func configureSession(ctx context.Context, tx *sql.Tx) error {
+	settings := sessionSettings(ctx)
+	if settings == "" {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, settings); err != nil {
+		return fmt.Errorf("configure session: %w", timeoutError(ctx, err))
+	}
+	return nil
+}
+
+// withSession runs the Postgres statements of fn on q. Transactions
+// from PostgresTxManager are configured already, and so is a pool with
+// nothing to set: fn runs on them as is. Otherwise fn runs on one
+// connection of the pool, in a transaction whose BEGIN carries the
+// settings, so they cost no round trip of their own. Timeouts come
+// back as ErrTimeout.
+func withSession[T any](
+	ctx context.Context,
+	q dbtx,
+	fn func(q dbtx) (T, error),
+) (T, error) {
+
+	db, isPool := q.(*sql.DB)
+	settings := sessionSettings(ctx)
+
+	if !isPool || settings == "" {
+		v, err := fn(q)
+		return v, timeoutError(ctx, err)
+	}
+
+	var zero T
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return zero, timeoutError(ctx, err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "BEGIN; "+settings); err != nil {
+		abortSession(conn)
+		return zero, fmt.Errorf("configure session: %w", timeoutError(ctx, err))
+	}
+
+	v, err := fn(conn)
+	if err != nil {
+		abortSession(conn)
+		return zero, timeoutError(ctx, err)
+	}
+
+	if _, err := conn.ExecContext(ctx, "COMMIT"); err != nil {
+		abortSession(conn)
+		return zero, timeoutError(ctx, err)
+	}
+
+	return v, nil
+}
+
+// abortSession rolls back the transaction withSession opened on conn,
+// also when ctx is done, so conn goes back to the pool outside of it.
+// A connection that cannot be rolled back is discarded instead.
+func abortSession(conn *sql.Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := conn.ExecContext(ctx, "ROLLBACK"); err != nil {
+		_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+	}
+}
+
+// timeoutError wraps err in ErrTimeout when it was caused by ctx's
+// deadline or a statement timeout. A caller that went away (context
+// cancelled) is not a timeout.
+func timeoutError(ctx context.Context, err error) error {
+	if err == nil || errors.Is(err, ErrTimeout) || errors.Is(ctx.Err(), context.Canceled) {
+		return err
+	}
+
+	var pqErr *pq.Error
+	if errors.Is(err, context.DeadlineExceeded) ||
+		(errors.As(err, &pqErr) && pqErr.Code == "57014") { // query_canceled
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+
+	return err
+}
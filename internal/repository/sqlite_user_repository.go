@@ -0,0 +1,595 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-prod-app/internal/domain"
+
+	"github.com/google/uuid"
+)
+
+// SQLiteUserRepository implements UserRepository on SQLite, for local
+// development and edge deployments. It needs a database/sql driver
+// registered as "sqlite" and the schema from database.SQLiteSchema.
+//
+// It has no version history, search or purge support; Query filters
+// match substrings and rank prefix matches first. It is single-tenant:
+// calls for any tenant but DefaultTenant fail with ErrTenantNotSupported.
+type SQLiteUserRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteUserRepository(db *sql.DB) *SQLiteUserRepository {
+	return &SQLiteUserRepository{db: db}
+}
+
+// sqliteTimeLayout is fixed-width so stored timestamps sort as text.
+const sqliteTimeLayout = "2006-01-02T15:04:05.000000000Z"
+
+//
+// =========================
+// Create
+// =========================
+// Repository owns ID + persistence metadata
+//
+
+func (r *SQLiteUserRepository) Create(
+	ctx context.Context,
+	user *domain.User,
+) error {
+
+	if err := singleTenant(ctx); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+
+	// UUID v7 → sortable by time
+	id := uuid.Must(uuid.NewV7())
+
+	query := `
+		INSERT INTO users (
+			id, name, email, version,
+			created_at, updated_at, deleted_at
+		)
+		VALUES (?, ?, ?, ?, ?, ?, NULL)
+	`
+
+	_, err := conn(ctx, r.db).ExecContext(
+		ctx,
+		query,
+		id.String(),
+		user.Name(),
+		user.Email(),
+		1, // initial version
+		sqliteTime(now),
+		sqliteTime(now),
+	)
+
+	if err != nil {
+		if isSQLiteUniqueViolation(err) {
+			return ErrDuplicateEmail
+		}
+		return err
+	}
+
+	// Set ID only AFTER successful insert
+	return user.SetID(domain.UserID(id.String()))
+}
+
+//
+// =========================
+// Update (Optimistic Lock)
+// Repository owns version + updated_at
+//
+
+func (r *SQLiteUserRepository) Update(
+	ctx context.Context,
+	user *domain.User,
+) error {
+
+	if err := singleTenant(ctx); err != nil {
+		return err
+	}
+
+	var deletedAt interface{}
+	if user.DeletedAt() != nil {
+		deletedAt = sqliteTime(*user.DeletedAt())
+	}
+
+	query := `
+		UPDATE users
+		SET name = ?,
+			email = ?,
+			version = ?,
+			updated_at = ?,
+			deleted_at = ?
+		WHERE id = ?
+		  AND version = ?
+	`
+
+	res, err := conn(ctx, r.db).ExecContext(
+		ctx,
+		query,
+		user.Name(),
+		user.Email(),
+		user.Version()+1,
+		sqliteTime(time.Now().UTC()),
+		deletedAt,
+		user.ID(),
+		user.Version(),
+	)
+
+	if err != nil {
+		if isSQLiteUniqueViolation(err) {
+			return ErrDuplicateEmail
+		}
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrVersionConflict
+	}
+
+	user.IncreaseVersion()
+	return nil
+}
+
+//
+// =========================
+// UpsertByEmail
+// Single statement: ON CONFLICT on the active-email index
+//
+
+func (r *SQLiteUserRepository) UpsertByEmail(
+	ctx context.Context,
+	user *domain.User,
+) (*domain.User, UpsertOutcome, error) {
+
+	if err := singleTenant(ctx); err != nil {
+		return nil, "", err
+	}
+
+	now := sqliteTime(time.Now().UTC())
+
+	// UUID v7 → sortable by time; only used if the row is inserted
+	id := uuid.Must(uuid.NewV7()).String()
+
+	// The DO UPDATE WHERE skips unchanged rows, so nothing is returned
+	// for them. The returned id tells an insert from an update.
+	query := `
+		INSERT INTO users (
+			id, name, email, version,
+			created_at, updated_at, deleted_at
+		)
+		VALUES (?, ?, ?, 1, ?, ?, NULL)
+		ON CONFLICT (lower(email)) WHERE deleted_at IS NULL
+		DO UPDATE
+		SET name = excluded.name,
+			version = users.version + 1,
+			updated_at = excluded.updated_at
+		WHERE users.name IS NOT excluded.name
+		RETURNING id, name, email, version,
+		          created_at, updated_at, deleted_at
+	`
+
+	row := conn(ctx, r.db).QueryRowContext(
+		ctx,
+		query,
+		id,
+		user.Name(),
+		user.Email(),
+		now,
+		now,
+	)
+
+	stored, err := scanSQLiteUser(row, nil)
+	if errors.Is(err, sql.ErrNoRows) {
+		u, err := r.GetByEmail(ctx, user.Email())
+		if errors.Is(err, ErrUserNotFound) {
+			// deleted between the upsert and this read
+			return nil, "", ErrVersionConflict
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		return u, UpsertUnchanged, nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	if stored.ID() == domain.UserID(id) {
+		return stored, UpsertCreated, nil
+	}
+	return stored, UpsertUpdated, nil
+}
+
+//
+// =========================
+// GetByID
+// Returns user even if soft-deleted
+//
+
+func (r *SQLiteUserRepository) GetByID(
+	ctx context.Context,
+	id domain.UserID,
+) (*domain.User, error) {
+
+	if err := singleTenant(ctx); err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT id, name, email, version,
+		       created_at, updated_at, deleted_at
+		FROM users
+		WHERE id = ?
+	`
+
+	u, err := scanSQLiteUser(conn(ctx, r.db).QueryRowContext(ctx, query, id), nil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+//
+// =========================
+// GetByEmail
+// Returns only active users
+//
+
+func (r *SQLiteUserRepository) GetByEmail(
+	ctx context.Context,
+	email string,
+) (*domain.User, error) {
+
+	if err := singleTenant(ctx); err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT id, name, email, version,
+		       created_at, updated_at, deleted_at
+		FROM users
+		WHERE lower(email) = ?
+		  AND deleted_at IS NULL
+	`
+
+	row := conn(ctx, r.db).QueryRowContext(ctx, query, strings.ToLower(email))
+
+	u, err := scanSQLiteUser(row, nil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+//
+// =========================
+// List (Keyset Pagination)
+// Ordered by filter.Sort, then id (UUID v7 → time-ordered)
+//
+
+func (r *SQLiteUserRepository) List(
+	ctx context.Context,
+	filter UserFilter,
+	cursor *Cursor,
+	limit int,
+) (*UserPage, error) {
+
+	if err := singleTenant(ctx); err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		return nil, fmt.Errorf("limit must be > 0")
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
+	}
+
+	sort, err := resolveSort(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateCursor(sort, cursor); err != nil {
+		return nil, err
+	}
+
+	// Placeholders are positional: args follow the query text.
+	var args []interface{}
+
+	rank := "NULL"
+	if filter.Query != nil {
+		prefix := escapeLike(*filter.Query) + "%"
+		args = append(args, prefix, domain.NormalizeEmail(*filter.Query))
+		rank = `CASE WHEN name LIKE ? ESCAPE '\' OR lower(email) = ?
+		             THEN 1.0 ELSE 0.5 END`
+	}
+
+	conditions, condArgs := sqliteFilterConditions(filter)
+	args = append(args, condArgs...)
+
+	col, _ := sortColumn(sort.Field)
+
+	// A backward page runs the reverse query; newUserPage flips the
+	// rows back into list order.
+	desc := sort.Desc != cursor.backward()
+
+	dir, cmpOp := "ASC", ">"
+	if desc {
+		dir, cmpOp = "DESC", "<"
+	}
+
+	var keyset []string
+
+	if cursor.positioned() {
+		if col == "id" {
+			keyset = append(keyset, fmt.Sprintf("id %s ?", cmpOp))
+			args = append(args, cursor.ID)
+		} else {
+			after, err := decodeSortValue(sort.Field, cursor.Key)
+			if err != nil {
+				return nil, err
+			}
+			if t, ok := after.(time.Time); ok {
+				after = sqliteTime(t)
+			}
+			keyset = append(keyset, fmt.Sprintf("(%s, id) %s (?, ?)", col, cmpOp))
+			args = append(args, after, cursor.ID)
+		}
+	}
+
+	// one extra row tells whether more follow
+	args = append(args, limit+1)
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	outerWhere := ""
+	if len(keyset) > 0 {
+		outerWhere = "WHERE " + strings.Join(keyset, " AND ")
+	}
+
+	orderBy := fmt.Sprintf("id %s", dir)
+	if col != "id" {
+		orderBy = fmt.Sprintf("%s %s, id %s", col, dir, dir)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, name, email, version,
+		       created_at, updated_at, deleted_at, rank
+		FROM (
+			SELECT id, name, email, version,
+			       created_at, updated_at, deleted_at,
+			       %s AS rank
+			FROM users
+			%s
+		) matched
+		%s
+		ORDER BY %s
+		LIMIT ?
+	`, rank, where, outerWhere, orderBy)
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var (
+		users []*domain.User
+		keys  []interface{}
+	)
+
+	for rows.Next() {
+		var rowRank sql.NullFloat64
+
+		u, err := scanSQLiteUser(rows, &rowRank)
+		if err != nil {
+			return nil, err
+		}
+
+		users = append(users, u)
+		keys = append(keys, sortValue(sort.Field, u, rowRank.Float64))
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return newUserPage(sort, cursor, limit, users, keys), nil
+}
+
+//
+// =========================
+// Count
+// =========================
+//
+
+func (r *SQLiteUserRepository) Count(
+	ctx context.Context,
+	filter UserFilter,
+) (int64, error) {
+
+	if err := singleTenant(ctx); err != nil {
+		return 0, err
+	}
+
+	conditions, args := sqliteFilterConditions(filter)
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	query := fmt.Sprintf(`SELECT COUNT(*) FROM users %s`, where)
+
+	var count int64
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, args...).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (r *SQLiteUserRepository) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
+//
+// =========================
+// Helpers
+// =========================
+//
+
+// singleTenant rejects ctx unless it is scoped to DefaultTenant.
+func singleTenant(ctx context.Context) error {
+	if allTenants(ctx) || TenantFromContext(ctx) == DefaultTenant {
+		return nil
+	}
+	return ErrTenantNotSupported
+}
+
+// sqliteFilterConditions is filterConditions with ? placeholders and
+// substring matching for Query.
+func sqliteFilterConditions(filter UserFilter) ([]string, []interface{}) {
+	var (
+		args       []interface{}
+		conditions []string
+	)
+
+	switch {
+	case filter.OnlyDeleted:
+		conditions = append(conditions, "deleted_at IS NOT NULL")
+	case !filter.IncludeDeleted:
+		conditions = append(conditions, "deleted_at IS NULL")
+	}
+
+	if filter.Email != nil {
+		conditions = append(conditions, "lower(email) = ?")
+		args = append(args, strings.ToLower(*filter.Email))
+	}
+
+	if filter.CreatedAfter != nil {
+		conditions = append(conditions, "created_at > ?")
+		args = append(args, sqliteTime(*filter.CreatedAfter))
+	}
+
+	if filter.CreatedBefore != nil {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, sqliteTime(*filter.CreatedBefore))
+	}
+
+	// LIKE is case-insensitive for ASCII in SQLite
+	if filter.Query != nil {
+		like := "%" + escapeLike(*filter.Query) + "%"
+		conditions = append(conditions,
+			`(name LIKE ? ESCAPE '\' OR lower(email) = ?)`)
+		args = append(args, like, domain.NormalizeEmail(*filter.Query))
+	}
+
+	return conditions, args
+}
+
+// scanSQLiteUser scans a user row, followed by its rank when rank is
+// not nil.
+func scanSQLiteUser(s scanner, rank *sql.NullFloat64) (*domain.User, error) {
+	var (
+		id        string
+		name      string
+		email     string
+		version   int
+		createdAt string
+		updatedAt string
+		deletedAt sql.NullString
+	)
+
+	dest := []interface{}{
+		&id,
+		&name,
+		&email,
+		&version,
+		&createdAt,
+		&updatedAt,
+		&deletedAt,
+	}
+	if rank != nil {
+		dest = append(dest, rank)
+	}
+
+	if err := s.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	created, err := parseSQLiteTime(createdAt)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := parseSQLiteTime(updatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	var deleted *time.Time
+	if deletedAt.Valid {
+		t, err := parseSQLiteTime(deletedAt.String)
+		if err != nil {
+			return nil, err
+		}
+		deleted = &t
+	}
+
+	return domain.RehydrateUser(
+		domain.UserID(id),
+		name,
+		email,
+		version,
+		created,
+		updated,
+		deleted,
+	), nil
+}
+
+func sqliteTime(t time.Time) string {
+	return t.UTC().Format(sqliteTimeLayout)
+}
+
+func parseSQLiteTime(s string) (time.Time, error) {
+	t, err := time.Parse(sqliteTimeLayout, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parse stored time %q: %w", s, err)
+	}
+	return t, nil
+}
+
+// isSQLiteUniqueViolation matches SQLITE_CONSTRAINT_UNIQUE by message,
+// so the repository does not depend on a particular driver.
+func isSQLiteUniqueViolation(err error) bool {
+	return strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
@@ -0,0 +1,31 @@
+package repository_test
+
+import (
+	"database/sql"
+	"testing"
+
+	"go-prod-app/database"
+	"go-prod-app/internal/repository"
+	"go-prod-app/internal/repository/repotest"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestSQLiteUserRepository(t *testing.T) {
+	repotest.TestUserRepository(t, func(t *testing.T) repotest.Repository {
+		// Each test gets its own in-memory database, which lives as long
+		// as its only connection.
+		db, err := sql.Open("sqlite", ":memory:")
+		if err != nil {
+			t.Fatalf("open sqlite: %v", err)
+		}
+		db.SetMaxOpenConns(1)
+		t.Cleanup(func() { db.Close() })
+
+		if _, err := db.Exec(database.SQLiteSchema()); err != nil {
+			t.Fatalf("apply sqlite schema: %v", err)
+		}
+
+		return repository.NewSQLiteUserRepository(db)
+	})
+}
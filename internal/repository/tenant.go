@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrTenantNotSupported is returned by single-tenant backends for any
+// tenant but DefaultTenant.
+var ErrTenantNotSupported = errors.New("tenants are not supported by storage backend")
+
+// ErrRowSecurityBypassed is returned by CheckRowSecurity when the
+// database role is exempt from row-level security.
+var ErrRowSecurityBypassed = errors.New("database role bypasses row-level security")
+
+// DefaultTenant owns the users of single-tenant deployments and every
+// user created before tenants existed.
+const DefaultTenant = "default"
+
+type tenantKey struct{}
+type allTenantsKey struct{}
+
+// WithTenant scopes every repository call made through ctx to tenant.
+// Without it calls are scoped to DefaultTenant.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant set by WithTenant, or
+// DefaultTenant.
+func TenantFromContext(ctx context.Context) string {
+	if tenant, _ := ctx.Value(tenantKey{}).(string); tenant != "" {
+		return tenant
+	}
+	return DefaultTenant
+}
+
+// WithAllTenants lifts tenant scoping for maintenance jobs, such as the
+// retention purge, that work across tenants. Never use it for a
+// request.
+func WithAllTenants(ctx context.Context) context.Context {
+	return context.WithValue(ctx, allTenantsKey{}, true)
+}
+
+func allTenants(ctx context.Context) bool {
+	v, _ := ctx.Value(allTenantsKey{}).(bool)
+	return v
+}
+
+// inTenant reports whether a row of tenant is visible through ctx.
+func inTenant(ctx context.Context, tenant string) bool {
+	return allTenants(ctx) || tenant == TenantFromContext(ctx)
+}
+
+// tenantCondition limits a Postgres statement to the tenant bound to
+// parameter n (tenantParam). It repeats row-level security in the
+// statement, so isolation does not rest on the role the app connects
+// as alone.
+func tenantCondition(n int) string {
+	return fmt.Sprintf("($%[1]d::text IS NULL OR tenant_id = $%[1]d)", n)
+}
+
+// tenantParam is the argument for tenantCondition: ctx's tenant, or
+// NULL when ctx is WithAllTenants.
+func tenantParam(ctx context.Context) sql.NullString {
+	if allTenants(ctx) {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: TenantFromContext(ctx), Valid: true}
+}
+
+// CheckRowSecurity fails with ErrRowSecurityBypassed when db connects
+// as a superuser or a role with BYPASSRLS. Row-level security does not
+// apply to either, even with FORCE ROW LEVEL SECURITY.
+func CheckRowSecurity(ctx context.Context, db *sql.DB) error {
+	var bypass bool
+	err := db.QueryRowContext(ctx, `
+		SELECT rolsuper OR rolbypassrls
+		FROM pg_roles
+		WHERE rolname = current_user
+	`).Scan(&bypass)
+	if err != nil {
+		return fmt.Errorf("check database role: %w", err)
+	}
+
+	if bypass {
+		return fmt.Errorf("%w: connect as a role with NOSUPERUSER NOBYPASSRLS", ErrRowSecurityBypassed)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+//
+// =========
+// Unit of Work
+// =========
+//
+
+// TxOptions configures a transaction started by TxManager.
+type TxOptions struct {
+	Isolation sql.IsolationLevel
+	ReadOnly  bool
+}
+
+type TxOption func(*TxOptions)
+
+// WithIsolation sets the isolation level (default: the database default,
+// READ COMMITTED for Postgres).
+func WithIsolation(level sql.IsolationLevel) TxOption {
+	return func(o *TxOptions) { o.Isolation = level }
+}
+
+// ReadOnly marks the transaction read-only. Writes inside it fail.
+func ReadOnly() TxOption {
+	return func(o *TxOptions) { o.ReadOnly = true }
+}
+
+// TxManager runs a function inside a transaction.
+//
+// Repository methods called with the ctx passed to fn join the
+// transaction automatically; everything commits if fn returns nil and
+// rolls back otherwise. Nested WithinTx calls join the outer
+// transaction and their options are ignored.
+type TxManager interface {
+	WithinTx(
+		ctx context.Context,
+		fn func(ctx context.Context) error,
+		opts ...TxOption,
+	) error
+}
+
+func buildTxOptions(opts []TxOption) TxOptions {
+	var o TxOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+//
+// =========
+// database/sql
+// =========
+//
+
+type txKey struct{}
+
+// dbtx is the subset of *sql.DB and *sql.Tx used by repositories.
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+// SQLTxManager implements TxManager on a *sql.DB.
+// Repositories sharing the same *sql.DB pick the transaction up from ctx.
+//
+// Transient failures, of begin and commit as much as of fn, come back
+// wrapped in ErrTransient. Transactions are never retried: fn may have
+// changed state outside the database (an ID set on a domain.User), and
+// a commit lost with its connection may have been applied. Only reads
+// outside a transaction are retried (RetryingUserRepository).
+type SQLTxManager struct {
+	db *sql.DB
+	// postgres configures each transaction for ctx (configureSession).
+	postgres bool
+}
+
+func NewSQLTxManager(db *sql.DB) *SQLTxManager {
+	return &SQLTxManager{db: db}
+}
+
+// NewPostgresTxManager is NewSQLTxManager for Postgres: transactions
+// are scoped to the tenant of their ctx, and their statements are
+// cancelled by the server at its deadline.
+func NewPostgresTxManager(db *sql.DB) *SQLTxManager {
+	return &SQLTxManager{db: db, postgres: true}
+}
+
+func (m *SQLTxManager) WithinTx(
+	ctx context.Context,
+	fn func(ctx context.Context) error,
+	opts ...TxOption,
+) (err error) {
+
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+
+	o := buildTxOptions(opts)
+
+	tx, err := m.db.BeginTx(ctx, &sql.TxOptions{
+		Isolation: o.Isolation,
+		ReadOnly:  o.ReadOnly,
+	})
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", transient(timeoutError(ctx, err)))
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if m.postgres {
+		if err := configureSession(ctx, tx); err != nil {
+			_ = tx.Rollback()
+			return transient(err)
+		}
+	}
+
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		_ = tx.Rollback()
+		return transient(timeoutError(ctx, err))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit tx: %w", transient(timeoutError(ctx, err)))
+	}
+
+	return nil
+}
+
+// conn returns the transaction carried by ctx, or db when there is none.
+func conn(ctx context.Context, db *sql.DB) dbtx {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return db
+}
+
+// inTx reports whether ctx carries a transaction from any TxManager.
+func inTx(ctx context.Context) bool {
+	return ctx.Value(txKey{}) != nil || ctx.Value(memoryTxKey{}) != nil
+}
@@ -0,0 +1,12 @@
+package repository
+
+import "context"
+
+// UserCountEstimator estimates Count cheaply from table statistics
+// instead of scanning, for tables too large to count on every request.
+type UserCountEstimator interface {
+	// EstimateCount returns the approximate number of users matching
+	// filter. It may be off by any amount after bulk changes until the
+	// statistics are refreshed.
+	EstimateCount(ctx context.Context, filter UserFilter) (int64, error)
+}
@@ -0,0 +1,27 @@
+package repository
+
+import "context"
+
+// StaleEmails counts stored emails not yet under the active key, in
+// users and user_versions together.
+type StaleEmails struct {
+	// Plaintext emails were stored before encryption was introduced.
+	Plaintext int64
+	// OldKey emails are encrypted under a key that has been rotated out.
+	OldKey int64
+}
+
+func (s StaleEmails) Total() int64 {
+	return s.Plaintext + s.OldKey
+}
+
+// EmailReencrypter moves stored emails to the active encryption key.
+type EmailReencrypter interface {
+	// ReencryptEmails re-encrypts up to limit stale rows under the
+	// active key and returns how many it rewrote. Plaintext emails are
+	// encrypted and cleared.
+	ReencryptEmails(ctx context.Context, limit int) (int, error)
+
+	// CountStaleEmails returns what ReencryptEmails has left to do.
+	CountStaleEmails(ctx context.Context) (StaleEmails, error)
+}
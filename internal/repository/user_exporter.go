@@ -0,0 +1,24 @@
+package repository
+
+import (
+	"context"
+
+	"go-prod-app/internal/domain"
+)
+
+// UserExporter streams every matching user, for exports too large to
+// page through with List.
+type UserExporter interface {
+	// Export calls fn for each user matching filter whose ID is after
+	// afterID ("" starts at the beginning), in ID order, so an export
+	// that broke off can resume from the last ID it wrote. filter.Sort
+	// is ignored. It stops at the first error from fn and returns it.
+	// The users need not come from one snapshot: a user changed while
+	// the export runs is written as it was when read.
+	Export(
+		ctx context.Context,
+		filter UserFilter,
+		afterID domain.UserID,
+		fn func(*domain.User) error,
+	) error
+}
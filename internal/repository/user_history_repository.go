@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"go-prod-app/internal/domain"
+)
+
+// Fields recorded in UserVersion.ChangedFields.
+const (
+	FieldName      = "name"
+	FieldEmail     = "email"
+	FieldDeletedAt = "deleted_at"
+)
+
+// UserVersion is the state of a user right after one persisted change.
+type UserVersion struct {
+	User          *domain.User
+	ChangedBy     string
+	ChangedFields []string
+	ChangedAt     time.Time
+}
+
+// UserHistoryRepository reads the version history written by
+// UserRepository.Create and Update.
+type UserHistoryRepository interface {
+	// ListVersions returns versions of a user newest first.
+	//
+	// - only versions lower than beforeVersion are returned (0 = no bound)
+	// - limit must be > 0
+	ListVersions(
+		ctx context.Context,
+		id domain.UserID,
+		beforeVersion int,
+		limit int,
+	) ([]*UserVersion, error)
+
+	// GetAsOf returns the user as it was at t, including soft-deleted state.
+	// Must return ErrUserNotFound if the user did not exist at t.
+	GetAsOf(ctx context.Context, id domain.UserID, t time.Time) (*domain.User, error)
+}
@@ -0,0 +1,22 @@
+package repository
+
+import (
+	"context"
+
+	"go-prod-app/internal/domain"
+)
+
+// UserImporter creates users in bulk, for imports too large to send
+// through Create one by one.
+type UserImporter interface {
+	// Import creates every user whose email no active user of the
+	// tenant has and sets its ID. created[i] tells whether users[i] was
+	// created; the others are duplicates. Callers drop emails repeated
+	// within users first. Either all of them are created or none.
+	Import(ctx context.Context, users []*domain.User) (created []bool, err error)
+
+	// EmailsTaken reports, without writing or locking anything, which
+	// of users an active user of the tenant has the email of: the
+	// duplicates Import would skip right now.
+	EmailsTaken(ctx context.Context, users []*domain.User) (taken []bool, err error)
+}
@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"go-prod-app/internal/domain"
+)
+
+// UserPurger permanently removes soft-deleted users.
+// Their version history goes with them.
+type UserPurger interface {
+	// PurgeDeleted hard-deletes up to limit users soft-deleted before
+	// cutoff, oldest deletion first, and returns their IDs.
+	PurgeDeleted(ctx context.Context, cutoff time.Time, limit int) ([]domain.UserID, error)
+
+	// CountPurgeable returns how many users PurgeDeleted would remove
+	// for cutoff if run to completion.
+	CountPurgeable(ctx context.Context, cutoff time.Time) (int64, error)
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"errors"
+	"slices"
 	"time"
 
 	"go-prod-app/internal/domain"
@@ -12,6 +13,8 @@ var (
 	ErrUserNotFound    = errors.New("user not found")
 	ErrDuplicateEmail  = errors.New("duplicate email")
 	ErrVersionConflict = errors.New("version conflict")
+	ErrInvalidCursor   = errors.New("invalid cursor")
+	ErrInvalidSort     = errors.New("invalid sort")
 )
 
 //
@@ -23,22 +26,153 @@ var (
 // UserFilter defines query constraints for listing users.
 //
 // If IncludeDeleted is false, soft-deleted users MUST be excluded.
+// If OnlyDeleted is true, only soft-deleted users are returned and
+// IncludeDeleted is ignored.
 type UserFilter struct {
 	IncludeDeleted bool
+	OnlyDeleted    bool
 
 	Email         *string
 	CreatedAfter  *time.Time
 	CreatedBefore *time.Time
+
+	// Query fuzzy-matches the name (trigram word similarity or
+	// substring) and matches the email exactly, which is all an
+	// encrypted email allows.
+	Query *string
+
+	// Sort orders List; Count ignores it.
+	// The zero value sorts by relevance when Query is set, else by ID.
+	Sort UserSort
 }
 
 // =========
 // Cursor (Keyset Pagination)
 // =========
 //
-// List is ordered by (id ASC) for stable pagination.
-// Cursor represents the last seen record.
+// List is ordered by (sort key, id) for stable pagination, with id
+// following the sort direction as tiebreaker.
+// Cursor is a position in that order plus a direction: the page after
+// it or the page before it. It only works with the sort it was issued
+// for. A cursor without ID is a shortcut to the first or last page.
 type Cursor struct {
-	AfterID domain.UserID
+	// Sort is UserSort.String() of the listing that issued the cursor.
+	Sort      string          `json:",omitempty"`
+	Direction CursorDirection `json:",omitempty"`
+	// Key is the encoded sort key of the record at the position; unused
+	// when sorting by ID.
+	Key string `json:",omitempty"`
+	ID  domain.UserID
+}
+
+type CursorDirection string
+
+const (
+	// CursorAfter (the default) pages forward from the position.
+	CursorAfter CursorDirection = "after"
+	// CursorBefore pages backward from the position.
+	CursorBefore CursorDirection = "before"
+)
+
+// FirstPage returns a cursor for the first page of any listing.
+// It is equivalent to no cursor.
+func FirstPage() *Cursor {
+	return &Cursor{Direction: CursorAfter}
+}
+
+// LastPage returns a cursor for the last page of any listing.
+func LastPage() *Cursor {
+	return &Cursor{Direction: CursorBefore}
+}
+
+func (c *Cursor) backward() bool {
+	return c != nil && c.Direction == CursorBefore
+}
+
+// positioned reports whether c points at a record rather than an end.
+func (c *Cursor) positioned() bool {
+	return c != nil && c.ID != ""
+}
+
+// validateCursor rejects a malformed cursor or one issued for a
+// different sort order.
+func validateCursor(sort UserSort, cursor *Cursor) error {
+	if cursor == nil {
+		return nil
+	}
+	switch cursor.Direction {
+	case "", CursorAfter, CursorBefore:
+	default:
+		return ErrInvalidCursor
+	}
+	if cursor.positioned() && cursor.Sort != sort.String() {
+		return ErrInvalidCursor
+	}
+	return nil
+}
+
+// UserPage is one page of List results, in list order.
+type UserPage struct {
+	Users []*domain.User
+	// Next continues after the last user; nil when nothing follows.
+	Next *Cursor
+	// Prev continues before the first user; nil when nothing precedes.
+	Prev *Cursor
+	// HasMore reports whether more users exist in the direction paged.
+	HasMore bool
+}
+
+// newUserPage builds a page from up to limit+1 rows fetched in the
+// direction of cursor, with keys[i] the sort key of rows[i].
+func newUserPage(
+	sort UserSort,
+	cursor *Cursor,
+	limit int,
+	rows []*domain.User,
+	keys []interface{},
+) *UserPage {
+
+	hasMore := len(rows) > limit
+	if hasMore {
+		rows, keys = rows[:limit], keys[:limit]
+	}
+
+	// A backward page was fetched in reverse order.
+	if cursor.backward() {
+		slices.Reverse(rows)
+		slices.Reverse(keys)
+	}
+
+	page := &UserPage{Users: rows, HasMore: hasMore}
+	if len(rows) == 0 {
+		return page
+	}
+
+	moreBefore, moreAfter := cursor.positioned(), hasMore
+	if cursor.backward() {
+		moreBefore, moreAfter = hasMore, cursor.positioned()
+	}
+
+	if moreBefore {
+		page.Prev = &Cursor{
+			Sort:      sort.String(),
+			Direction: CursorBefore,
+			Key:       encodeSortValue(keys[0]),
+			ID:        rows[0].ID(),
+		}
+	}
+
+	if moreAfter {
+		last := len(rows) - 1
+		page.Next = &Cursor{
+			Sort:      sort.String(),
+			Direction: CursorAfter,
+			Key:       encodeSortValue(keys[last]),
+			ID:        rows[last].ID(),
+		}
+	}
+
+	return page
 }
 
 //
@@ -47,19 +181,32 @@ type Cursor struct {
 // =========
 //
 
+// UserRepository persists users.
+//
+// Methods called with a ctx from TxManager.WithinTx run inside that
+// transaction.
 type UserRepository interface {
 	// =====================
 	// Write Operations
 	// =====================
 
 	// Create persists a new user.
-	// Must return ErrDuplicateEmail if unique constraint violated.
+	// Must return ErrDuplicateEmail if another active user has the email.
+	// Soft-deleted users do not hold their email.
 	Create(ctx context.Context, user *domain.User) error
 
 	// Update persists changes using optimistic locking.
 	// Must return ErrVersionConflict if version mismatch.
+	// Must return ErrDuplicateEmail if the user is (or becomes, via
+	// Restore) active while another active user has the email.
 	Update(ctx context.Context, user *domain.User) error
 
+	// UpsertByEmail atomically creates user, or renames the active user
+	// holding user's email, and returns the stored user.
+	// The version is bumped only when the name changes; an unchanged
+	// user is reported as UpsertUnchanged and not written.
+	UpsertByEmail(ctx context.Context, user *domain.User) (*domain.User, UpsertOutcome, error)
+
 	// =====================
 	// Read Operations
 	// =====================
@@ -72,9 +219,13 @@ type UserRepository interface {
 	// Must return ErrUserNotFound if not found.
 	GetByEmail(ctx context.Context, email string) (*domain.User, error)
 
-	// List returns users ordered by ID ASC.
+	// List returns a page of users ordered by filter.Sort, then ID.
 	//
 	// - limit must be > 0
+	// - a CursorBefore cursor returns the page preceding it, still in
+	//   list order
+	// - must return ErrInvalidSort for relevance sort without filter.Query
+	// - must return ErrInvalidCursor for a cursor from a different sort
 	// - keyset pagination via cursor
 	// - if filter.IncludeDeleted is false, deleted users are excluded
 	List(
@@ -82,12 +233,27 @@ type UserRepository interface {
 		filter UserFilter,
 		cursor *Cursor,
 		limit int,
-	) ([]*domain.User, *Cursor, error)
+	) (*UserPage, error)
 
 	// Count returns total number of users matching filter.
 	Count(ctx context.Context, filter UserFilter) (int64, error)
 }
 
+// UpsertOutcome reports what UpsertByEmail did.
+type UpsertOutcome string
+
+const (
+	UpsertCreated   UpsertOutcome = "created"
+	UpsertUpdated   UpsertOutcome = "updated"
+	UpsertUnchanged UpsertOutcome = "unchanged"
+)
+
 type HealthChecker interface {
 	Ping(ctx context.Context) error
 }
+
+// PoolHealth reports a connection pool that keeps running out of
+// connections: the service still works, but slowly.
+type PoolHealth interface {
+	Saturated() bool
+}
@@ -0,0 +1,14 @@
+package repository
+
+import (
+	"context"
+
+	"go-prod-app/internal/domain"
+)
+
+// UserSearcher powers autocomplete.
+type UserSearcher interface {
+	// Suggest returns up to limit active users best matching q by name,
+	// or by exact email (as UserFilter.Query), most relevant first.
+	Suggest(ctx context.Context, q string, limit int) ([]*domain.User, error)
+}
@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"cmp"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-prod-app/internal/domain"
+)
+
+//
+// =========
+// Sorting
+// =========
+//
+
+type SortField string
+
+const (
+	SortByID        SortField = "id"
+	SortByCreatedAt SortField = "created_at"
+	SortByUpdatedAt SortField = "updated_at"
+	SortByName      SortField = "name"
+	// SortByRelevance ranks UserFilter.Query matches. Descending only
+	// makes sense; it is the default whenever Query is set.
+	SortByRelevance SortField = "relevance"
+)
+
+// UserSort is a sort field and direction. The zero value is "default".
+type UserSort struct {
+	Field SortField
+	Desc  bool
+}
+
+// ParseUserSort parses "field" (ascending) or "-field" (descending).
+// An empty string returns the zero UserSort.
+func ParseUserSort(s string) (UserSort, error) {
+	if s == "" {
+		return UserSort{}, nil
+	}
+
+	var sort UserSort
+	if strings.HasPrefix(s, "-") {
+		sort.Desc = true
+		s = s[1:]
+	}
+
+	switch f := SortField(s); f {
+	case SortByID, SortByCreatedAt, SortByUpdatedAt, SortByName, SortByRelevance:
+		sort.Field = f
+	default:
+		return UserSort{}, fmt.Errorf("%w: %q", ErrInvalidSort, s)
+	}
+
+	return sort, nil
+}
+
+// String is the inverse of ParseUserSort.
+func (s UserSort) String() string {
+	if s.Field == "" {
+		return ""
+	}
+	if s.Desc {
+		return "-" + string(s.Field)
+	}
+	return string(s.Field)
+}
+
+// resolveSort fills in the default sort for filter and validates it.
+func resolveSort(filter UserFilter) (UserSort, error) {
+	sort := filter.Sort
+
+	if sort.Field == "" {
+		if filter.Query != nil {
+			return UserSort{Field: SortByRelevance, Desc: true}, nil
+		}
+		return UserSort{Field: SortByID}, nil
+	}
+
+	if sort.Field == SortByRelevance && filter.Query == nil {
+		return UserSort{}, fmt.Errorf("%w: relevance requires a search query", ErrInvalidSort)
+	}
+
+	return sort, nil
+}
+
+//
+// =========
+// Cursor Keys
+// =========
+// Sort keys travel inside Cursor.Key as strings
+//
+
+// sortValue returns the sort key of u for field. rank is only used for
+// relevance.
+func sortValue(field SortField, u *domain.User, rank float64) interface{} {
+	switch field {
+	case SortByCreatedAt:
+		return u.CreatedAt()
+	case SortByUpdatedAt:
+		return u.UpdatedAt()
+	case SortByName:
+		return u.Name()
+	case SortByRelevance:
+		return rank
+	default:
+		return nil
+	}
+}
+
+func encodeSortValue(v interface{}) string {
+	switch v := v.(type) {
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case string:
+		return v
+	default:
+		return ""
+	}
+}
+
+// decodeSortValue parses Cursor.Key back into a value comparable
+// with sortValue's.
+func decodeSortValue(field SortField, key string) (interface{}, error) {
+	switch field {
+	case SortByCreatedAt, SortByUpdatedAt:
+		t, err := time.Parse(time.RFC3339Nano, key)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		return t, nil
+	case SortByRelevance:
+		rank, err := strconv.ParseFloat(key, 64)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		return rank, nil
+	case SortByName:
+		return key, nil
+	default:
+		return nil, nil
+	}
+}
+
+// compareSortValues orders two values returned by sortValue or
+// decodeSortValue for the same field.
+func compareSortValues(a, b interface{}) int {
+	switch a := a.(type) {
+	case time.Time:
+		return a.Compare(b.(time.Time))
+	case float64:
+		return cmp.Compare(a, b.(float64))
+	case string:
+		return strings.Compare(a, b.(string))
+	default:
+		return 0
+	}
+}
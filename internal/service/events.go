@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"go-prod-app/internal/domain"
+	"go-prod-app/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+//
+// =========================
+// Domain Events
+// =========================
+// Written to the outbox in the same transaction as the change
+//
+
+const (
+	EventUserCreated  = "user.created"
+	EventUserUpdated  = "user.updated"
+	EventUserDeleted  = "user.deleted"
+	EventUserRestored = "user.restored"
+)
+
+// UserEventPayload is the JSON body of every user event:
+// the state of the user after the change. It leaves the email out:
+// the outbox and its sinks would hold it in plaintext, which storage
+// encrypts. Consumers that need it read the user by ID.
+type UserEventPayload struct {
+	TenantID  string     `json:"tenant_id"`
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Version   int        `json:"version"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// recordEvent appends an event for user to the outbox.
+// Must be called inside the transaction that changed user.
+func (s *UserService) recordEvent(
+	ctx context.Context,
+	eventType string,
+	user *domain.User,
+) error {
+
+	if s.outbox == nil {
+		return nil
+	}
+
+	payload, err := json.Marshal(UserEventPayload{
+		TenantID:  repository.TenantFromContext(ctx),
+		ID:        string(user.ID()),
+		Name:      user.Name(),
+		Version:   user.Version(),
+		CreatedAt: user.CreatedAt(),
+		UpdatedAt: user.UpdatedAt(),
+		DeletedAt: user.DeletedAt(),
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.outbox.Append(ctx, &repository.OutboxMessage{
+		EventID:     uuid.NewString(),
+		AggregateID: string(user.ID()),
+		EventType:   eventType,
+		Payload:     payload,
+	})
+}
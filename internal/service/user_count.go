@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"go-prod-app/internal/repository"
+)
+
+type CountMode string
+
+const (
+	// CountExact always counts matching rows.
+	CountExact CountMode = "exact"
+	// CountEstimated uses table statistics (WithCountEstimator).
+	CountEstimated CountMode = "estimated"
+	// CountAuto counts exactly within the exact count timeout and
+	// falls back to the estimate after it.
+	CountAuto CountMode = "auto"
+)
+
+func ParseCountMode(s string) (CountMode, error) {
+	switch m := CountMode(s); m {
+	case CountExact, CountEstimated, CountAuto:
+		return m, nil
+	case "":
+		return CountAuto, nil
+	default:
+		return "", fmt.Errorf("%w: unknown count mode %q", ErrInvalidInput, s)
+	}
+}
+
+type UserCount struct {
+	Count int64
+	// Exact is false when Count is an estimate.
+	Exact bool
+}
+
+//
+// =========================
+// CountUsers
+// =========================
+// Without an estimator every mode counts exactly
+//
+
+func (s *UserService) CountUsers(
+	ctx context.Context,
+	filter repository.UserFilter,
+	mode CountMode,
+) (UserCount, error) {
+
+	if err := ctx.Err(); err != nil {
+		return UserCount{}, err
+	}
+
+	if s.estimator == nil {
+		mode = CountExact
+	}
+
+	switch mode {
+	case CountEstimated:
+		return s.estimateCount(ctx, filter)
+
+	case CountAuto:
+		exactCtx, cancel := context.WithTimeout(ctx, s.exactCountTimeout)
+		defer cancel()
+
+		n, err := s.repo.Count(exactCtx, filter)
+		if err == nil {
+			return UserCount{Count: n, Exact: true}, nil
+		}
+
+		// Only our own deadline falls back; the caller giving up or a
+		// failing database is reported as is.
+		if ctx.Err() != nil || exactCtx.Err() == nil {
+			return UserCount{}, err
+		}
+
+		return s.estimateCount(ctx, filter)
+
+	default:
+		n, err := s.repo.Count(ctx, filter)
+		if err != nil {
+			return UserCount{}, err
+		}
+		return UserCount{Count: n, Exact: true}, nil
+	}
+}
+
+func (s *UserService) estimateCount(
+	ctx context.Context,
+	filter repository.UserFilter,
+) (UserCount, error) {
+
+	n, err := s.estimator.EstimateCount(ctx, filter)
+	if err != nil {
+		return UserCount{}, err
+	}
+
+	return UserCount{Count: n, Exact: false}, nil
+}
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"context"
+
+	"go-prod-app/internal/domain"
+	"go-prod-app/internal/repository"
+)
+
+//
+// =========================
+// ExportUsers
+// =========================
+//
+
+// ExportUsers calls fn for every user matching filter after afterID, in
+// ID order (see repository.UserExporter). It needs WithExporter.
+func (s *UserService) ExportUsers(
+	ctx context.Context,
+	filter repository.UserFilter,
+	afterID domain.UserID,
+	fn func(*domain.User) error,
+) error {
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if s.exporter == nil {
+		return ErrNotSupported
+	}
+
+	return s.exporter.Export(ctx, filter, afterID, fn)
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"go-prod-app/internal/domain"
+	"go-prod-app/internal/repository"
+)
+
+const maxHistoryLimit = 100
+
+// FieldChange is one field-level difference between two versions.
+// From is nil when the field had no previous value.
+type FieldChange struct {
+	Field string
+	From  *string
+	To    *string
+}
+
+type UserHistoryEntry struct {
+	Version *repository.UserVersion
+	Changes []FieldChange
+}
+
+type UserHistoryPage struct {
+	Entries []UserHistoryEntry
+	// NextBefore is the beforeVersion for the next (older) page, 0 if none.
+	NextBefore int
+}
+
+//
+// =========================
+// GetUserHistory
+// =========================
+// Newest first; soft-deleted users keep their history
+//
+
+func (s *UserService) GetUserHistory(
+	ctx context.Context,
+	id domain.UserID,
+	beforeVersion int,
+	limit int,
+) (*UserHistoryPage, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if s.history == nil {
+		return nil, ErrNotSupported
+	}
+
+	if limit <= 0 || limit > maxHistoryLimit {
+		limit = maxHistoryLimit
+	}
+
+	if _, err := s.repo.GetByID(ctx, id); err != nil {
+		return nil, err
+	}
+
+	// One extra version: the diff base of the oldest entry on this page,
+	// and the signal that an older page exists.
+	versions, err := s.history.ListVersions(ctx, id, beforeVersion, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &UserHistoryPage{}
+
+	for i := 0; i < len(versions) && i < limit; i++ {
+		var prev *repository.UserVersion
+		if i+1 < len(versions) {
+			prev = versions[i+1]
+		}
+
+		page.Entries = append(page.Entries, UserHistoryEntry{
+			Version: versions[i],
+			Changes: diffVersions(prev, versions[i]),
+		})
+	}
+
+	if len(versions) > limit {
+		page.NextBefore = versions[limit-1].User.Version()
+	}
+
+	return page, nil
+}
+
+//
+// =========================
+// GetUserAsOf
+// =========================
+//
+
+func (s *UserService) GetUserAsOf(
+	ctx context.Context,
+	id domain.UserID,
+	at time.Time,
+) (*domain.User, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if s.history == nil {
+		return nil, ErrNotSupported
+	}
+
+	return s.history.GetAsOf(ctx, id, at)
+}
+
+// diffVersions lists the fields that differ between prev and cur.
+// Without prev (first known version) the recorded changed fields are
+// reported as set from nothing.
+func diffVersions(prev, cur *repository.UserVersion) []FieldChange {
+	curFields := versionFields(cur.User)
+
+	changes := []FieldChange{}
+
+	if prev == nil {
+		for _, f := range cur.ChangedFields {
+			changes = append(changes, FieldChange{Field: f, To: curFields[f]})
+		}
+		return changes
+	}
+
+	prevFields := versionFields(prev.User)
+
+	for _, f := range []string{
+		repository.FieldName,
+		repository.FieldEmail,
+		repository.FieldDeletedAt,
+	} {
+		if !equalPtr(prevFields[f], curFields[f]) {
+			changes = append(changes, FieldChange{
+				Field: f,
+				From:  prevFields[f],
+				To:    curFields[f],
+			})
+		}
+	}
+
+	return changes
+}
+
+func versionFields(u *domain.User) map[string]*string {
+	name := u.Name()
+	email := u.Email()
+
+	var deletedAt *string
+	if u.DeletedAt() != nil {
+		d := u.DeletedAt().UTC().Format(time.RFC3339Nano)
+		deletedAt = &d
+	}
+
+	return map[string]*string{
+		repository.FieldName:      &name,
+		repository.FieldEmail:     &email,
+		repository.FieldDeletedAt: deletedAt,
+	}
+}
+
+func equalPtr(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-prod-app/internal/domain"
+	"go-prod-app/internal/importer"
+)
+
+type ImportStatus string
+
+const (
+	ImportCreated   ImportStatus = "created"
+	ImportDuplicate ImportStatus = "duplicate"
+	ImportInvalid   ImportStatus = "invalid"
+)
+
+type ImportOptions struct {
+	// DryRun reports what the import would do without writing anything.
+	DryRun bool
+	// AbortOnError writes nothing unless every row can be created.
+	// Otherwise invalid and duplicate rows are skipped.
+	AbortOnError bool
+}
+
+// ImportRow is the outcome of one input row.
+type ImportRow struct {
+	Row    int
+	Email  string
+	Status ImportStatus
+	// Reason says why the row is not created.
+	Reason string
+	// User is the created user, once the import is applied.
+	User *domain.User
+}
+
+// ImportReport has a row for every input row, in order. When the
+// import is not applied (dry run or abort) the statuses say what it
+// would have done.
+type ImportReport struct {
+	Rows      []ImportRow
+	Created   int
+	Duplicate int
+	Invalid   int
+	Applied   bool
+}
+
+// errNotApplied rolls back an import that turns out not to be applied.
+var errNotApplied = errors.New("import not applied")
+
+//
+// =========================
+// ImportUsers
+// =========================
+// Validates every row, then creates the valid ones in one transaction
+// An import known not to be applied only reads which emails are taken
+//
+
+// ImportUsers creates the users of records whose email is not taken by
+// an active user or an earlier row. It needs WithImporter.
+func (s *UserService) ImportUsers(
+	ctx context.Context,
+	records []importer.Record,
+	opts ImportOptions,
+) (*ImportReport, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if s.importer == nil {
+		return nil, ErrNotSupported
+	}
+
+	now := time.Now().UTC()
+
+	report := &ImportReport{Rows: make([]ImportRow, len(records))}
+
+	var (
+		users []*domain.User
+		// index into report.Rows of each of users
+		rowOf     []int
+		firstRows = make(map[string]int)
+	)
+
+	for i, rec := range records {
+		row := &report.Rows[i]
+		row.Row = rec.Row
+		row.Email = rec.Email
+
+		if rec.Err != nil {
+			row.Status, row.Reason = ImportInvalid, rec.Err.Error()
+			continue
+		}
+
+		user, err := domain.NewUser(rec.Name, rec.Email, now)
+		if err != nil {
+			row.Status, row.Reason = ImportInvalid, err.Error()
+			continue
+		}
+
+		row.Email = user.Email()
+
+		if first, ok := firstRows[user.Email()]; ok {
+			row.Status, row.Reason = ImportDuplicate, fmt.Sprintf("email repeats row %d", first)
+			continue
+		}
+		firstRows[user.Email()] = rec.Row
+
+		users = append(users, user)
+		rowOf = append(rowOf, i)
+	}
+
+	// A dry run, or an abort already decided by the input, must not
+	// take the locks of the merge.
+	if opts.DryRun || (opts.AbortOnError && len(users) < len(records)) {
+		taken, err := s.importer.EmailsTaken(ctx, users)
+		if err != nil {
+			return nil, err
+		}
+
+		created := make([]bool, len(taken))
+		for j := range taken {
+			created[j] = !taken[j]
+		}
+
+		report.resolve(rowOf, created)
+		return report, nil
+	}
+
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		created, err := s.importer.Import(ctx, users)
+		if err != nil {
+			return err
+		}
+
+		report.resolve(rowOf, created)
+
+		if opts.AbortOnError && report.Duplicate > 0 {
+			return errNotApplied
+		}
+
+		for j, ok := range created {
+			if !ok {
+				continue
+			}
+			if err := s.recordEvent(ctx, EventUserCreated, users[j]); err != nil {
+				return err
+			}
+			report.Rows[rowOf[j]].User = users[j]
+		}
+		return nil
+	})
+
+	if errors.Is(err, errNotApplied) {
+		return report, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	report.Applied = true
+	return report, nil
+}
+
+// resolve sets the status of the rows at rowOf from whether their
+// users are (or would be) created, and counts the rows.
+func (r *ImportReport) resolve(rowOf []int, created []bool) {
+	for j, ok := range created {
+		row := &r.Rows[rowOf[j]]
+		if ok {
+			row.Status = ImportCreated
+		} else {
+			row.Status, row.Reason = ImportDuplicate, "email is already used by an active user"
+		}
+	}
+
+	r.count()
+}
+
+func (r *ImportReport) count() {
+	r.Created, r.Duplicate, r.Invalid = 0, 0, 0
+
+	for _, row := range r.Rows {
+		switch row.Status {
+		case ImportCreated:
+			r.Created++
+		case ImportDuplicate:
+			r.Duplicate++
+		case ImportInvalid:
+			r.Invalid++
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"go-prod-app/internal/domain"
@@ -15,21 +16,114 @@ var (
 	ErrUserNotFound   = repository.ErrUserNotFound
 	ErrDuplicateEmail = repository.ErrDuplicateEmail
 	ErrConflict       = repository.ErrVersionConflict
+	ErrInvalidCursor  = repository.ErrInvalidCursor
+	ErrInvalidSort    = repository.ErrInvalidSort
+	ErrNotSupported   = errors.New("not supported by storage backend")
+	ErrNotDeleted     = domain.ErrUserNotDeleted
+	ErrEmailTaken     = errors.New("email is taken by another active user")
+	ErrUnavailable    = repository.ErrTransient
+	ErrTimeout        = repository.ErrTimeout
+
+	ErrTenantNotSupported = repository.ErrTenantNotSupported
 )
 
 type UserService struct {
-	repo   repository.UserRepository
-	health repository.HealthChecker
+	repo      repository.UserRepository
+	health    repository.HealthChecker
+	tx        repository.TxManager
+	outbox    repository.OutboxRepository
+	history   repository.UserHistoryRepository
+	searcher  repository.UserSearcher
+	exporter  repository.UserExporter
+	importer  repository.UserImporter
+	estimator repository.UserCountEstimator
+	pools     []repository.PoolHealth
+
+	exactCountTimeout time.Duration
+}
+
+type Option func(*UserService)
+
+// WithTxManager makes multi-step operations run in a single transaction.
+// Without it every repository call commits on its own.
+func WithTxManager(tx repository.TxManager) Option {
+	return func(s *UserService) { s.tx = tx }
+}
+
+// WithOutbox publishes a user.* event for every successful write.
+// Events are appended in the write's transaction, so pair it with
+// WithTxManager.
+func WithOutbox(outbox repository.OutboxRepository) Option {
+	return func(s *UserService) { s.outbox = outbox }
+}
+
+// WithHistory enables version history and point-in-time reads.
+func WithHistory(history repository.UserHistoryRepository) Option {
+	return func(s *UserService) { s.history = history }
+}
+
+// WithSearcher enables autocomplete suggestions.
+func WithSearcher(searcher repository.UserSearcher) Option {
+	return func(s *UserService) { s.searcher = searcher }
+}
+
+// WithExporter enables streaming exports.
+func WithExporter(exporter repository.UserExporter) Option {
+	return func(s *UserService) { s.exporter = exporter }
+}
+
+// WithImporter enables bulk imports. Dry runs and aborted imports are
+// rolled back, so pair it with WithTxManager.
+func WithImporter(importer repository.UserImporter) Option {
+	return func(s *UserService) { s.importer = importer }
+}
+
+// WithCountEstimator enables estimated counts. Without it every count
+// is exact.
+func WithCountEstimator(estimator repository.UserCountEstimator) Option {
+	return func(s *UserService) { s.estimator = estimator }
+}
+
+// WithExactCountTimeout bounds the exact count of CountAuto before it
+// falls back to the estimate (default 1s).
+func WithExactCountTimeout(d time.Duration) Option {
+	return func(s *UserService) { s.exactCountTimeout = d }
+}
+
+// WithPoolHealth makes Degraded report saturated connection pools.
+func WithPoolHealth(pools ...repository.PoolHealth) Option {
+	return func(s *UserService) { s.pools = append(s.pools, pools...) }
 }
 
 func NewUserService(
 	repo repository.UserRepository,
 	health repository.HealthChecker,
+	opts ...Option,
 ) *UserService {
-	return &UserService{
+	s := &UserService{
 		repo:   repo,
 		health: health,
+		tx:     noTx{},
+
+		exactCountTimeout: time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(s)
 	}
+
+	return s
+}
+
+// noTx runs fn directly, without a transaction.
+type noTx struct{}
+
+func (noTx) WithinTx(
+	ctx context.Context,
+	fn func(ctx context.Context) error,
+	_ ...repository.TxOption,
+) error {
+	return fn(ctx)
 }
 
 //
@@ -55,13 +149,70 @@ func (s *UserService) CreateUser(
 		return nil, fmt.Errorf("%w: %v", ErrInvalidInput, err)
 	}
 
-	if err := s.repo.Create(ctx, user); err != nil {
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.repo.Create(ctx, user); err != nil {
+			return err
+		}
+
+		return s.recordEvent(ctx, EventUserCreated, user)
+	})
+	if err != nil {
 		return nil, err
 	}
 
 	return user, nil
 }
 
+//
+// =========================
+// UpsertUserByEmail
+// =========================
+// Idempotent create-or-rename for provisioning
+//
+
+func (s *UserService) UpsertUserByEmail(
+	ctx context.Context,
+	email string,
+	name string,
+) (*domain.User, repository.UpsertOutcome, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+
+	candidate, err := domain.NewUser(name, email, time.Now().UTC())
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+
+	var (
+		user    *domain.User
+		outcome repository.UpsertOutcome
+	)
+
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+
+		user, outcome, err = s.repo.UpsertByEmail(ctx, candidate)
+		if err != nil {
+			return err
+		}
+
+		switch outcome {
+		case repository.UpsertCreated:
+			return s.recordEvent(ctx, EventUserCreated, user)
+		case repository.UpsertUpdated:
+			return s.recordEvent(ctx, EventUserUpdated, user)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return user, outcome, nil
+}
+
 //
 // =========================
 // UpdateUser
@@ -79,26 +230,37 @@ func (s *UserService) UpdateUser(
 		return nil, err
 	}
 
-	user, err := s.repo.GetByID(ctx, id)
-	if err != nil {
-		return nil, err
-	}
+	var user *domain.User
 
-	if user.IsDeleted() {
-		return nil, ErrUserNotFound
-	}
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
 
-	now := time.Now().UTC()
+		user, err = s.repo.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
 
-	if err := user.ChangeName(name, now); err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrInvalidInput, err)
-	}
+		if user.IsDeleted() {
+			return ErrUserNotFound
+		}
 
-	if err := user.ChangeEmail(email, now); err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrInvalidInput, err)
-	}
+		now := time.Now().UTC()
+
+		if err := user.ChangeName(name, now); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+		}
 
-	if err := s.repo.Update(ctx, user); err != nil {
+		if err := user.ChangeEmail(email, now); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+		}
+
+		if err := s.repo.Update(ctx, user); err != nil {
+			return err
+		}
+
+		return s.recordEvent(ctx, EventUserUpdated, user)
+	})
+	if err != nil {
 		return nil, err
 	}
 
@@ -120,22 +282,80 @@ func (s *UserService) DeleteUser(
 		return err
 	}
 
-	user, err := s.repo.GetByID(ctx, id)
-	if err != nil {
-		return err
-	}
+	return s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		user, err := s.repo.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
 
-	if user.IsDeleted() {
-		return ErrUserNotFound
+		if user.IsDeleted() {
+			return ErrUserNotFound
+		}
+
+		now := time.Now().UTC()
+
+		if err := user.Delete(now); err != nil {
+			return err
+		}
+
+		if err := s.repo.Update(ctx, user); err != nil {
+			return err
+		}
+
+		return s.recordEvent(ctx, EventUserDeleted, user)
+	})
+}
+
+//
+// =========================
+// RestoreUser (Undo Soft Delete)
+// =========================
+// expectedVersion > 0 guards against restoring a user that changed
+// since the caller looked at it
+//
+
+func (s *UserService) RestoreUser(
+	ctx context.Context,
+	id domain.UserID,
+	expectedVersion int,
+) (*domain.User, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
-	now := time.Now().UTC()
+	var user *domain.User
 
-	if err := user.Delete(now); err != nil {
-		return err
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+
+		user, err = s.repo.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if expectedVersion > 0 && user.Version() != expectedVersion {
+			return ErrConflict
+		}
+
+		if err := user.Restore(time.Now().UTC()); err != nil {
+			return err
+		}
+
+		if err := s.repo.Update(ctx, user); err != nil {
+			if errors.Is(err, repository.ErrDuplicateEmail) {
+				return ErrEmailTaken
+			}
+			return err
+		}
+
+		return s.recordEvent(ctx, EventUserRestored, user)
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return s.repo.Update(ctx, user)
+	return user, nil
 }
 
 //
@@ -194,10 +414,10 @@ func (s *UserService) ListUsers(
 	filter repository.UserFilter,
 	cursor *repository.Cursor,
 	limit int,
-) ([]*domain.User, *repository.Cursor, error) {
+) (*repository.UserPage, error) {
 
 	if err := ctx.Err(); err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	return s.repo.List(ctx, filter, cursor, limit)
@@ -205,22 +425,48 @@ func (s *UserService) ListUsers(
 
 //
 // =========================
-// CountUsers
+// SuggestUsers
 // =========================
 //
 
-func (s *UserService) CountUsers(
+const maxSuggestLimit = 20
+
+func (s *UserService) SuggestUsers(
 	ctx context.Context,
-	filter repository.UserFilter,
-) (int64, error) {
+	q string,
+	limit int,
+) ([]*domain.User, error) {
 
 	if err := ctx.Err(); err != nil {
-		return 0, err
+		return nil, err
+	}
+
+	if s.searcher == nil {
+		return nil, ErrNotSupported
 	}
 
-	return s.repo.Count(ctx, filter)
+	q = strings.TrimSpace(q)
+	if q == "" {
+		return nil, fmt.Errorf("%w: q is required", ErrInvalidInput)
+	}
+
+	if limit <= 0 || limit > maxSuggestLimit {
+		limit = maxSuggestLimit
+	}
+
+	return s.searcher.Suggest(ctx, q, limit)
 }
 
 func (s *UserService) Ping(ctx context.Context) error {
 	return s.health.Ping(ctx)
 }
+
+// Degraded reports whether a connection pool has stayed saturated.
+func (s *UserService) Degraded() bool {
+	for _, p := range s.pools {
+		if p.Saturated() {
+			return true
+		}
+	}
+	return false
+}